@@ -0,0 +1,14 @@
+package app
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/auth"
+)
+
+// NewRouter returns a gin engine with every message endpoint registered.
+// Without verifiers the requests aren't authenticated.
+func NewRouter(verifiers ...auth.Verifier) *gin.Engine {
+	router := gin.Default()
+	mapUrls(router, verifiers)
+	return router
+}
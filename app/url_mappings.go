@@ -0,0 +1,70 @@
+package app
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/controllers"
+)
+
+func mapUrls(router *gin.Engine, verifiers []auth.Verifier) {
+	router.GET("/health", controllers.Health)
+
+	// gin gives a middleware to the routes registered after it, and to the
+	// NoRoute handlers, so /health stays open to the probes.
+	if len(verifiers) > 0 {
+		router.Use(controllers.Authenticate(verifiers...))
+	}
+	router.Use(controllers.ResolveTenant())
+
+	router.GET("/messages", controllers.ListMessages)
+	router.GET("/messages/:message_id", staticSegments("message_id", map[string]gin.HandlerFunc{
+		"search": controllers.SearchMessages,
+	}, controllers.GetMessage))
+	router.POST("/messages", controllers.CreateMessage)
+	router.PUT("/messages/:message_id", controllers.UpdateMessage)
+	router.DELETE("/messages/:message_id", controllers.DeleteMessage)
+	router.POST("/messages/:message_id/restore", controllers.RestoreMessage)
+
+	router.GET("/messages/:message_id/revisions", controllers.ListRevisions)
+	router.GET("/messages/:message_id/revisions/:revision_id", controllers.GetRevision)
+	router.POST("/messages/:message_id/revisions/:revision_id/revert", controllers.RevertMessage)
+	router.GET("/messages/:message_id/diff", controllers.DiffRevisions)
+
+	router.GET("/tags", controllers.ListTags)
+
+	router.GET("/me/permissions", controllers.GetPermissions)
+
+	router.GET("/api-keys", controllers.ListAPIKeys)
+	router.POST("/api-keys", controllers.CreateAPIKey)
+	router.POST("/api-keys/:key_id/rotate", controllers.RotateAPIKey)
+	router.DELETE("/api-keys/:key_id", controllers.RevokeAPIKey)
+
+	mapCustomMethods(router, map[string]gin.HandlerFunc{
+		"POST /messages:batch": controllers.BatchMessages,
+		"POST /tags:rename":    controllers.RenameTags,
+	})
+}
+
+// mapCustomMethods serves the "/collection:method" routes, which gin would
+// read as a parameter clashing with "/collection/:id". They are looked up
+// once no route matched, other paths keep the default not found answer.
+func mapCustomMethods(router *gin.Engine, handlers map[string]gin.HandlerFunc) {
+	router.NoRoute(func(c *gin.Context) {
+		if handler, ok := handlers[c.Request.Method+" "+c.Request.URL.Path]; ok {
+			handler(c)
+		}
+	})
+}
+
+// staticSegments serves the fixed routes living next to a parameter, like
+// "/messages/search" next to "/messages/:message_id", which gin can't tell
+// apart. The value of param picks the handler, any other value goes to fallback.
+func staticSegments(param string, handlers map[string]gin.HandlerFunc, fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if handler, ok := handlers[c.Param(param)]; ok {
+			handler(c)
+			return
+		}
+		fallback(c)
+	}
+}
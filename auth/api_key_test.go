@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAPIKeyRequest(key string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+	if key != "" {
+		r.Header.Set(APIKeyHeader, key)
+	}
+	return r
+}
+
+func TestParseAPIKey(t *testing.T) {
+	id, secret, ok := ParseAPIKey(FormatAPIKey("abc", "s.e.cret"))
+	assert.True(t, ok)
+	assert.EqualValues(t, "abc", id)
+	assert.EqualValues(t, "s.e.cret", secret)
+
+	for _, key := range []string{"", "abc", ".secret", "abc."} {
+		_, _, ok := ParseAPIKey(key)
+		assert.False(t, ok, key)
+	}
+}
+
+func TestAPIKeyVerifier(t *testing.T) {
+	domain.APIKeyRepo = domain.NewMemoryAPIKeyRepository()
+	id, _ := NewAPIKeyID()
+	secret, _ := NewAPIKeySecret()
+	err := domain.APIKeyRepo.CreateAPIKey(context.Background(), &domain.APIKey{
+		ID: id, Name: "ci", PrincipalID: "robot", Roles: []string{RoleAdmin}, SecretHash: HashAPIKeySecret(secret), CreatedAt: time.Now(),
+	})
+	assert.Nil(t, err)
+	v := APIKeyVerifier{}
+
+	p, verifyErr := v.Verify(newAPIKeyRequest(""))
+	assert.Nil(t, p)
+	assert.Nil(t, verifyErr)
+
+	p, verifyErr = v.Verify(newAPIKeyRequest(FormatAPIKey(id, secret)))
+	assert.Nil(t, verifyErr)
+	assert.EqualValues(t, "robot", p.ID)
+	assert.True(t, p.HasRole(RoleAdmin))
+
+	for _, key := range []string{"garbage", FormatAPIKey(id, "wrong"), FormatAPIKey("unknown", secret)} {
+		p, verifyErr = v.Verify(newAPIKeyRequest(key))
+		assert.Nil(t, p, key)
+		assert.EqualValues(t, http.StatusUnauthorized, verifyErr.Status(), key)
+		assert.EqualValues(t, CodeInvalidAPIKey, verifyErr.Code(), key)
+	}
+
+	assert.Nil(t, domain.APIKeyRepo.RevokeAPIKey(context.Background(), id, time.Now()))
+	p, verifyErr = v.Verify(newAPIKeyRequest(FormatAPIKey(id, secret)))
+	assert.Nil(t, p)
+	assert.EqualValues(t, CodeInvalidAPIKey, verifyErr.Code())
+}
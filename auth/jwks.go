@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// jwk is a key of a JWKS file, as in RFC 7517. Only the members of the RSA,
+// EC and symmetric keys are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// oct
+	K string `json:"k"`
+}
+
+// verificationKey is a key of a jwks and the algorithms it checks.
+type verificationKey struct {
+	key     interface{}
+	methods []string
+}
+
+// jwks holds the signature keys of a JWKS file by kid.
+type jwks map[string]verificationKey
+
+// loadJWKS reads the JWKS file at path.
+func loadJWKS(path string) (jwks, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(data)
+}
+
+// parseJWKS decodes a JWKS, skipping the keys meant for encryption. Every
+// key must have a distinct kid, but for a lone key.
+func parseJWKS(data []byte) (jwks, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(jwks)
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.verificationKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %v", i, err)
+		}
+		if _, ok := keys[k.Kid]; ok {
+			return nil, fmt.Errorf("key %d: duplicate kid %q", i, k.Kid)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signature key found")
+	}
+	if _, ok := keys[""]; ok && len(keys) > 1 {
+		return nil, errors.New("every key needs a kid when there are several")
+	}
+	return keys, nil
+}
+
+func (k *jwk) verificationKey() (verificationKey, error) {
+	var (
+		vk  verificationKey
+		err error
+	)
+	switch k.Kty {
+	case "RSA":
+		vk.key, err = k.rsaKey()
+		vk.methods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+	case "EC":
+		var key *ecdsa.PublicKey
+		key, err = k.ecKey()
+		if err == nil {
+			vk.key = key
+			vk.methods = []string{ecMethods[key.Curve.Params().Name]}
+		}
+	case "oct":
+		vk.key, err = decodeSegment(k.K)
+		vk.methods = hmacMethods
+	default:
+		err = fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+	if err != nil {
+		return vk, err
+	}
+	if k.Alg != "" {
+		if !contains(vk.methods, k.Alg) {
+			return vk, fmt.Errorf("algorithm %s does not fit a %s key", k.Alg, k.Kty)
+		}
+		vk.methods = []string{k.Alg}
+	}
+	return vk, nil
+}
+
+var ecMethods = map[string]string{
+	"P-256": "ES256",
+	"P-384": "ES384",
+	"P-521": "ES512",
+}
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func (k *jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeSegment(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %v", err)
+	}
+	e, err := decodeSegment(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %v", err)
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid rsa key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func (k *jwk) ecKey() (*ecdsa.PublicKey, error) {
+	curve, ok := curves[k.Crv]
+	if !ok {
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := decodeSegment(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x: %v", err)
+	}
+	y, err := decodeSegment(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y: %v", err)
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("the point is not on the curve")
+	}
+	return key, nil
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("missing value")
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// methods lists every algorithm a key of keys checks.
+func (keys jwks) methods() []string {
+	var methods []string
+	for _, key := range keys {
+		for _, m := range key.methods {
+			if !contains(methods, m) {
+				methods = append(methods, m)
+			}
+		}
+	}
+	return methods
+}
+
+// keyfunc picks the key named by the kid of token, the lone key when it has
+// none, and makes sure the key goes with the algorithm of token.
+func (keys jwks) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := keys[kid]
+	if !ok && kid == "" && len(keys) == 1 {
+		for _, only := range keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if !contains(key.methods, token.Method.Alg()) {
+		return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
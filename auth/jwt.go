@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// JWTOptions are the claims a JWTVerifier requires besides a valid signature.
+type JWTOptions struct {
+	// Issuer is the iss claim tokens must have, any when empty.
+	Issuer string
+	// Audience must be one of the aud claim of tokens, any when empty.
+	Audience string
+}
+
+// tokenClaims are the claims read from the tokens, sub being the principal.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Roles    []string `json:"roles,omitempty"`
+	TenantID string   `json:"tenant_id,omitempty"`
+}
+
+// JWTVerifier authenticates the requests sending a JWT as a bearer token.
+// Tokens must be signed with one of the keys of the verifier, expire, and
+// name their principal in sub.
+type JWTVerifier struct {
+	opts    JWTOptions
+	parser  *jwt.Parser
+	keyfunc jwt.Keyfunc
+}
+
+var hmacMethods = []string{"HS256", "HS384", "HS512"}
+
+// NewHMACVerifier returns a verifier of the tokens signed with secret.
+func NewHMACVerifier(secret []byte, opts JWTOptions) *JWTVerifier {
+	return &JWTVerifier{
+		opts:   opts,
+		parser: jwt.NewParser(jwt.WithValidMethods(hmacMethods)),
+		keyfunc: func(*jwt.Token) (interface{}, error) {
+			return secret, nil
+		},
+	}
+}
+
+// NewJWKSVerifier returns a verifier of the tokens signed with a key of the
+// JWKS file at path. The file is read once, restart to pick up new keys.
+func NewJWKSVerifier(path string, opts JWTOptions) (*JWTVerifier, error) {
+	keys, err := loadJWKS(path)
+	if err != nil {
+		return nil, err
+	}
+	return &JWTVerifier{
+		opts:    opts,
+		parser:  jwt.NewParser(jwt.WithValidMethods(keys.methods())),
+		keyfunc: keys.keyfunc,
+	}, nil
+}
+
+func (v *JWTVerifier) Challenge() string {
+	return "Bearer"
+}
+
+func (v *JWTVerifier) Verify(r *http.Request) (*Principal, errorutils.MessageErr) {
+	header := r.Header.Get("Authorization")
+	scheme, token := header, ""
+	if i := strings.IndexByte(header, ' '); i >= 0 {
+		scheme, token = header[:i], strings.TrimSpace(header[i+1:])
+	}
+	if !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+	if token == "" {
+		return nil, newInvalidTokenError("the bearer token is empty")
+	}
+
+	var claims tokenClaims
+	if _, err := v.parser.ParseWithClaims(token, &claims, v.keyfunc); err != nil {
+		return nil, newInvalidTokenError(tokenErrorMessage(err))
+	}
+	if claims.ExpiresAt == nil {
+		return nil, newInvalidTokenError("the token has no expiration")
+	}
+	if claims.Subject == "" {
+		return nil, newInvalidTokenError("the token has no subject")
+	}
+	if v.opts.Issuer != "" && !claims.VerifyIssuer(v.opts.Issuer, true) {
+		return nil, newInvalidTokenError("the token has another issuer")
+	}
+	if v.opts.Audience != "" && !claims.VerifyAudience(v.opts.Audience, true) {
+		return nil, newInvalidTokenError("the token is meant for another audience")
+	}
+	if claims.TenantID != "" && !domain.ValidTenant(claims.TenantID) {
+		return nil, newInvalidTokenError("the tenant_id claim is malformed")
+	}
+	return &Principal{ID: claims.Subject, Roles: claims.Roles, TenantID: claims.TenantID}, nil
+}
+
+// tokenErrorMessage tells clients why their token was refused, without the
+// details of a bad signature.
+func tokenErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "the token is expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return "the token is not valid yet"
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return "the token is malformed"
+	}
+	return "the token signature is invalid"
+}
+
+func newInvalidTokenError(message string) errorutils.MessageErr {
+	return errorutils.WithCode(errorutils.NewUnauthorizedError(fmt.Sprintf("invalid token: %s", message)), CodeInvalidToken)
+}
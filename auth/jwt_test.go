@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func newBearerRequest(token string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("an error %v was not expected when signing the token", err)
+	}
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":       "alice",
+		"iss":       "https://issuer.example",
+		"aud":       "messages",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"roles":     []string{RoleAdmin},
+		"tenant_id": "acme",
+	}
+}
+
+func TestJWTVerifier_HMAC(t *testing.T) {
+	v := NewHMACVerifier(testSecret, JWTOptions{Issuer: "https://issuer.example", Audience: "messages"})
+
+	p, err := v.Verify(newBearerRequest(sign(t, jwt.SigningMethodHS256, testSecret, "", validClaims())))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "alice", p.ID)
+	assert.True(t, p.HasRole(RoleAdmin))
+	assert.EqualValues(t, "acme", p.TenantID)
+
+	r, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+	p, err = v.Verify(r)
+	assert.Nil(t, p)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", "Basic YWxpY2U6cGFzcw==")
+	p, err = v.Verify(r)
+	assert.Nil(t, p)
+	assert.Nil(t, err)
+}
+
+func TestJWTVerifier_Invalid(t *testing.T) {
+	v := NewHMACVerifier(testSecret, JWTOptions{Issuer: "https://issuer.example", Audience: "messages"})
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := map[string]string{
+		"empty":         "",
+		"malformed":     "not.a.token",
+		"wrong secret":  sign(t, jwt.SigningMethodHS256, []byte("another secret"), "", validClaims()),
+		"expired":       sign(t, jwt.SigningMethodHS256, testSecret, "", with("exp", time.Now().Add(-time.Minute).Unix())),
+		"not yet valid": sign(t, jwt.SigningMethodHS256, testSecret, "", with("nbf", time.Now().Add(time.Hour).Unix())),
+		"no expiration": sign(t, jwt.SigningMethodHS256, testSecret, "", with("exp", nil)),
+		"no subject":    sign(t, jwt.SigningMethodHS256, testSecret, "", with("sub", nil)),
+		"other issuer":  sign(t, jwt.SigningMethodHS256, testSecret, "", with("iss", "https://other.example")),
+		"other aud":     sign(t, jwt.SigningMethodHS256, testSecret, "", with("aud", []string{"billing"})),
+		"bad tenant":    sign(t, jwt.SigningMethodHS256, testSecret, "", with("tenant_id", "acme corp")),
+		"none":          sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validClaims()),
+	}
+	for name, token := range tests {
+		p, err := v.Verify(newBearerRequest(token))
+		assert.Nil(t, p, name)
+		if assert.NotNil(t, err, name) {
+			assert.EqualValues(t, http.StatusUnauthorized, err.Status(), name)
+			assert.EqualValues(t, CodeInvalidToken, err.Code(), name)
+		}
+	}
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJWKS(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatalf("an error %v was not expected when creating a temp dir", err)
+	}
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("an error %v was not expected when writing the jwks", err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestJWTVerifier_JWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path, cleanup := writeJWKS(t, fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "alg": "RS256", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": "AQAB", "e": "AQAB"}
+	]}`, encode(rsaKey.N.Bytes()), encode(big.NewInt(int64(rsaKey.E)).Bytes()), encode(ecKey.X.Bytes()), encode(ecKey.Y.Bytes())))
+	defer cleanup()
+
+	v, loadErr := NewJWKSVerifier(path, JWTOptions{})
+	assert.Nil(t, loadErr)
+
+	p, err := v.Verify(newBearerRequest(sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", validClaims())))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "alice", p.ID)
+
+	p, err = v.Verify(newBearerRequest(sign(t, jwt.SigningMethodES256, ecKey, "ec-1", validClaims())))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "alice", p.ID)
+
+	for name, token := range map[string]string{
+		"unknown kid":   sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-2", validClaims()),
+		"no kid":        sign(t, jwt.SigningMethodRS256, rsaKey, "", validClaims()),
+		"other alg":     sign(t, jwt.SigningMethodRS512, rsaKey, "rsa-1", validClaims()),
+		"key swapped":   sign(t, jwt.SigningMethodES256, ecKey, "rsa-1", validClaims()),
+		"hmac with rsa": sign(t, jwt.SigningMethodHS256, rsaKey.N.Bytes(), "rsa-1", validClaims()),
+	} {
+		p, err := v.Verify(newBearerRequest(token))
+		assert.Nil(t, p, name)
+		if assert.NotNil(t, err, name) {
+			assert.EqualValues(t, CodeInvalidToken, err.Code(), name)
+		}
+	}
+}
+
+func TestParseJWKS_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"not json":      `keys`,
+		"no keys":       `{"keys": []}`,
+		"only enc keys": `{"keys": [{"kty": "oct", "use": "enc", "k": "c2VjcmV0"}]}`,
+		"unknown kty":   `{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "AA"}]}`,
+		"wrong alg":     `{"keys": [{"kty": "oct", "alg": "RS256", "k": "c2VjcmV0"}]}`,
+		"off curve":     `{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+		"duplicate kid": `{"keys": [{"kty": "oct", "kid": "a", "k": "c2VjcmV0"}, {"kty": "oct", "kid": "a", "k": "c2VjcmV0"}]}`,
+		"missing kid":   `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}, {"kty": "oct", "kid": "a", "k": "c2VjcmV0"}]}`,
+	} {
+		_, err := parseJWKS([]byte(content))
+		assert.NotNil(t, err, name)
+	}
+
+	keys, err := parseJWKS([]byte(`{"keys": [{"kty": "oct", "k": "` + encode(testSecret) + `"}]}`))
+	assert.Nil(t, err)
+	assert.EqualValues(t, hmacMethods, keys.methods())
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// The permissions guarding the message operations.
+const (
+	PermReadMessages   = "messages:read"
+	PermCreateMessages = "messages:create"
+	PermUpdateMessages = "messages:update"
+	// PermDeleteMessages covers restoring the deleted messages too.
+	PermDeleteMessages = "messages:delete"
+	PermPurgeMessages  = "messages:purge"
+	// PermManageTags covers renaming and merging the tags of every message.
+	PermManageTags = "tags:manage"
+)
+
+// Permissions lists every permission a policy can grant, more can be
+// appended at startup, before a policy is built.
+var Permissions = []string{
+	PermReadMessages,
+	PermCreateMessages,
+	PermUpdateMessages,
+	PermDeleteMessages,
+	PermPurgeMessages,
+	PermManageTags,
+}
+
+// The subjects of the bindings applying to every caller of a kind rather
+// than to one principal.
+const (
+	SubjectAuthenticated = "@authenticated"
+	SubjectAnonymous     = "@anonymous"
+)
+
+// RoleMember is the role the default policy gives to every caller.
+const RoleMember = "member"
+
+// CodePermissionDenied identifies the errors of the callers lacking a permission.
+const CodePermissionDenied = "permission_denied"
+
+// Policy grants permissions to roles, and roles to principals through role
+// bindings on top of the roles the principal already has. Permissions may
+// end with "*" to grant every permission they prefix. RoleAdmin always has
+// every permission. A Policy is immutable once built.
+type Policy struct {
+	roles    map[string][]string
+	bindings map[string][]string
+}
+
+// PolicyDocument is the JSON form of a Policy. Roles maps the roles to their
+// permissions, Bindings the principals, SubjectAuthenticated and
+// SubjectAnonymous to their roles.
+type PolicyDocument struct {
+	Roles    map[string][]string `json:"roles"`
+	Bindings map[string][]string `json:"bindings"`
+}
+
+// NewPolicy checks doc and builds its Policy. Unknown permissions are refused
+// to catch typos. A role bound but never defined grants nothing, RoleAdmin aside.
+func NewPolicy(doc PolicyDocument) (*Policy, error) {
+	p := &Policy{roles: make(map[string][]string), bindings: make(map[string][]string)}
+	for role, permissions := range doc.Roles {
+		for _, permission := range permissions {
+			if !knownPermission(permission) {
+				return nil, fmt.Errorf("role %q: unknown permission %q", role, permission)
+			}
+		}
+		p.roles[role] = append([]string(nil), permissions...)
+	}
+	for subject, roles := range doc.Bindings {
+		p.bindings[subject] = append([]string(nil), roles...)
+	}
+	return p, nil
+}
+
+// DefaultPolicy grants every message permission but purging to every caller,
+// along with managing the tags, the ownership of messages still restricting
+// who changes them.
+func DefaultPolicy() *Policy {
+	p, _ := NewPolicy(PolicyDocument{
+		Roles: map[string][]string{
+			RoleMember: {PermReadMessages, PermCreateMessages, PermUpdateMessages, PermDeleteMessages, PermManageTags},
+		},
+		Bindings: map[string][]string{
+			SubjectAuthenticated: {RoleMember},
+			SubjectAnonymous:     {RoleMember},
+		},
+	})
+	return p
+}
+
+// LoadPolicyFile reads the JSON PolicyDocument at path.
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc PolicyDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing the policy: %v", err)
+	}
+	return NewPolicy(doc)
+}
+
+func knownPermission(permission string) bool {
+	for _, known := range Permissions {
+		if matches(permission, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches tells whether the granted permission, a wildcard maybe, covers permission.
+func matches(granted, permission string) bool {
+	if strings.HasSuffix(granted, "*") {
+		return strings.HasPrefix(permission, strings.TrimSuffix(granted, "*"))
+	}
+	return granted == permission
+}
+
+// Roles returns the effective roles of principal, nil standing for the
+// anonymous callers.
+func (p *Policy) Roles(principal *Principal) []string {
+	var roles []string
+	add := func(more []string) {
+		for _, role := range more {
+			if !contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	if principal == nil {
+		add(p.bindings[SubjectAnonymous])
+	} else {
+		add(principal.Roles)
+		add(p.bindings[principal.ID])
+		add(p.bindings[SubjectAuthenticated])
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Allows tells whether principal, nil for the anonymous callers, was granted permission.
+func (p *Policy) Allows(principal *Principal, permission string) bool {
+	for _, role := range p.Roles(principal) {
+		if role == RoleAdmin {
+			return true
+		}
+		for _, granted := range p.roles[role] {
+			if matches(granted, permission) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions of Permissions granted to principal.
+func (p *Policy) Permissions(principal *Principal) []string {
+	permissions := []string{}
+	for _, permission := range Permissions {
+		if p.Allows(principal, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// Authorize checks that the caller of ctx was granted permission. Anonymous
+// callers are asked to authenticate, the others are forbidden.
+func (p *Policy) Authorize(ctx context.Context, permission string) errorutils.MessageErr {
+	principal, _ := PrincipalFrom(ctx)
+	if p.Allows(principal, permission) {
+		return nil
+	}
+	if principal == nil {
+		return NewMissingCredentialsError()
+	}
+	return errorutils.WithCode(errorutils.NewForbiddenError(fmt.Sprintf("permission %s is required", permission)), CodePermissionDenied)
+}
+
+// Grants are the effective roles and permissions of a caller.
+type Grants struct {
+	// Principal is empty for the anonymous callers.
+	Principal   string   `json:"principal,omitempty"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	// Tenant is the tenant the caller acts for, empty for the default one.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Grants returns the effective roles and permissions of the caller of ctx.
+func (p *Policy) Grants(ctx context.Context) *Grants {
+	principal, _ := PrincipalFrom(ctx)
+	grants := &Grants{Roles: p.Roles(principal), Permissions: p.Permissions(principal), Tenant: domain.TenantFrom(ctx)}
+	if grants.Roles == nil {
+		grants.Roles = []string{}
+	}
+	if principal != nil {
+		grants.Principal = principal.ID
+	}
+	return grants
+}
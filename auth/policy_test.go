@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPolicy(t *testing.T) *Policy {
+	p, err := NewPolicy(PolicyDocument{
+		Roles: map[string][]string{
+			"reader": {PermReadMessages},
+			"editor": {"messages:*"},
+		},
+		Bindings: map[string][]string{
+			"bob":                {"editor"},
+			SubjectAuthenticated: {"reader"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("an error %v was not expected when building the policy", err)
+	}
+	return p
+}
+
+func TestNewPolicy_UnknownPermission(t *testing.T) {
+	for _, permission := range []string{"messages:publish", "users:*", ""} {
+		_, err := NewPolicy(PolicyDocument{Roles: map[string][]string{"r": {permission}}})
+		assert.NotNil(t, err, permission)
+	}
+	_, err := NewPolicy(PolicyDocument{Roles: map[string][]string{"r": {"*"}}})
+	assert.Nil(t, err)
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	p := newTestPolicy(t)
+	alice := &Principal{ID: "alice"}
+	bob := &Principal{ID: "bob"}
+	admin := &Principal{ID: "carol", Roles: []string{RoleAdmin}}
+
+	assert.False(t, p.Allows(nil, PermReadMessages))
+	assert.True(t, p.Allows(alice, PermReadMessages))
+	assert.False(t, p.Allows(alice, PermCreateMessages))
+	assert.True(t, p.Allows(bob, PermPurgeMessages))
+	assert.True(t, p.Allows(&Principal{ID: "dave", Roles: []string{"editor"}}, PermDeleteMessages))
+	assert.True(t, p.Allows(admin, PermPurgeMessages))
+
+	assert.EqualValues(t, []string{"editor", "reader"}, p.Roles(bob))
+	assert.EqualValues(t, []string{PermReadMessages}, p.Permissions(alice))
+	assert.EqualValues(t, Permissions, p.Permissions(admin))
+	assert.EqualValues(t, []string{}, p.Permissions(nil))
+}
+
+func TestPolicy_Authorize(t *testing.T) {
+	p := newTestPolicy(t)
+
+	err := p.Authorize(context.Background(), PermReadMessages)
+	assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+	assert.EqualValues(t, CodeMissingCredentials, err.Code())
+
+	ctx := WithPrincipal(context.Background(), &Principal{ID: "alice"})
+	assert.Nil(t, p.Authorize(ctx, PermReadMessages))
+	err = p.Authorize(ctx, PermCreateMessages)
+	assert.EqualValues(t, http.StatusForbidden, err.Status())
+	assert.EqualValues(t, CodePermissionDenied, err.Code())
+}
+
+func TestPolicy_Grants(t *testing.T) {
+	p := newTestPolicy(t)
+	assert.EqualValues(t, &Grants{Roles: []string{}, Permissions: []string{}}, p.Grants(context.Background()))
+
+	ctx := WithPrincipal(context.Background(), &Principal{ID: "alice", Roles: []string{"auditor"}})
+	assert.EqualValues(t, &Grants{Principal: "alice", Roles: []string{"auditor", "reader"}, Permissions: []string{PermReadMessages}}, p.Grants(ctx))
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	p := DefaultPolicy()
+	for _, principal := range []*Principal{nil, {ID: "alice"}} {
+		assert.True(t, p.Allows(principal, PermCreateMessages))
+		assert.True(t, p.Allows(principal, PermDeleteMessages))
+		assert.True(t, p.Allows(principal, PermManageTags))
+		assert.False(t, p.Allows(principal, PermPurgeMessages))
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatalf("an error %v was not expected when creating a temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.json")
+	ioutil.WriteFile(path, []byte(`{"roles": {"reader": ["messages:read"]}, "bindings": {"@anonymous": ["reader"]}}`), 0600)
+
+	p, err := LoadPolicyFile(path)
+	assert.Nil(t, err)
+	assert.True(t, p.Allows(nil, PermReadMessages))
+	assert.False(t, p.Allows(&Principal{ID: "alice"}, PermReadMessages))
+
+	ioutil.WriteFile(path, []byte(`{"roles": []}`), 0600)
+	_, err = LoadPolicyFile(path)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,37 @@
+package auth
+
+import "context"
+
+// RoleAdmin may change every message, whoever wrote it.
+const RoleAdmin = "admin"
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	ID    string
+	Roles []string
+	// TenantID binds the principal to a tenant, see Tenant.
+	TenantID string
+}
+
+// HasRole tells whether p was granted role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal of ctx, false for anonymous calls.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
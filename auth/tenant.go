@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// TenantHeader is the header naming the tenant a request acts for.
+const TenantHeader = "X-Tenant-ID"
+
+// The codes of the errors of the tenants asked for.
+const (
+	CodeInvalidTenant  = "invalid_tenant"
+	CodeTenantMismatch = "tenant_mismatch"
+)
+
+// Tenant returns the tenant principal acts for when requested, empty when
+// unsaid, was asked for. A principal bound to a tenant stays in it, the
+// admins bound to none choose theirs, and the other principals remain in
+// domain.DefaultTenant. Anonymous callers, only let in when authentication
+// is off, get the tenant they ask for.
+func Tenant(principal *Principal, requested string) (string, errorutils.MessageErr) {
+	if requested != "" && !domain.ValidTenant(requested) {
+		return "", errorutils.WithCode(errorutils.NewBadRequestError(fmt.Sprintf("invalid tenant %q", requested)), CodeInvalidTenant)
+	}
+	switch {
+	case principal == nil:
+		return requested, nil
+	case principal.TenantID != "":
+		if requested != "" && requested != principal.TenantID {
+			return "", newTenantMismatchError(requested)
+		}
+		return principal.TenantID, nil
+	case principal.HasRole(RoleAdmin):
+		return requested, nil
+	case requested != "":
+		return "", newTenantMismatchError(requested)
+	}
+	return domain.DefaultTenant, nil
+}
+
+func newTenantMismatchError(tenant string) errorutils.MessageErr {
+	return errorutils.WithCode(errorutils.NewForbiddenError(fmt.Sprintf("you can't act for the tenant %q", tenant)), CodeTenantMismatch)
+}
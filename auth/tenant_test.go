@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenant(t *testing.T) {
+	bound := &Principal{ID: "alice", TenantID: "acme"}
+	unbound := &Principal{ID: "bob"}
+	admin := &Principal{ID: "carol", Roles: []string{RoleAdmin}}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		requested string
+		want      string
+		code      string
+	}{
+		{name: "anonymous", requested: "acme", want: "acme"},
+		{name: "anonymous default", want: domain.DefaultTenant},
+		{name: "bound", principal: bound, want: "acme"},
+		{name: "bound asking for its tenant", principal: bound, requested: "acme", want: "acme"},
+		{name: "bound asking for another", principal: bound, requested: "globex", code: CodeTenantMismatch},
+		{name: "unbound", principal: unbound, want: domain.DefaultTenant},
+		{name: "unbound asking for one", principal: unbound, requested: "acme", code: CodeTenantMismatch},
+		{name: "admin", principal: admin, requested: "globex", want: "globex"},
+		{name: "malformed", principal: admin, requested: "acme corp", code: CodeInvalidTenant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Tenant(tt.principal, tt.requested)
+			if tt.code != "" {
+				if assert.NotNil(t, err) {
+					assert.EqualValues(t, tt.code, err.Code())
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.EqualValues(t, tt.want, got)
+		})
+	}
+
+	_, err := Tenant(bound, "globex")
+	assert.EqualValues(t, http.StatusForbidden, err.Status())
+	_, err = Tenant(nil, "a/b")
+	assert.EqualValues(t, http.StatusBadRequest, err.Status())
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/silvergama/efficientAPI/config"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// The codes of the authentication errors.
+const (
+	CodeMissingCredentials = "missing_credentials"
+	CodeInvalidAPIKey      = "invalid_api_key"
+	CodeInvalidToken       = "invalid_token"
+)
+
+// Verifier authenticates the requests carrying one kind of credentials.
+type Verifier interface {
+	// Verify returns the principal the credentials of r belong to, an error
+	// when they are invalid, and nil, nil when r carries none of its kind.
+	Verify(r *http.Request) (*Principal, errorutils.MessageErr)
+	// Challenge is the WWW-Authenticate value telling clients how to
+	// authenticate with the verifier.
+	Challenge() string
+}
+
+// NewMissingCredentialsError is returned for the requests no verifier recognized credentials in.
+func NewMissingCredentialsError() errorutils.MessageErr {
+	return errorutils.WithCode(errorutils.NewUnauthorizedError("authentication required"), CodeMissingCredentials)
+}
+
+// NewVerifiers returns the verifiers cfg turns on, none when authentication is off.
+func NewVerifiers(cfg config.AuthConfig) ([]Verifier, error) {
+	var verifiers []Verifier
+	opts := JWTOptions{Issuer: cfg.JWTIssuer, Audience: cfg.JWTAudience}
+	switch {
+	case cfg.JWTSecret != "":
+		verifiers = append(verifiers, NewHMACVerifier([]byte(cfg.JWTSecret), opts))
+	case cfg.JWKSFile != "":
+		v, err := NewJWKSVerifier(cfg.JWKSFile, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the jwks file: %v", err)
+		}
+		verifiers = append(verifiers, v)
+	}
+	if cfg.APIKeys {
+		verifiers = append(verifiers, APIKeyVerifier{})
+	}
+	return verifiers, nil
+}
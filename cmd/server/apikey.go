@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/config"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+)
+
+const apiKeyUsage = `usage: server apikey [flags] create|list|rotate|revoke [key id]
+
+  create  store a key for -principal with -roles, in -tenant, and print it
+  list    list the keys, revoked ones included
+  rotate  give the key a new secret and print it
+  revoke  refuse the key from now on
+`
+
+// runAPIKey implements the "apikey" subcommand, which manages the keys
+// straight in the database, the first admin key included.
+func runAPIKey(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("apikey", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), apiKeyUsage)
+		fs.PrintDefaults()
+	}
+	name := fs.String("name", "", "name of the key created")
+	principal := fs.String("principal", "", "principal the key created authenticates as")
+	roles := fs.String("roles", "", "comma separated roles of the key created")
+	tenant := fs.String("tenant", "", "tenant the key created is bound to, none when empty")
+
+	cfg, err := config.LoadWithFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("apikey needs a command")
+	}
+
+	db, err := initializeRepository(cfg)
+	if err != nil {
+		return err
+	}
+	if db == nil {
+		return fmt.Errorf("the %s driver keeps no api keys between runs", cfg.DB.Driver)
+	}
+	defer db.Close()
+
+	// the command line is trusted as an admin
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "cli", Roles: []string{auth.RoleAdmin}})
+	keyID := func() (string, error) {
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return "", fmt.Errorf("%s needs a key id", fs.Arg(0))
+		}
+		return fs.Arg(1), nil
+	}
+
+	switch fs.Arg(0) {
+	case "create":
+		key := domain.APIKey{Name: *name, PrincipalID: *principal, Roles: splitList(*roles), TenantID: *tenant}
+		issued, err := services.APIKeysService.CreateAPIKey(ctx, key)
+		if err != nil {
+			return fmt.Errorf("error creating the api key: %s", err.Message())
+		}
+		fmt.Fprintln(out, issued.Key)
+		return nil
+	case "list":
+		keys, err := services.APIKeysService.ListAPIKeys(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing the api keys: %s", err.Message())
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPRINCIPAL\tROLES\tTENANT\tCREATED AT\tREVOKED AT")
+		for _, k := range keys {
+			revokedAt := "-"
+			if k.RevokedAt != nil {
+				revokedAt = k.RevokedAt.Format(time.RFC3339)
+			}
+			tenant := k.TenantID
+			if tenant == "" {
+				tenant = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.PrincipalID, strings.Join(k.Roles, ","), tenant, k.CreatedAt.Format(time.RFC3339), revokedAt)
+		}
+		return w.Flush()
+	case "rotate":
+		id, err := keyID()
+		if err != nil {
+			return err
+		}
+		issued, rotateErr := services.APIKeysService.RotateAPIKey(ctx, id)
+		if rotateErr != nil {
+			return fmt.Errorf("error rotating the api key: %s", rotateErr.Message())
+		}
+		fmt.Fprintln(out, issued.Key)
+		return nil
+	case "revoke":
+		id, err := keyID()
+		if err != nil {
+			return err
+		}
+		if revokeErr := services.APIKeysService.RevokeAPIKey(ctx, id); revokeErr != nil {
+			return fmt.Errorf("error revoking the api key: %s", revokeErr.Message())
+		}
+		fmt.Fprintf(out, "revoked %s\n", id)
+		return nil
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown apikey command %q", fs.Arg(0))
+}
+
+// splitList splits a comma separated flag, dropping the empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/silvergama/efficientAPI/app"
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/config"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/migrations"
+	"github.com/silvergama/efficientAPI/services"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := runAPIKey(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	verifiers, err := auth.NewVerifiers(cfg.Auth)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	db, err := initializeRepository(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if db != nil {
+		defer db.Close()
+		if cfg.AutoMigrate {
+			migrator, err := migrations.New(db, cfg.DB.Driver)
+			if err != nil {
+				log.Fatalf("error loading the migrations: %v", err)
+			}
+			applied, err := migrator.Up(context.Background())
+			if err != nil {
+				log.Fatalf("error migrating the database: %v", err)
+			}
+			log.Printf("applied %d migrations", applied)
+		}
+	}
+
+	policy, err := loadPolicy(cfg.RBAC, db)
+	if err != nil {
+		log.Fatalf("error loading the access control policy: %v", err)
+	}
+	services.MessagesService = services.NewAuthorizedMessagesService(services.MessagesService, policy)
+	services.PermissionsService = services.NewPermissionsService(policy)
+
+	var cache *domain.CachedMessageRepository
+	if cfg.CacheTTL > 0 {
+		cache = domain.NewCachedMessageRepository(domain.MessageRepo, domain.NewLRUCacheStore(cfg.CacheSize), cfg.CacheTTL)
+		domain.MessageRepo = cache
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if cfg.PurgeRetention > 0 {
+		go services.RunPurger(ctx, cfg.PurgeRetention, cfg.PurgeInterval)
+	}
+
+	srv := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: app.NewRouter(verifiers...),
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("error starting the server: %v", err)
+		}
+	}()
+	log.Printf("listening on %s", cfg.Addr)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("shutting down the server...")
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server forced to shutdown: %v", err)
+	}
+	if cache != nil {
+		stats := cache.Stats()
+		log.Printf("message cache: %d hits, %d misses, %d shared loads, %d store errors", stats.Hits, stats.Misses, stats.Shared, stats.Errors)
+	}
+	log.Println("server exited")
+}
+
+// initializeRepository points domain.MessageRepo and domain.APIKeyRepo at
+// the backend selected by cfg and returns its database, nil for the
+// in-memory one.
+func initializeRepository(cfg *config.Config) (*sql.DB, error) {
+	repo, db, err := domain.OpenMessageRepository(context.Background(), cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	domain.MessageRepo = repo
+	domain.APIKeyRepo = domain.NewAPIKeyRepository(db, cfg.DB.Driver)
+	return db, nil
+}
+
+// loadPolicy returns the access control policy cfg points at, the default
+// one when it points nowhere.
+func loadPolicy(cfg config.RBACConfig, db *sql.DB) (*auth.Policy, error) {
+	switch {
+	case cfg.PolicyFile != "":
+		return auth.LoadPolicyFile(cfg.PolicyFile)
+	case cfg.PolicyTables:
+		roles, bindings, err := domain.LoadRBACTables(context.Background(), db)
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewPolicy(auth.PolicyDocument{Roles: roles, Bindings: bindings})
+	}
+	return auth.DefaultPolicy(), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/silvergama/efficientAPI/config"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/migrations"
+)
+
+const migrateUsage = `usage: server migrate [flags] up|down|status
+
+  up      apply every pending migration
+  down    revert the last -steps applied migrations
+  status  list the migrations and whether they are applied
+`
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	dryRun := fs.Bool("dry-run", false, "print the statements instead of running them")
+	steps := fs.Int("steps", 1, "number of migrations reverted by down")
+
+	cfg, err := config.LoadWithFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("migrate needs exactly one command")
+	}
+
+	// the repository isn't built, opening it could change the schema already
+	db, err := domain.OpenDatabase(context.Background(), cfg.DB)
+	if err != nil {
+		return err
+	}
+	if db == nil {
+		return fmt.Errorf("the %s driver has no schema to migrate", cfg.DB.Driver)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db, cfg.DB.Driver)
+	if err != nil {
+		return err
+	}
+	migrator.DryRun = *dryRun
+	migrator.Out = out
+
+	ctx := context.Background()
+	switch fs.Arg(0) {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		fmt.Fprintf(out, "applied %d migrations\n", applied)
+		return err
+	case "down":
+		reverted, err := migrator.Down(ctx, *steps)
+		fmt.Fprintf(out, "reverted %d migrations\n", reverted)
+		return err
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown migrate command %q", fs.Arg(0))
+}
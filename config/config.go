@@ -0,0 +1,420 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	// MemoryDriver selects the in-memory message repository, which needs no database.
+	MemoryDriver = "memory"
+	// SQLiteDriver selects the SQLite repository, DATABASE being the path of the file.
+	SQLiteDriver = "sqlite3"
+	// PostgresDriver selects the PostgreSQL repository.
+	PostgresDriver = "postgres"
+)
+
+const (
+	// TLSDisable turns TLS off.
+	TLSDisable = "disable"
+	// TLSRequire encrypts the connection without checking the certificate of the server.
+	TLSRequire = "require"
+	// TLSVerifyFull encrypts the connection to a server whose certificate
+	// is signed by TLS.CAFile, or a system CA, for the host name.
+	TLSVerifyFull = "verify-full"
+)
+
+const (
+	defaultEnvFile         = ".env"
+	defaultAddr            = ":8080"
+	defaultShutdownTimeout = 15 * time.Second
+	defaultPurgeInterval   = time.Hour
+	defaultCacheSize       = 10000
+	defaultMaxIdleConns    = 2
+	defaultConnectTimeout  = 5 * time.Second
+	defaultPingAttempts    = 5
+	defaultPingBackoff     = 500 * time.Millisecond
+)
+
+// DBConfig holds everything needed to open the messages database.
+type DBConfig struct {
+	Driver   string
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Name     string
+
+	// The pool settings of database/sql, zero being its defaults. SQLite
+	// always runs on a single connection.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectTimeout bounds the dial and every startup ping, the read and
+	// write timeouts apply to MySQL only. Zero means no timeout.
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+
+	// The database is pinged up to PingAttempts times on start, waiting
+	// PingBackoff after the first failure and twice as long after each other.
+	PingAttempts int
+	PingBackoff  time.Duration
+
+	TLS TLSConfig
+}
+
+// TLSConfig secures the connection to the database server.
+type TLSConfig struct {
+	// Mode is TLSDisable, TLSRequire, TLSVerifyFull or empty for the default of the driver.
+	Mode string
+	// CAFile is a PEM bundle of the CAs to trust instead of the system ones.
+	CAFile string
+	// CertFile and KeyFile are a client certificate, for servers asking for one.
+	CertFile string
+	KeyFile  string
+	// ServerName is checked against the certificate instead of the host, on MySQL.
+	ServerName string
+}
+
+// AuthConfig selects how requests are authenticated. Authentication is off
+// unless at least one verifier is on.
+type AuthConfig struct {
+	// APIKeys accepts the api keys stored in the database.
+	APIKeys bool
+	// JWTSecret is the HMAC secret of the bearer tokens, JWKSFile a JWKS file
+	// of their keys, one at most being set.
+	JWTSecret string
+	JWKSFile  string
+	// JWTIssuer and JWTAudience are required in the tokens when set.
+	JWTIssuer   string
+	JWTAudience string
+}
+
+// Enabled tells whether requests must be authenticated.
+func (c *AuthConfig) Enabled() bool {
+	return c.APIKeys || c.JWTSecret != "" || c.JWKSFile != ""
+}
+
+// RBACConfig selects where the access control policy comes from, the
+// built-in one granting every caller what the API allowed before roles.
+type RBACConfig struct {
+	// PolicyFile is a JSON policy document.
+	PolicyFile string
+	// PolicyTables reads the policy from the rbac tables of the database.
+	PolicyTables bool
+}
+
+// Config is the runtime configuration of the API server.
+type Config struct {
+	Addr            string
+	ShutdownTimeout time.Duration
+	// AutoMigrate applies the pending schema migrations on start.
+	AutoMigrate bool
+	// PurgeRetention is how long deleted messages can still be restored
+	// before being purged every PurgeInterval. Zero keeps them forever.
+	PurgeRetention time.Duration
+	PurgeInterval  time.Duration
+	// CacheTTL is how long a message is cached after being read, up to
+	// CacheSize messages. Zero turns the cache off.
+	CacheTTL  time.Duration
+	CacheSize int
+	DB        DBConfig
+	Auth      AuthConfig
+	RBAC      RBACConfig
+}
+
+// Load builds a Config from, in increasing order of precedence, the .env
+// file, the process environment and the command line flags in args.
+// A missing .env file is not an error.
+func Load(args []string) (*Config, error) {
+	return LoadWithFlags(flag.NewFlagSet("server", flag.ContinueOnError), args)
+}
+
+// LoadWithFlags is like Load but parses args with fs, letting the caller
+// register flags of its own next to the configuration ones.
+func LoadWithFlags(fs *flag.FlagSet, args []string) (*Config, error) {
+	envFile := envFileFromArgs(args)
+	if err := godotenv.Load(envFile); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error loading env file %s: %v", envFile, err)
+	}
+
+	shutdownTimeout, err := getEnvDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+	if err != nil {
+		return nil, err
+	}
+	autoMigrate, err := getEnvBool("AUTO_MIGRATE", false)
+	if err != nil {
+		return nil, err
+	}
+	purgeRetention, err := getEnvDuration("PURGE_RETENTION", 0)
+	if err != nil {
+		return nil, err
+	}
+	purgeInterval, err := getEnvDuration("PURGE_INTERVAL", defaultPurgeInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheTTL, err := getEnvDuration("CACHE_TTL", 0)
+	if err != nil {
+		return nil, err
+	}
+	cacheSize, err := getEnvInt("CACHE_SIZE", defaultCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	maxOpenConns, err := getEnvInt("DB_MAX_OPEN_CONNS", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxIdleConns, err := getEnvInt("DB_MAX_IDLE_CONNS", defaultMaxIdleConns)
+	if err != nil {
+		return nil, err
+	}
+	connMaxLifetime, err := getEnvDuration("DB_CONN_MAX_LIFETIME", 0)
+	if err != nil {
+		return nil, err
+	}
+	connMaxIdleTime, err := getEnvDuration("DB_CONN_MAX_IDLE_TIME", 0)
+	if err != nil {
+		return nil, err
+	}
+	connectTimeout, err := getEnvDuration("DB_CONNECT_TIMEOUT", defaultConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	readTimeout, err := getEnvDuration("DB_READ_TIMEOUT", 0)
+	if err != nil {
+		return nil, err
+	}
+	writeTimeout, err := getEnvDuration("DB_WRITE_TIMEOUT", 0)
+	if err != nil {
+		return nil, err
+	}
+	pingAttempts, err := getEnvInt("DB_PING_ATTEMPTS", defaultPingAttempts)
+	if err != nil {
+		return nil, err
+	}
+	pingBackoff, err := getEnvDuration("DB_PING_BACKOFF", defaultPingBackoff)
+	if err != nil {
+		return nil, err
+	}
+
+	authAPIKeys, err := getEnvBool("AUTH_API_KEYS", false)
+	if err != nil {
+		return nil, err
+	}
+	rbacPolicyTables, err := getEnvBool("RBAC_POLICY_TABLES", false)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	fs.String("env-file", defaultEnvFile, "path of the .env file to load")
+	fs.StringVar(&cfg.Addr, "addr", getEnv("ADDR", defaultAddr), "address the HTTP server listens on")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", shutdownTimeout, "time allowed for in-flight requests to finish on shutdown")
+	fs.BoolVar(&cfg.AutoMigrate, "auto-migrate", autoMigrate, "apply the pending schema migrations on start")
+	fs.DurationVar(&cfg.PurgeRetention, "purge-retention", purgeRetention, "how long deleted messages are kept before being purged, 0 keeps them forever")
+	fs.DurationVar(&cfg.PurgeInterval, "purge-interval", purgeInterval, "how often deleted messages are purged")
+	fs.DurationVar(&cfg.CacheTTL, "cache-ttl", cacheTTL, "how long a message is cached after being read, 0 disables the cache")
+	fs.IntVar(&cfg.CacheSize, "cache-size", cacheSize, "how many messages the cache holds at most")
+	fs.StringVar(&cfg.DB.Driver, "db-driver", getEnv("DBDRIVE", "mysql"), "database driver")
+	fs.StringVar(&cfg.DB.User, "db-user", getEnv("USERNAME", ""), "database user")
+	fs.StringVar(&cfg.DB.Password, "db-password", getEnv("PASSWORD", ""), "database password")
+	fs.StringVar(&cfg.DB.Host, "db-host", getEnv("HOST", ""), "database host")
+	fs.StringVar(&cfg.DB.Port, "db-port", getEnv("PORT", ""), "database port")
+	fs.StringVar(&cfg.DB.Name, "db-name", getEnv("DATABASE", ""), "database name")
+	fs.IntVar(&cfg.DB.MaxOpenConns, "db-max-open-conns", maxOpenConns, "most open connections to the database, 0 for no limit")
+	fs.IntVar(&cfg.DB.MaxIdleConns, "db-max-idle-conns", maxIdleConns, "most idle connections kept in the pool")
+	fs.DurationVar(&cfg.DB.ConnMaxLifetime, "db-conn-max-lifetime", connMaxLifetime, "how long a connection is reused at most, 0 for ever")
+	fs.DurationVar(&cfg.DB.ConnMaxIdleTime, "db-conn-max-idle-time", connMaxIdleTime, "how long a connection stays idle at most, 0 for ever")
+	fs.DurationVar(&cfg.DB.ConnectTimeout, "db-connect-timeout", connectTimeout, "time allowed to connect to the database, 0 for no limit")
+	fs.DurationVar(&cfg.DB.ReadTimeout, "db-read-timeout", readTimeout, "time allowed to read a response of MySQL, 0 for no limit")
+	fs.DurationVar(&cfg.DB.WriteTimeout, "db-write-timeout", writeTimeout, "time allowed to write a request to MySQL, 0 for no limit")
+	fs.IntVar(&cfg.DB.PingAttempts, "db-ping-attempts", pingAttempts, "how many times the database is pinged on start before giving up")
+	fs.DurationVar(&cfg.DB.PingBackoff, "db-ping-backoff", pingBackoff, "wait after the first failed ping, doubled after each other")
+	fs.StringVar(&cfg.DB.TLS.Mode, "db-tls-mode", getEnv("DB_TLS_MODE", ""), "TLS to the database: disable, require or verify-full, empty for the driver default")
+	fs.StringVar(&cfg.DB.TLS.CAFile, "db-tls-ca", getEnv("DB_TLS_CA", ""), "PEM file of the CAs trusted for the database certificate")
+	fs.StringVar(&cfg.DB.TLS.CertFile, "db-tls-cert", getEnv("DB_TLS_CERT", ""), "PEM file of the client certificate")
+	fs.StringVar(&cfg.DB.TLS.KeyFile, "db-tls-key", getEnv("DB_TLS_KEY", ""), "PEM file of the client certificate key")
+	fs.StringVar(&cfg.DB.TLS.ServerName, "db-tls-server-name", getEnv("DB_TLS_SERVER_NAME", ""), "name expected in the MySQL certificate, the host by default")
+	fs.BoolVar(&cfg.Auth.APIKeys, "auth-api-keys", authAPIKeys, "authenticate requests with the api keys of the database")
+	fs.StringVar(&cfg.Auth.JWTSecret, "jwt-secret", getEnv("JWT_SECRET", ""), "HMAC secret of the bearer tokens")
+	fs.StringVar(&cfg.Auth.JWKSFile, "jwt-jwks-file", getEnv("JWT_JWKS_FILE", ""), "JWKS file of the keys of the bearer tokens")
+	fs.StringVar(&cfg.Auth.JWTIssuer, "jwt-issuer", getEnv("JWT_ISSUER", ""), "issuer required in the bearer tokens")
+	fs.StringVar(&cfg.Auth.JWTAudience, "jwt-audience", getEnv("JWT_AUDIENCE", ""), "audience required in the bearer tokens")
+	fs.StringVar(&cfg.RBAC.PolicyFile, "rbac-policy-file", getEnv("RBAC_POLICY_FILE", ""), "JSON file of the access control policy")
+	fs.BoolVar(&cfg.RBAC.PolicyTables, "rbac-policy-tables", rbacPolicyTables, "read the access control policy from the database")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every required value that is missing or invalid.
+func (c *Config) Validate() error {
+	var missing []string
+	if strings.TrimSpace(c.Addr) == "" {
+		missing = append(missing, "addr (ADDR)")
+	}
+	if strings.TrimSpace(c.DB.Driver) == "" {
+		missing = append(missing, "db driver (DBDRIVE)")
+	}
+	switch c.DB.Driver {
+	case MemoryDriver:
+	case SQLiteDriver:
+		if strings.TrimSpace(c.DB.Name) == "" {
+			missing = append(missing, "db name (DATABASE)")
+		}
+	default:
+		if strings.TrimSpace(c.DB.User) == "" {
+			missing = append(missing, "db user (USERNAME)")
+		}
+		if strings.TrimSpace(c.DB.Host) == "" {
+			missing = append(missing, "db host (HOST)")
+		}
+		if strings.TrimSpace(c.DB.Port) == "" {
+			missing = append(missing, "db port (PORT)")
+		}
+		if strings.TrimSpace(c.DB.Name) == "" {
+			missing = append(missing, "db name (DATABASE)")
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
+	}
+	if c.ShutdownTimeout <= 0 {
+		return errors.New("shutdown timeout must be positive")
+	}
+	if c.PurgeRetention < 0 {
+		return errors.New("purge retention can't be negative")
+	}
+	if c.PurgeRetention > 0 && c.PurgeInterval <= 0 {
+		return errors.New("purge interval must be positive")
+	}
+	if c.CacheTTL < 0 {
+		return errors.New("cache ttl can't be negative")
+	}
+	if c.CacheTTL > 0 && c.CacheSize <= 0 {
+		return errors.New("cache size must be positive")
+	}
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
+	if c.RBAC.PolicyFile != "" && c.RBAC.PolicyTables {
+		return errors.New("rbac policy file and tables can't be used together")
+	}
+	if c.RBAC.PolicyTables && c.DB.Driver == MemoryDriver {
+		return errors.New("rbac policy tables need a database")
+	}
+	return c.DB.validate()
+}
+
+func (c *AuthConfig) validate() error {
+	if c.JWTSecret != "" && c.JWKSFile != "" {
+		return errors.New("jwt secret and jwks file can't be used together")
+	}
+	if (c.JWTIssuer != "" || c.JWTAudience != "") && c.JWTSecret == "" && c.JWKSFile == "" {
+		return errors.New("jwt issuer and audience need a jwt secret or jwks file")
+	}
+	return nil
+}
+
+func (c *DBConfig) validate() error {
+	if c.MaxOpenConns < 0 || c.MaxIdleConns < 0 {
+		return errors.New("db connection limits can't be negative")
+	}
+	if c.ConnMaxLifetime < 0 || c.ConnMaxIdleTime < 0 || c.ConnectTimeout < 0 || c.ReadTimeout < 0 || c.WriteTimeout < 0 {
+		return errors.New("db durations can't be negative")
+	}
+	if c.PingAttempts < 1 {
+		return errors.New("db ping attempts must be at least 1")
+	}
+	if c.PingBackoff < 0 {
+		return errors.New("db ping backoff can't be negative")
+	}
+	switch c.TLS.Mode {
+	case "", TLSDisable, TLSRequire, TLSVerifyFull:
+	default:
+		return fmt.Errorf("unknown db tls mode %q", c.TLS.Mode)
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("db tls cert and key go together")
+	}
+	return nil
+}
+
+// envFileFromArgs looks for -env-file ahead of the real flag parsing, since
+// the .env file provides the defaults of every other flag.
+func envFileFromArgs(args []string) string {
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if strings.HasPrefix(name, "env-file=") {
+			return strings.TrimPrefix(name, "env-file=")
+		}
+		if name == "env-file" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return defaultEnvFile
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return b, nil
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return i, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return d, nil
+}
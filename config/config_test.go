@@ -0,0 +1,253 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var envKeys = []string{"ADDR", "SHUTDOWN_TIMEOUT", "AUTO_MIGRATE", "PURGE_RETENTION", "PURGE_INTERVAL", "CACHE_TTL", "CACHE_SIZE", "DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME", "DB_CONN_MAX_IDLE_TIME", "DB_CONNECT_TIMEOUT", "DB_READ_TIMEOUT", "DB_WRITE_TIMEOUT", "DB_PING_ATTEMPTS", "DB_PING_BACKOFF", "DB_TLS_MODE", "DB_TLS_CA", "DB_TLS_CERT", "DB_TLS_KEY", "DB_TLS_SERVER_NAME", "AUTH_API_KEYS", "JWT_SECRET", "JWT_JWKS_FILE", "JWT_ISSUER", "JWT_AUDIENCE", "RBAC_POLICY_FILE", "RBAC_POLICY_TABLES", "DBDRIVE", "USERNAME", "PASSWORD", "HOST", "PORT", "DATABASE"}
+
+// clearEnv unsets every variable read by Load and returns a func restoring them
+func clearEnv() func() {
+	saved := map[string]string{}
+	for _, key := range envKeys {
+		if value, ok := os.LookupEnv(key); ok {
+			saved[key] = value
+		}
+		os.Unsetenv(key)
+	}
+	return func() {
+		for _, key := range envKeys {
+			os.Unsetenv(key)
+		}
+		for key, value := range saved {
+			os.Setenv(key, value)
+		}
+	}
+}
+
+func writeEnvFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("an error %v was not expected when creating a temp dir", err)
+	}
+	path := filepath.Join(dir, ".env")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("an error %v was not expected when writing the env file", err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoad_FromEnvFile(t *testing.T) {
+	defer clearEnv()()
+	path, cleanup := writeEnvFile(t, "USERNAME=root\nPASSWORD=secret\nDATABASE=efficient\nPORT=3306\nHOST=127.0.0.1\nDBDRIVE=mysql\n")
+	defer cleanup()
+
+	cfg, err := Load([]string{"-env-file", path})
+	assert.Nil(t, err)
+	assert.EqualValues(t, ":8080", cfg.Addr)
+	assert.EqualValues(t, 15*time.Second, cfg.ShutdownTimeout)
+	assert.EqualValues(t, 0, cfg.PurgeRetention)
+	assert.EqualValues(t, time.Hour, cfg.PurgeInterval)
+	assert.EqualValues(t, DBConfig{
+		Driver:   "mysql",
+		User:     "root",
+		Password: "secret",
+		Host:     "127.0.0.1",
+		Port:     "3306",
+		Name:     "efficient",
+
+		MaxIdleConns:   defaultMaxIdleConns,
+		ConnectTimeout: defaultConnectTimeout,
+		PingAttempts:   defaultPingAttempts,
+		PingBackoff:    defaultPingBackoff,
+	}, cfg.DB)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	defer clearEnv()()
+	path, cleanup := writeEnvFile(t, "USERNAME=root\nDATABASE=efficient\nPORT=3306\nHOST=127.0.0.1\n")
+	defer cleanup()
+	os.Setenv("HOST", "db.internal")
+
+	cfg, err := Load([]string{"-env-file=" + path, "-db-name", "other", "-addr", ":9090"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "db.internal", cfg.DB.Host)
+	assert.EqualValues(t, "other", cfg.DB.Name)
+	assert.EqualValues(t, ":9090", cfg.Addr)
+}
+
+func TestLoad_MissingValues(t *testing.T) {
+	defer clearEnv()()
+
+	cfg, err := Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env")})
+	assert.Nil(t, cfg)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "missing required configuration: db user (USERNAME), db host (HOST), db port (PORT), db name (DATABASE)", err.Error())
+}
+
+func TestLoad_InvalidShutdownTimeout(t *testing.T) {
+	defer clearEnv()()
+	os.Setenv("SHUTDOWN_TIMEOUT", "soon")
+
+	cfg, err := Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env")})
+	assert.Nil(t, cfg)
+	assert.NotNil(t, err)
+}
+
+func TestLoad_MemoryDriver(t *testing.T) {
+	defer clearEnv()()
+
+	cfg, err := Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", MemoryDriver})
+	assert.Nil(t, err)
+	assert.EqualValues(t, MemoryDriver, cfg.DB.Driver)
+}
+
+func TestLoad_SQLiteDriver(t *testing.T) {
+	defer clearEnv()()
+
+	cfg, err := Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", SQLiteDriver, "-db-name", "efficient.db"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, SQLiteDriver, cfg.DB.Driver)
+	assert.EqualValues(t, "efficient.db", cfg.DB.Name)
+
+	cfg, err = Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", SQLiteDriver})
+	assert.Nil(t, cfg)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "missing required configuration: db name (DATABASE)", err.Error())
+}
+
+func TestLoadWithFlags(t *testing.T) {
+	defer clearEnv()()
+	os.Setenv("AUTO_MIGRATE", "true")
+
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "")
+	cfg, err := LoadWithFlags(fs, []string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", MemoryDriver, "-dry-run", "up"})
+	assert.Nil(t, err)
+	assert.True(t, cfg.AutoMigrate)
+	assert.True(t, *dryRun)
+	assert.EqualValues(t, []string{"up"}, fs.Args())
+}
+
+func TestLoad_Purge(t *testing.T) {
+	defer clearEnv()()
+	os.Setenv("PURGE_RETENTION", "720h")
+
+	cfg, err := Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", MemoryDriver, "-purge-interval", "10m"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 720*time.Hour, cfg.PurgeRetention)
+	assert.EqualValues(t, 10*time.Minute, cfg.PurgeInterval)
+
+	cfg, err = Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", MemoryDriver, "-purge-interval", "0s"})
+	assert.Nil(t, cfg)
+	assert.NotNil(t, err)
+}
+
+func TestLoad_Cache(t *testing.T) {
+	defer clearEnv()()
+	os.Setenv("CACHE_TTL", "1m")
+
+	cfg, err := Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", MemoryDriver})
+	assert.Nil(t, err)
+	assert.EqualValues(t, time.Minute, cfg.CacheTTL)
+	assert.EqualValues(t, defaultCacheSize, cfg.CacheSize)
+
+	cfg, err = Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", MemoryDriver, "-cache-size", "0"})
+	assert.Nil(t, cfg)
+	assert.NotNil(t, err)
+
+	os.Setenv("CACHE_SIZE", "many")
+	cfg, err = Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", MemoryDriver})
+	assert.Nil(t, cfg)
+	assert.NotNil(t, err)
+}
+
+func TestLoad_DBPool(t *testing.T) {
+	defer clearEnv()()
+	os.Setenv("DB_MAX_OPEN_CONNS", "20")
+	os.Setenv("DB_CONN_MAX_LIFETIME", "5m")
+	os.Setenv("DB_TLS_MODE", TLSVerifyFull)
+	os.Setenv("DB_TLS_CA", "/etc/ssl/db-ca.pem")
+
+	cfg, err := Load([]string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", MemoryDriver, "-db-max-idle-conns", "10", "-db-ping-attempts", "3"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 20, cfg.DB.MaxOpenConns)
+	assert.EqualValues(t, 10, cfg.DB.MaxIdleConns)
+	assert.EqualValues(t, 5*time.Minute, cfg.DB.ConnMaxLifetime)
+	assert.EqualValues(t, 0, cfg.DB.ConnMaxIdleTime)
+	assert.EqualValues(t, defaultConnectTimeout, cfg.DB.ConnectTimeout)
+	assert.EqualValues(t, 3, cfg.DB.PingAttempts)
+	assert.EqualValues(t, defaultPingBackoff, cfg.DB.PingBackoff)
+	assert.EqualValues(t, TLSConfig{Mode: TLSVerifyFull, CAFile: "/etc/ssl/db-ca.pem"}, cfg.DB.TLS)
+}
+
+func TestLoad_InvalidDBPool(t *testing.T) {
+	defer clearEnv()()
+	noEnvFile := []string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", MemoryDriver}
+
+	for _, args := range [][]string{
+		{"-db-max-open-conns", "-1"},
+		{"-db-conn-max-lifetime", "-1s"},
+		{"-db-ping-attempts", "0"},
+		{"-db-tls-mode", "sometimes"},
+		{"-db-tls-cert", "client.pem"},
+	} {
+		cfg, err := Load(append(noEnvFile, args...))
+		assert.Nil(t, cfg, "%v", args)
+		assert.NotNil(t, err, "%v", args)
+	}
+}
+
+func TestLoad_Auth(t *testing.T) {
+	defer clearEnv()()
+	noEnvFile := []string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env"), "-db-driver", MemoryDriver}
+
+	cfg, err := Load(noEnvFile)
+	assert.Nil(t, err)
+	assert.False(t, cfg.Auth.Enabled())
+
+	os.Setenv("AUTH_API_KEYS", "true")
+	os.Setenv("JWT_SECRET", "s3cret")
+	cfg, err = Load(append(noEnvFile, "-jwt-issuer", "https://issuer.example"))
+	assert.Nil(t, err)
+	assert.True(t, cfg.Auth.Enabled())
+	assert.EqualValues(t, AuthConfig{APIKeys: true, JWTSecret: "s3cret", JWTIssuer: "https://issuer.example"}, cfg.Auth)
+
+	for _, args := range [][]string{
+		{"-jwt-jwks-file", "keys.json"},
+		{"-jwt-secret", "", "-jwt-audience", "messages"},
+	} {
+		cfg, err := Load(append(noEnvFile, args...))
+		assert.Nil(t, cfg, "%v", args)
+		assert.NotNil(t, err, "%v", args)
+	}
+}
+
+func TestLoad_RBAC(t *testing.T) {
+	defer clearEnv()()
+	noEnvFile := []string{"-env-file", filepath.Join(os.TempDir(), "does-not-exist.env")}
+
+	os.Setenv("RBAC_POLICY_FILE", "policy.json")
+	cfg, err := Load(append(noEnvFile, "-db-driver", MemoryDriver))
+	assert.Nil(t, err)
+	assert.EqualValues(t, RBACConfig{PolicyFile: "policy.json"}, cfg.RBAC)
+
+	cfg, err = Load(append(noEnvFile, "-db-driver", SQLiteDriver, "-db-name", "messages.db", "-rbac-policy-tables"))
+	assert.Nil(t, cfg)
+	assert.NotNil(t, err)
+
+	cfg, err = Load(append(noEnvFile, "-db-driver", MemoryDriver, "-rbac-policy-file", "", "-rbac-policy-tables"))
+	assert.Nil(t, cfg)
+	assert.NotNil(t, err)
+
+	cfg, err = Load(append(noEnvFile, "-db-driver", SQLiteDriver, "-db-name", "messages.db", "-rbac-policy-file", "", "-rbac-policy-tables"))
+	assert.Nil(t, err)
+	assert.True(t, cfg.RBAC.PolicyTables)
+}
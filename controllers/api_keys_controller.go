@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// CreateAPIKey answers the new key with its secret, which is never shown again.
+func CreateAPIKey(c *gin.Context) {
+	var key domain.APIKey
+	if err := c.ShouldBindJSON(&key); err != nil {
+		theErr := errorutils.NewUnprocessibleEntityError("invalid json body")
+		respondError(c, theErr)
+		return
+	}
+	issued, err := services.APIKeysService.CreateAPIKey(c.Request.Context(), key)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, issued)
+}
+
+func ListAPIKeys(c *gin.Context) {
+	keys, err := services.APIKeysService.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func RotateAPIKey(c *gin.Context) {
+	issued, err := services.APIKeysService.RotateAPIKey(c.Request.Context(), c.Param("key_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, issued)
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	if err := services.APIKeysService.RevokeAPIKey(c.Request.Context(), c.Param("key_id")); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, map[string]string{"status": "revoked"})
+}
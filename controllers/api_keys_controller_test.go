@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	createAPIKeyService func(key domain.APIKey) (*domain.IssuedAPIKey, errorutils.MessageErr)
+	listAPIKeysService  func() ([]domain.APIKey, errorutils.MessageErr)
+	rotateAPIKeyService func(id string) (*domain.IssuedAPIKey, errorutils.MessageErr)
+	revokeAPIKeyService func(id string) errorutils.MessageErr
+)
+
+type apiKeysServiceMock struct{}
+
+func (m *apiKeysServiceMock) CreateAPIKey(_ context.Context, key domain.APIKey) (*domain.IssuedAPIKey, errorutils.MessageErr) {
+	return createAPIKeyService(key)
+}
+
+func (m *apiKeysServiceMock) ListAPIKeys(context.Context) ([]domain.APIKey, errorutils.MessageErr) {
+	return listAPIKeysService()
+}
+
+func (m *apiKeysServiceMock) RotateAPIKey(_ context.Context, id string) (*domain.IssuedAPIKey, errorutils.MessageErr) {
+	return rotateAPIKeyService(id)
+}
+
+func (m *apiKeysServiceMock) RevokeAPIKey(_ context.Context, id string) errorutils.MessageErr {
+	return revokeAPIKeyService(id)
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	services.APIKeysService = &apiKeysServiceMock{}
+	var received domain.APIKey
+	createAPIKeyService = func(key domain.APIKey) (*domain.IssuedAPIKey, errorutils.MessageErr) {
+		received = key
+		key.ID = "k1"
+		key.SecretHash = "hash"
+		return &domain.IssuedAPIKey{APIKey: key, Key: "k1.secret"}, nil
+	}
+	rr := performRequest(http.MethodPost, "/api-keys", []byte(`{"name": "ci", "principal_id": "robot", "roles": ["editor"]}`))
+
+	assert.EqualValues(t, http.StatusCreated, rr.Code)
+	assert.EqualValues(t, domain.APIKey{Name: "ci", PrincipalID: "robot", Roles: []string{"editor"}}, received)
+	var issued map[string]interface{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &issued))
+	assert.EqualValues(t, "k1", issued["id"])
+	assert.EqualValues(t, "k1.secret", issued["key"])
+	assert.NotContains(t, rr.Body.String(), "hash")
+}
+
+func TestCreateAPIKey_InvalidBody(t *testing.T) {
+	services.APIKeysService = &apiKeysServiceMock{}
+	rr := performRequest(http.MethodPost, "/api-keys", []byte(`{"name": 1}`))
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestListAPIKeys_Forbidden(t *testing.T) {
+	services.APIKeysService = &apiKeysServiceMock{}
+	listAPIKeysService = func() ([]domain.APIKey, errorutils.MessageErr) {
+		return nil, errorutils.NewForbiddenError("only the admins can manage the api keys")
+	}
+	rr := performRequest(http.MethodGet, "/api-keys", nil)
+	assert.EqualValues(t, http.StatusForbidden, rr.Code)
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	services.APIKeysService = &apiKeysServiceMock{}
+	rotateAPIKeyService = func(id string) (*domain.IssuedAPIKey, errorutils.MessageErr) {
+		return &domain.IssuedAPIKey{APIKey: domain.APIKey{ID: id}, Key: id + ".new"}, nil
+	}
+	rr := performRequest(http.MethodPost, "/api-keys/k1/rotate", nil)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"key":"k1.new"`)
+}
+
+func TestRevokeAPIKey_NotFound(t *testing.T) {
+	services.APIKeysService = &apiKeysServiceMock{}
+	revokeAPIKeyService = func(id string) errorutils.MessageErr {
+		return domain.NewAPIKeyNotFoundError(id)
+	}
+	rr := performRequest(http.MethodDelete, "/api-keys/k1", nil)
+	assert.EqualValues(t, http.StatusNotFound, rr.Code)
+	assert.Contains(t, rr.Body.String(), domain.CodeAPIKeyNotFound)
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// Authenticate requires the requests to carry credentials one of verifiers
+// accepts, and places their principal in the request context for the
+// services. The first verifier finding credentials of its kind decides.
+func Authenticate(verifiers ...auth.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, v := range verifiers {
+			principal, err := v.Verify(c.Request)
+			if err != nil {
+				rejectRequest(c, verifiers, err)
+				return
+			}
+			if principal != nil {
+				c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+				c.Next()
+				return
+			}
+		}
+		rejectRequest(c, verifiers, auth.NewMissingCredentialsError())
+	}
+}
+
+// rejectRequest answers err and stops the handlers. The 401s tell every way
+// to authenticate in WWW-Authenticate.
+func rejectRequest(c *gin.Context, verifiers []auth.Verifier, err errorutils.MessageErr) {
+	if err.Status() == http.StatusUnauthorized {
+		for _, v := range verifiers {
+			c.Writer.Header().Add("WWW-Authenticate", v.Challenge())
+		}
+	}
+	respondError(c, err)
+	c.Abort()
+}
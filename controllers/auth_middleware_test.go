@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+var testJWTSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func performAuthenticatedRequest(headers ...string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Authenticate(auth.NewHMACVerifier(testJWTSecret, auth.JWTOptions{}), auth.APIKeyVerifier{}))
+	r.GET("/whoami", func(c *gin.Context) {
+		p, _ := auth.PrincipalFrom(c.Request.Context())
+		c.String(http.StatusOK, p.ID)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/whoami", nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAuthenticate_Token(t *testing.T) {
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(testJWTSecret)
+
+	rr := performAuthenticatedRequest("Authorization", "Bearer "+token)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, "alice", rr.Body.String())
+}
+
+func TestAuthenticate_MissingCredentials(t *testing.T) {
+	rr := performAuthenticatedRequest()
+	assert.EqualValues(t, http.StatusUnauthorized, rr.Code)
+	assert.EqualValues(t, []string{"Bearer", `ApiKey header="X-API-Key"`}, rr.Header().Values("WWW-Authenticate"))
+	assert.Contains(t, rr.Body.String(), auth.CodeMissingCredentials)
+}
+
+func TestAuthenticate_InvalidToken(t *testing.T) {
+	rr := performAuthenticatedRequest("Authorization", "Bearer not.a.token", "Accept", errorutils.ProblemContentType)
+	assert.EqualValues(t, http.StatusUnauthorized, rr.Code)
+	assert.EqualValues(t, errorutils.ProblemContentType, rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), auth.CodeInvalidToken)
+}
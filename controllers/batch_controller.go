@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+type batchRequest struct {
+	Create []domain.Message `json:"create"`
+	Update []domain.Message `json:"update"`
+	Delete []int64          `json:"delete"`
+}
+
+type batchResponse struct {
+	Create *domain.BatchReport `json:"create,omitempty"`
+	Update *domain.BatchReport `json:"update,omitempty"`
+	Delete *domain.BatchReport `json:"delete,omitempty"`
+}
+
+// BatchMessages runs the creates, then the updates and then the deletes of
+// the request, each part reporting the outcome of its own items.
+func BatchMessages(c *gin.Context) {
+	var batch batchRequest
+	if err := c.ShouldBindJSON(&batch); err != nil {
+		theErr := errorutils.NewUnprocessibleEntityError("invalid json body")
+		respondError(c, theErr)
+		return
+	}
+	size := len(batch.Create) + len(batch.Update) + len(batch.Delete)
+	if size == 0 {
+		theErr := errorutils.NewBadRequestError("the batch is empty")
+		respondError(c, theErr)
+		return
+	}
+	if size > services.MaxBatchSize {
+		theErr := errorutils.NewBadRequestError(fmt.Sprintf("a batch can't have more than %d items", services.MaxBatchSize))
+		respondError(c, theErr)
+		return
+	}
+
+	ctx := c.Request.Context()
+	var (
+		response batchResponse
+		err      errorutils.MessageErr
+	)
+	if len(batch.Create) > 0 {
+		if response.Create, err = services.MessagesService.CreateMessages(ctx, batch.Create); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	if len(batch.Update) > 0 {
+		if response.Update, err = services.MessagesService.UpdateMessages(ctx, batch.Update); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	if len(batch.Delete) > 0 {
+		if response.Delete, err = services.MessagesService.DeleteMessages(ctx, batch.Delete); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
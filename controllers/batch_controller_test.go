@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchMessages_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	createMessagesService = func(messages []domain.Message) (*domain.BatchReport, errorutils.MessageErr) {
+		assert.Len(t, messages, 2)
+		report := domain.NewBatchReport(len(messages))
+		report.Succeed(0, 1, &domain.Message{ID: 1, Title: messages[0].Title, Body: messages[0].Body, Version: 1})
+		report.Fail(1, 0, errorutils.NewUnprocessibleEntityError("Please enter a valid title"))
+		return report, nil
+	}
+	deleteMessagesService = func(msgIds []int64) (*domain.BatchReport, errorutils.MessageErr) {
+		assert.EqualValues(t, []int64{4, 5}, msgIds)
+		report := domain.NewBatchReport(len(msgIds))
+		report.Succeed(0, 4, nil)
+		report.Succeed(1, 5, nil)
+		return report, nil
+	}
+	body := []byte(`{"create":[{"title":"the title","body":"the body"},{"title":"","body":"the body"}],"delete":[4,5]}`)
+	rr := performRequest(http.MethodPost, "/messages:batch", body)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Create *struct {
+			Succeeded int
+			Failed    int
+			Results   []struct {
+				Index int
+				ID    int64
+				Error *struct {
+					Status int
+				}
+			}
+		}
+		Update *json.RawMessage
+		Delete *struct {
+			Succeeded int
+		}
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, response.Create.Succeeded)
+	assert.EqualValues(t, 1, response.Create.Failed)
+	assert.EqualValues(t, 1, response.Create.Results[0].ID)
+	assert.Nil(t, response.Create.Results[0].Error)
+	assert.EqualValues(t, http.StatusUnprocessableEntity, response.Create.Results[1].Error.Status)
+	assert.Nil(t, response.Update)
+	assert.EqualValues(t, 2, response.Delete.Succeeded)
+}
+
+func TestBatchMessages_InvalidJSON(t *testing.T) {
+	rr := performRequest(http.MethodPost, "/messages:batch", []byte(`{"delete":["one"]}`))
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestBatchMessages_Empty(t *testing.T) {
+	rr := performRequest(http.MethodPost, "/messages:batch", []byte(`{}`))
+	assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestBatchMessages_TooMany(t *testing.T) {
+	ids := make([]int64, services.MaxBatchSize+1)
+	body, _ := json.Marshal(map[string][]int64{"delete": ids})
+	rr := performRequest(http.MethodPost, "/messages:batch", body)
+	assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestBatchMessages_ServiceError(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	updateMessagesService = func(messages []domain.Message) (*domain.BatchReport, errorutils.MessageErr) {
+		return nil, errorutils.NewServiceUnavailableError("the database is unavailable, please retry later")
+	}
+	rr := performRequest(http.MethodPost, "/messages:batch", []byte(`{"update":[{"id":1,"title":"title","body":"body"}]}`))
+	assert.EqualValues(t, http.StatusServiceUnavailable, rr.Code)
+}
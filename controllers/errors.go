@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// respondError writes err as problem details to the clients asking for
+// application/problem+json, and in the legacy format to the others.
+func respondError(c *gin.Context, err errorutils.MessageErr) {
+	c.Header("Vary", "Accept")
+	if !errorutils.PrefersProblem(c.GetHeader("Accept")) {
+		c.JSON(err.Status(), err)
+		return
+	}
+	c.Header("Content-Type", errorutils.ProblemContentType)
+	c.JSON(err.Status(), errorutils.NewProblem(err, c.Request.URL.RequestURI()))
+}
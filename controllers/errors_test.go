@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRespondError_Problem(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	getMessageService = func(msgId int64) (*domain.Message, errorutils.MessageErr) {
+		return nil, errorutils.NewNotFoundError("no record matching gived id")
+	}
+	rr := performRequest(http.MethodGet, "/messages/1?fields=all", nil, "Accept", "application/problem+json")
+
+	assert.EqualValues(t, http.StatusNotFound, rr.Code)
+	assert.EqualValues(t, errorutils.ProblemContentType, rr.Header().Get("Content-Type"))
+	var problem errorutils.Problem
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	assert.EqualValues(t, errorutils.Problem{
+		Type:     "urn:efficientapi:problem:not_found",
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "no record matching gived id",
+		Instance: "/messages/1?fields=all",
+		Code:     errorutils.CodeNotFound,
+	}, problem)
+
+	apiErr, err := errorutils.NewApiErrFromBites(rr.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, "not_found", apiErr.Error())
+}
+
+func TestRespondError_Legacy(t *testing.T) {
+	rr := performRequest(http.MethodGet, "/messages/abc", nil, "Accept", "application/json")
+
+	assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "application/json")
+	assert.EqualValues(t, "Accept", rr.Header().Get("Vary"))
+	assert.JSONEq(t, `{"message":"message id should be a number","status":400,"error":"bad_request","code":"bad_request"}`, rr.Body.String())
+}
@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+)
+
+// Health answers 200 while the database is reachable and 503 otherwise,
+// for load balancers and orchestrators to probe.
+func Health(c *gin.Context) {
+	health := services.HealthService.CheckHealth(c.Request.Context())
+	status := http.StatusOK
+	if health.Status != domain.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, health)
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type healthServiceMock struct {
+	health *domain.Health
+}
+
+func (m *healthServiceMock) CheckHealth(context.Context) *domain.Health {
+	return m.health
+}
+
+func TestHealth_OK(t *testing.T) {
+	services.HealthService = &healthServiceMock{&domain.Health{Status: domain.HealthOK, Pool: &domain.PoolStats{OpenConnections: 2, Idle: 2}}}
+	rr := performRequest(http.MethodGet, "/health", nil)
+
+	var health domain.Health
+	err := json.Unmarshal(rr.Body.Bytes(), &health)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, domain.HealthOK, health.Status)
+	assert.EqualValues(t, 2, health.Pool.Idle)
+}
+
+func TestHealth_Unavailable(t *testing.T) {
+	services.HealthService = &healthServiceMock{&domain.Health{Status: domain.HealthUnavailable, Error: "connection refused"}}
+	rr := performRequest(http.MethodGet, "/health", nil)
+	assert.EqualValues(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "connection refused")
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+func getMessageId(msgIdParam string) (int64, errorutils.MessageErr) {
+	msgId, err := strconv.ParseInt(msgIdParam, 10, 64)
+	if err != nil {
+		return 0, errorutils.NewBadRequestError("message id should be a number")
+	}
+	return msgId, nil
+}
+
+// etag is the strong entity tag of a message, its quoted version.
+func etag(message *domain.Message) string {
+	return strconv.Quote(strconv.FormatInt(message.Version, 10))
+}
+
+// getIfMatchVersion returns the version an If-Match header asks for, 0 when
+// the header is missing or "*" so that any version is accepted.
+func getIfMatchVersion(ifMatch string) (int64, errorutils.MessageErr) {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, nil
+	}
+	unquoted, err := strconv.Unquote(ifMatch)
+	if err != nil {
+		return 0, errorutils.NewBadRequestError("If-Match should be an ETag of the message")
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, errorutils.NewBadRequestError("If-Match should be an ETag of the message")
+	}
+	return version, nil
+}
+
+func GetMessage(c *gin.Context) {
+	msgId, err := getMessageId(c.Param("message_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	message, getErr := services.MessagesService.GetMessageContext(c.Request.Context(), msgId)
+	if getErr != nil {
+		respondError(c, getErr)
+		return
+	}
+	c.Header("ETag", etag(message))
+	c.JSON(http.StatusOK, message)
+}
+
+func getListOptions(c *gin.Context) (domain.ListOptions, errorutils.MessageErr) {
+	opts := domain.ListOptions{
+		Cursor:        c.Query("cursor"),
+		Sort:          domain.SortOrder(c.Query("sort")),
+		TitleContains: c.Query("title"),
+		Tags:          c.QueryArray("tag"),
+		TagMatch:      domain.TagMatch(c.Query("tag_match")),
+	}
+	if deleted := c.Query("deleted"); deleted != "" {
+		b, err := strconv.ParseBool(deleted)
+		if err != nil {
+			return opts, errorutils.NewBadRequestError("deleted should be a boolean")
+		}
+		opts.Deleted = b
+	}
+	if pageSize := c.Query("page_size"); pageSize != "" {
+		size, err := strconv.Atoi(pageSize)
+		if err != nil {
+			return opts, errorutils.NewBadRequestError("page_size should be a number")
+		}
+		opts.PageSize = size
+	}
+	if from := c.Query("created_from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return opts, errorutils.NewBadRequestError("created_from should be an RFC 3339 timestamp")
+		}
+		opts.CreatedFrom = t
+	}
+	if to := c.Query("created_to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return opts, errorutils.NewBadRequestError("created_to should be an RFC 3339 timestamp")
+		}
+		opts.CreatedTo = t
+	}
+	return opts, nil
+}
+
+func ListMessages(c *gin.Context) {
+	opts, err := getListOptions(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	page, listErr := services.MessagesService.ListMessages(c.Request.Context(), opts)
+	if listErr != nil {
+		respondError(c, listErr)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func CreateMessage(c *gin.Context) {
+	var message domain.Message
+	if err := c.ShouldBindJSON(&message); err != nil {
+		theErr := errorutils.NewUnprocessibleEntityError("invalid json body")
+		respondError(c, theErr)
+		return
+	}
+	msg, err := services.MessagesService.CreateMessageContext(c.Request.Context(), &message)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Header("ETag", etag(msg))
+	c.JSON(http.StatusCreated, msg)
+}
+
+func UpdateMessage(c *gin.Context) {
+	msgId, err := getMessageId(c.Param("message_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var message domain.Message
+	if err := c.ShouldBindJSON(&message); err != nil {
+		theErr := errorutils.NewUnprocessibleEntityError("invalid json body")
+		respondError(c, theErr)
+		return
+	}
+	message.ID = msgId
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		version, err := getIfMatchVersion(ifMatch)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		message.Version = version
+	}
+	msg, updateErr := services.MessagesService.UpdateMessageContext(c.Request.Context(), &message)
+	if updateErr != nil {
+		respondError(c, updateErr)
+		return
+	}
+	c.Header("ETag", etag(msg))
+	c.JSON(http.StatusOK, msg)
+}
+
+func DeleteMessage(c *gin.Context) {
+	msgId, err := getMessageId(c.Param("message_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if deleteErr := services.MessagesService.DeleteMessageContext(c.Request.Context(), msgId); deleteErr != nil {
+		respondError(c, deleteErr)
+		return
+	}
+	c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func RestoreMessage(c *gin.Context) {
+	msgId, err := getMessageId(c.Param("message_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	msg, restoreErr := services.MessagesService.RestoreMessage(c.Request.Context(), msgId)
+	if restoreErr != nil {
+		respondError(c, restoreErr)
+		return
+	}
+	c.Header("ETag", etag(msg))
+	c.JSON(http.StatusOK, msg)
+}
+
+// SearchMessages serves GET /messages/search?q=, see domain.SearchOptions for the query syntax.
+func SearchMessages(c *gin.Context) {
+	opts := domain.SearchOptions{
+		Query:  c.Query("q"),
+		Cursor: c.Query("cursor"),
+	}
+	if pageSize := c.Query("page_size"); pageSize != "" {
+		size, err := strconv.Atoi(pageSize)
+		if err != nil {
+			theErr := errorutils.NewBadRequestError("page_size should be a number")
+			respondError(c, theErr)
+			return
+		}
+		opts.PageSize = size
+	}
+	page, err := services.MessagesService.SearchMessages(c.Request.Context(), opts)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,477 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	tm                    = time.Now()
+	getMessageService     func(msgId int64) (*domain.Message, errorutils.MessageErr)
+	createMessageService  func(message *domain.Message) (*domain.Message, errorutils.MessageErr)
+	updateMessageService  func(message *domain.Message) (*domain.Message, errorutils.MessageErr)
+	deleteMessageService  func(msgId int64) errorutils.MessageErr
+	getAllMessagesService func() ([]domain.Message, errorutils.MessageErr)
+	listMessagesService   func(opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr)
+	restoreMessageService func(msgId int64) (*domain.Message, errorutils.MessageErr)
+	listRevisionsService  func(msgId int64) ([]domain.Revision, errorutils.MessageErr)
+	getRevisionService    func(msgId, revisionId int64) (*domain.Revision, errorutils.MessageErr)
+	diffRevisionsService  func(msgId, fromId, toId int64) (*domain.RevisionDiff, errorutils.MessageErr)
+	revertMessageService  func(msgId, revisionId, version int64) (*domain.Message, errorutils.MessageErr)
+	createMessagesService func(messages []domain.Message) (*domain.BatchReport, errorutils.MessageErr)
+	updateMessagesService func(messages []domain.Message) (*domain.BatchReport, errorutils.MessageErr)
+	deleteMessagesService func(msgIds []int64) (*domain.BatchReport, errorutils.MessageErr)
+	searchMessagesService func(opts domain.SearchOptions) (*domain.SearchPage, errorutils.MessageErr)
+	listTagsService       func() ([]domain.TagCount, errorutils.MessageErr)
+	renameTagService      func(from, to string) (*domain.TagRename, errorutils.MessageErr)
+)
+
+type serviceMock struct{}
+
+func (sm *serviceMock) GetMessage(msgId int64) (*domain.Message, errorutils.MessageErr) {
+	return getMessageService(msgId)
+}
+
+func (sm *serviceMock) CreateMessage(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	return createMessageService(message)
+}
+
+func (sm *serviceMock) UpdateMessage(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	return updateMessageService(message)
+}
+
+func (sm *serviceMock) DeleteMessage(msgId int64) errorutils.MessageErr {
+	return deleteMessageService(msgId)
+}
+
+func (sm *serviceMock) GetAllMessages() ([]domain.Message, errorutils.MessageErr) {
+	return getAllMessagesService()
+}
+
+func (sm *serviceMock) GetMessageContext(_ context.Context, msgId int64) (*domain.Message, errorutils.MessageErr) {
+	return getMessageService(msgId)
+}
+
+func (sm *serviceMock) CreateMessageContext(_ context.Context, message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	return createMessageService(message)
+}
+
+func (sm *serviceMock) UpdateMessageContext(_ context.Context, message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	return updateMessageService(message)
+}
+
+func (sm *serviceMock) DeleteMessageContext(_ context.Context, msgId int64) errorutils.MessageErr {
+	return deleteMessageService(msgId)
+}
+
+func (sm *serviceMock) GetAllMessagesContext(_ context.Context) ([]domain.Message, errorutils.MessageErr) {
+	return getAllMessagesService()
+}
+
+func (sm *serviceMock) ListMessages(_ context.Context, opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr) {
+	return listMessagesService(opts)
+}
+
+func (sm *serviceMock) RestoreMessage(_ context.Context, msgId int64) (*domain.Message, errorutils.MessageErr) {
+	return restoreMessageService(msgId)
+}
+
+func (sm *serviceMock) PurgeDeletedMessages(context.Context, time.Duration) (int64, errorutils.MessageErr) {
+	return 0, nil
+}
+
+func (sm *serviceMock) ListRevisions(_ context.Context, msgId int64) ([]domain.Revision, errorutils.MessageErr) {
+	return listRevisionsService(msgId)
+}
+
+func (sm *serviceMock) GetRevision(_ context.Context, msgId int64, revisionId int64) (*domain.Revision, errorutils.MessageErr) {
+	return getRevisionService(msgId, revisionId)
+}
+
+func (sm *serviceMock) DiffRevisions(_ context.Context, msgId int64, fromId int64, toId int64) (*domain.RevisionDiff, errorutils.MessageErr) {
+	return diffRevisionsService(msgId, fromId, toId)
+}
+
+func (sm *serviceMock) RevertMessage(_ context.Context, msgId int64, revisionId int64, version int64) (*domain.Message, errorutils.MessageErr) {
+	return revertMessageService(msgId, revisionId, version)
+}
+
+func (sm *serviceMock) CreateMessages(_ context.Context, messages []domain.Message) (*domain.BatchReport, errorutils.MessageErr) {
+	return createMessagesService(messages)
+}
+
+func (sm *serviceMock) UpdateMessages(_ context.Context, messages []domain.Message) (*domain.BatchReport, errorutils.MessageErr) {
+	return updateMessagesService(messages)
+}
+
+func (sm *serviceMock) DeleteMessages(_ context.Context, msgIds []int64) (*domain.BatchReport, errorutils.MessageErr) {
+	return deleteMessagesService(msgIds)
+}
+
+func (sm *serviceMock) SearchMessages(_ context.Context, opts domain.SearchOptions) (*domain.SearchPage, errorutils.MessageErr) {
+	return searchMessagesService(opts)
+}
+
+func (sm *serviceMock) ListTags(context.Context) ([]domain.TagCount, errorutils.MessageErr) {
+	return listTagsService()
+}
+
+func (sm *serviceMock) RenameTag(_ context.Context, from string, to string) (*domain.TagRename, errorutils.MessageErr) {
+	return renameTagService(from, to)
+}
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/health", Health)
+	r.GET("/messages", ListMessages)
+	r.GET("/messages/:message_id", func(c *gin.Context) {
+		if c.Param("message_id") == "search" {
+			SearchMessages(c)
+			return
+		}
+		GetMessage(c)
+	})
+	r.POST("/messages", CreateMessage)
+	r.PUT("/messages/:message_id", UpdateMessage)
+	r.DELETE("/messages/:message_id", DeleteMessage)
+	r.POST("/messages/:message_id/restore", RestoreMessage)
+	r.GET("/messages/:message_id/revisions", ListRevisions)
+	r.GET("/messages/:message_id/revisions/:revision_id", GetRevision)
+	r.POST("/messages/:message_id/revisions/:revision_id/revert", RevertMessage)
+	r.GET("/messages/:message_id/diff", DiffRevisions)
+	r.GET("/tags", ListTags)
+	r.GET("/me/permissions", GetPermissions)
+	r.GET("/api-keys", ListAPIKeys)
+	r.POST("/api-keys", CreateAPIKey)
+	r.POST("/api-keys/:key_id/rotate", RotateAPIKey)
+	r.DELETE("/api-keys/:key_id", RevokeAPIKey)
+	r.NoRoute(func(c *gin.Context) {
+		if c.Request.Method == http.MethodPost && c.Request.URL.Path == "/messages:batch" {
+			BatchMessages(c)
+		}
+		if c.Request.Method == http.MethodPost && c.Request.URL.Path == "/tags:rename" {
+			RenameTags(c)
+		}
+	})
+	return r
+}
+
+func performRequest(method, path string, body []byte, headers ...string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rr := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGetMessage_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	getMessageService = func(msgId int64) (*domain.Message, errorutils.MessageErr) {
+		return &domain.Message{
+			ID:        1,
+			Title:     "the title",
+			Body:      "the body",
+			CreatedAt: tm,
+			Version:   3,
+		}, nil
+	}
+	rr := performRequest(http.MethodGet, "/messages/1", nil)
+
+	var message domain.Message
+	err := json.Unmarshal(rr.Body.Bytes(), &message)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, `"3"`, rr.Header().Get("ETag"))
+	assert.EqualValues(t, 1, message.ID)
+	assert.EqualValues(t, "the title", message.Title)
+	assert.EqualValues(t, "the body", message.Body)
+}
+
+func TestGetMessage_InvalidId(t *testing.T) {
+	rr := performRequest(http.MethodGet, "/messages/abc", nil)
+
+	apiErr, err := errorutils.NewApiErrFromBites(rr.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+	assert.EqualValues(t, http.StatusBadRequest, apiErr.Status())
+	assert.EqualValues(t, "message id should be a number", apiErr.Message())
+	assert.EqualValues(t, "bad_request", apiErr.Error())
+}
+
+func TestGetMessage_NotFound(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	getMessageService = func(msgId int64) (*domain.Message, errorutils.MessageErr) {
+		return nil, errorutils.NewNotFoundError("message not found")
+	}
+	rr := performRequest(http.MethodGet, "/messages/1", nil)
+
+	apiErr, err := errorutils.NewApiErrFromBites(rr.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, rr.Code)
+	assert.EqualValues(t, "message not found", apiErr.Message())
+	assert.EqualValues(t, "not_found", apiErr.Error())
+}
+
+func TestListMessages_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	listMessagesService = func(opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr) {
+		assert.EqualValues(t, 2, opts.PageSize)
+		assert.EqualValues(t, "abc", opts.Cursor)
+		assert.EqualValues(t, domain.SortDesc, opts.Sort)
+		assert.EqualValues(t, "hello", opts.TitleContains)
+		assert.True(t, opts.CreatedFrom.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+		assert.EqualValues(t, []string{"work", "go"}, opts.Tags)
+		assert.EqualValues(t, domain.TagMatchAny, opts.TagMatch)
+		return &domain.MessagePage{
+			Items: []domain.Message{
+				{ID: 1, Title: "first title", Body: "first body"},
+				{ID: 2, Title: "second title", Body: "second body"},
+			},
+			NextCursor: "def",
+		}, nil
+	}
+	rr := performRequest(http.MethodGet, "/messages?page_size=2&cursor=abc&sort=desc&title=hello&created_from=2020-01-01T00:00:00Z&tag=work&tag=go&tag_match=any", nil)
+
+	var page domain.MessagePage
+	err := json.Unmarshal(rr.Body.Bytes(), &page)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, 2, len(page.Items))
+	assert.EqualValues(t, "def", page.NextCursor)
+}
+
+func TestListMessages_Empty(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	listMessagesService = func(opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr) {
+		return &domain.MessagePage{Items: []domain.Message{}}, nil
+	}
+	rr := performRequest(http.MethodGet, "/messages", nil)
+
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"items": []}`, rr.Body.String())
+}
+
+func TestListMessages_InvalidQuery(t *testing.T) {
+	tests := []struct {
+		query  string
+		errMsg string
+	}{
+		{query: "page_size=ten", errMsg: "page_size should be a number"},
+		{query: "created_from=yesterday", errMsg: "created_from should be an RFC 3339 timestamp"},
+		{query: "created_to=tomorrow", errMsg: "created_to should be an RFC 3339 timestamp"},
+	}
+	for _, tt := range tests {
+		rr := performRequest(http.MethodGet, "/messages?"+tt.query, nil)
+
+		apiErr, err := errorutils.NewApiErrFromBites(rr.Body.Bytes())
+		assert.Nil(t, err)
+		assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+		assert.EqualValues(t, tt.errMsg, apiErr.Message())
+	}
+}
+
+func TestCreateMessage_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	createMessageService = func(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+		return &domain.Message{
+			ID:        1,
+			Title:     message.Title,
+			Body:      message.Body,
+			CreatedAt: tm,
+		}, nil
+	}
+	body, _ := json.Marshal(&domain.Message{Title: "the title", Body: "the body"})
+	rr := performRequest(http.MethodPost, "/messages", body)
+
+	var message domain.Message
+	err := json.Unmarshal(rr.Body.Bytes(), &message)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusCreated, rr.Code)
+	assert.EqualValues(t, 1, message.ID)
+	assert.EqualValues(t, "the title", message.Title)
+}
+
+func TestCreateMessage_InvalidJSON(t *testing.T) {
+	rr := performRequest(http.MethodPost, "/messages", []byte(`{"title": 1}`))
+
+	apiErr, err := errorutils.NewApiErrFromBites(rr.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.EqualValues(t, "invalid json body", apiErr.Message())
+}
+
+func TestCreateMessage_ServiceError(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	createMessageService = func(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+		return nil, errorutils.NewUnprocessibleEntityError("Please enter a valid title")
+	}
+	body, _ := json.Marshal(&domain.Message{Body: "the body"})
+	rr := performRequest(http.MethodPost, "/messages", body)
+
+	apiErr, err := errorutils.NewApiErrFromBites(rr.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.EqualValues(t, "Please enter a valid title", apiErr.Message())
+	assert.EqualValues(t, "invalid_request", apiErr.Error())
+}
+
+func TestUpdateMessage_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	updateMessageService = func(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+		return message, nil
+	}
+	body, _ := json.Marshal(&domain.Message{Title: "update title", Body: "update body"})
+	rr := performRequest(http.MethodPut, "/messages/1", body)
+
+	var message domain.Message
+	err := json.Unmarshal(rr.Body.Bytes(), &message)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, 1, message.ID)
+	assert.EqualValues(t, "update title", message.Title)
+}
+
+func TestUpdateMessage_IfMatch(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	updateMessageService = func(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+		assert.EqualValues(t, 4, message.Version)
+		message.Version++
+		return message, nil
+	}
+	body, _ := json.Marshal(&domain.Message{Title: "update title", Body: "update body"})
+	rr := performRequest(http.MethodPut, "/messages/1", body, "If-Match", `"4"`)
+
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, `"5"`, rr.Header().Get("ETag"))
+}
+
+func TestUpdateMessage_IfMatchConflict(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	updateMessageService = func(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+		return nil, domain.NewVersionConflictError(message.ID)
+	}
+	body, _ := json.Marshal(&domain.Message{Title: "update title", Body: "update body"})
+	rr := performRequest(http.MethodPut, "/messages/1", body, "If-Match", `"1"`)
+
+	apiErr, err := errorutils.NewApiErrFromBites(rr.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusConflict, rr.Code)
+	assert.EqualValues(t, "conflict", apiErr.Error())
+}
+
+func TestUpdateMessage_InvalidIfMatch(t *testing.T) {
+	for _, ifMatch := range []string{"1", `W/"1"`, `"abc"`, `"0"`} {
+		body, _ := json.Marshal(&domain.Message{Title: "update title", Body: "update body"})
+		rr := performRequest(http.MethodPut, "/messages/1", body, "If-Match", ifMatch)
+
+		apiErr, err := errorutils.NewApiErrFromBites(rr.Body.Bytes())
+		assert.Nil(t, err)
+		assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+		assert.EqualValues(t, "If-Match should be an ETag of the message", apiErr.Message())
+	}
+}
+
+func TestDeleteMessage_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	deleteMessageService = func(msgId int64) errorutils.MessageErr {
+		return nil
+	}
+	rr := performRequest(http.MethodDelete, "/messages/1", nil)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+}
+
+func TestDeleteMessage_NotFound(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	deleteMessageService = func(msgId int64) errorutils.MessageErr {
+		return errorutils.NewNotFoundError("no record matching gived id")
+	}
+	rr := performRequest(http.MethodDelete, "/messages/1", nil)
+
+	apiErr, err := errorutils.NewApiErrFromBites(rr.Body.Bytes())
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, rr.Code)
+	assert.EqualValues(t, "not_found", apiErr.Error())
+}
+
+func TestListMessages_Deleted(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	listMessagesService = func(opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr) {
+		assert.True(t, opts.Deleted)
+		return &domain.MessagePage{Items: []domain.Message{}}, nil
+	}
+	rr := performRequest(http.MethodGet, "/messages?deleted=true", nil)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+
+	rr = performRequest(http.MethodGet, "/messages?deleted=maybe", nil)
+	assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestRestoreMessage_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	restoreMessageService = func(msgId int64) (*domain.Message, errorutils.MessageErr) {
+		return &domain.Message{ID: msgId, Title: "the title", Body: "the body", Version: 2}, nil
+	}
+	rr := performRequest(http.MethodPost, "/messages/1/restore", nil)
+
+	var message domain.Message
+	err := json.Unmarshal(rr.Body.Bytes(), &message)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, 1, message.ID)
+	assert.EqualValues(t, `"2"`, rr.Header().Get("ETag"))
+}
+
+func TestRestoreMessage_NotFound(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	restoreMessageService = func(msgId int64) (*domain.Message, errorutils.MessageErr) {
+		return nil, errorutils.NewNotFoundError("no record matching gived id")
+	}
+	rr := performRequest(http.MethodPost, "/messages/1/restore", nil)
+	assert.EqualValues(t, http.StatusNotFound, rr.Code)
+}
+
+func TestSearchMessages_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	searchMessagesService = func(opts domain.SearchOptions) (*domain.SearchPage, errorutils.MessageErr) {
+		assert.EqualValues(t, `go "error handling"`, opts.Query)
+		assert.EqualValues(t, 5, opts.PageSize)
+		return &domain.SearchPage{
+			Items: []domain.SearchHit{{
+				Message:        domain.Message{ID: 1, Title: "Go", Body: "error handling"},
+				Score:          3,
+				TitleHighlight: "<mark>Go</mark>",
+				Snippet:        "<mark>error handling</mark>",
+			}},
+			NextCursor: "next",
+		}, nil
+	}
+	rr := performRequest(http.MethodGet, "/messages/search?q=go+%22error+handling%22&page_size=5", nil)
+
+	var page domain.SearchPage
+	err := json.Unmarshal(rr.Body.Bytes(), &page)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.Len(t, page.Items, 1)
+	assert.EqualValues(t, "<mark>Go</mark>", page.Items[0].TitleHighlight)
+	assert.EqualValues(t, "next", page.NextCursor)
+}
+
+func TestSearchMessages_InvalidPageSize(t *testing.T) {
+	rr := performRequest(http.MethodGet, "/messages/search?q=go&page_size=many", nil)
+	assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+}
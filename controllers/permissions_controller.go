@@ -0,0 +1,14 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/services"
+)
+
+// GetPermissions answers the roles and permissions of the caller, for
+// clients to tell which operations they may offer.
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, services.PermissionsService.GetGrants(c.Request.Context()))
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type permissionsServiceMock struct {
+	grants *auth.Grants
+}
+
+func (m *permissionsServiceMock) GetGrants(context.Context) *auth.Grants {
+	return m.grants
+}
+
+func TestGetPermissions(t *testing.T) {
+	services.PermissionsService = &permissionsServiceMock{&auth.Grants{Principal: "alice", Roles: []string{"reader"}, Permissions: []string{auth.PermReadMessages}}}
+	rr := performRequest(http.MethodGet, "/me/permissions", nil)
+
+	var grants auth.Grants
+	err := json.Unmarshal(rr.Body.Bytes(), &grants)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, "alice", grants.Principal)
+	assert.EqualValues(t, []string{auth.PermReadMessages}, grants.Permissions)
+}
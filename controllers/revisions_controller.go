@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+func getRevisionId(revisionIdParam string) (int64, errorutils.MessageErr) {
+	revisionId, err := strconv.ParseInt(revisionIdParam, 10, 64)
+	if err != nil {
+		return 0, errorutils.NewBadRequestError("revision id should be a number")
+	}
+	return revisionId, nil
+}
+
+func ListRevisions(c *gin.Context) {
+	msgId, err := getMessageId(c.Param("message_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	revisions, listErr := services.MessagesService.ListRevisions(c.Request.Context(), msgId)
+	if listErr != nil {
+		respondError(c, listErr)
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+func GetRevision(c *gin.Context) {
+	msgId, err := getMessageId(c.Param("message_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	revisionId, err := getRevisionId(c.Param("revision_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	revision, getErr := services.MessagesService.GetRevision(c.Request.Context(), msgId, revisionId)
+	if getErr != nil {
+		respondError(c, getErr)
+		return
+	}
+	c.JSON(http.StatusOK, revision)
+}
+
+// DiffRevisions compares the revisions given by the "from" and "to" query parameters.
+func DiffRevisions(c *gin.Context) {
+	msgId, err := getMessageId(c.Param("message_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	fromId, err := getRevisionId(c.Query("from"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	toId, err := getRevisionId(c.Query("to"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	diff, diffErr := services.MessagesService.DiffRevisions(c.Request.Context(), msgId, fromId, toId)
+	if diffErr != nil {
+		respondError(c, diffErr)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+func RevertMessage(c *gin.Context) {
+	msgId, err := getMessageId(c.Param("message_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	revisionId, err := getRevisionId(c.Param("revision_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	version, err := getIfMatchVersion(c.GetHeader("If-Match"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	msg, revertErr := services.MessagesService.RevertMessage(c.Request.Context(), msgId, revisionId, version)
+	if revertErr != nil {
+		respondError(c, revertErr)
+		return
+	}
+	c.Header("ETag", etag(msg))
+	c.JSON(http.StatusOK, msg)
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRevisions_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	listRevisionsService = func(msgId int64) ([]domain.Revision, errorutils.MessageErr) {
+		return []domain.Revision{
+			{ID: 1, MessageID: msgId, Version: 1, Title: "title", Body: "body", Action: domain.RevisionCreate},
+			{ID: 2, MessageID: msgId, Version: 2, Title: "title", Body: "new body", Action: domain.RevisionUpdate},
+		}, nil
+	}
+	rr := performRequest(http.MethodGet, "/messages/1/revisions", nil)
+
+	var revisions []domain.Revision
+	err := json.Unmarshal(rr.Body.Bytes(), &revisions)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.Len(t, revisions, 2)
+	assert.EqualValues(t, domain.RevisionUpdate, revisions[1].Action)
+}
+
+func TestListRevisions_NotFound(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	listRevisionsService = func(msgId int64) ([]domain.Revision, errorutils.MessageErr) {
+		return nil, errorutils.NewNotFoundError("no record matching gived id")
+	}
+	rr := performRequest(http.MethodGet, "/messages/1/revisions", nil)
+	assert.EqualValues(t, http.StatusNotFound, rr.Code)
+}
+
+func TestGetRevision_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	getRevisionService = func(msgId, revisionId int64) (*domain.Revision, errorutils.MessageErr) {
+		return &domain.Revision{ID: revisionId, MessageID: msgId, Title: "title", Body: "body"}, nil
+	}
+	rr := performRequest(http.MethodGet, "/messages/1/revisions/3", nil)
+
+	var revision domain.Revision
+	err := json.Unmarshal(rr.Body.Bytes(), &revision)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, 3, revision.ID)
+	assert.EqualValues(t, 1, revision.MessageID)
+}
+
+func TestGetRevision_InvalidId(t *testing.T) {
+	rr := performRequest(http.MethodGet, "/messages/1/revisions/abc", nil)
+	assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestDiffRevisions_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	diffRevisionsService = func(msgId, fromId, toId int64) (*domain.RevisionDiff, errorutils.MessageErr) {
+		assert.EqualValues(t, 1, fromId)
+		assert.EqualValues(t, 2, toId)
+		return domain.DiffRevisions(
+			&domain.Revision{ID: fromId, MessageID: msgId, Title: "title", Body: "body"},
+			&domain.Revision{ID: toId, MessageID: msgId, Title: "title", Body: "new body"},
+		), nil
+	}
+	rr := performRequest(http.MethodGet, "/messages/1/diff?from=1&to=2", nil)
+
+	var diff domain.RevisionDiff
+	err := json.Unmarshal(rr.Body.Bytes(), &diff)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.Len(t, diff.Changes, 1)
+	assert.EqualValues(t, "body", diff.Changes[0].Field)
+}
+
+func TestDiffRevisions_MissingRevision(t *testing.T) {
+	rr := performRequest(http.MethodGet, "/messages/1/diff?from=1", nil)
+	assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestRevertMessage_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	revertMessageService = func(msgId, revisionId, version int64) (*domain.Message, errorutils.MessageErr) {
+		assert.EqualValues(t, 1, revisionId)
+		assert.EqualValues(t, 3, version)
+		return &domain.Message{ID: msgId, Title: "title", Body: "body", Version: 4}, nil
+	}
+	rr := performRequest(http.MethodPost, "/messages/1/revisions/1/revert", nil, "If-Match", `"3"`)
+
+	var message domain.Message
+	err := json.Unmarshal(rr.Body.Bytes(), &message)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, "body", message.Body)
+	assert.EqualValues(t, `"4"`, rr.Header().Get("ETag"))
+}
+
+func TestRevertMessage_Conflict(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	revertMessageService = func(msgId, revisionId, version int64) (*domain.Message, errorutils.MessageErr) {
+		return nil, domain.NewVersionConflictError(msgId)
+	}
+	rr := performRequest(http.MethodPost, "/messages/1/revisions/1/revert", nil, "If-Match", `"2"`)
+	assert.EqualValues(t, http.StatusConflict, rr.Code)
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+type renameTagRequest struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to" binding:"required"`
+}
+
+// ListTags answers the tags of the live messages, by name, with how many
+// messages carry each of them.
+func ListTags(c *gin.Context) {
+	tags, err := services.MessagesService.ListTags(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
+
+// RenameTags renames the "from" tag of the request to "to" on every
+// message, merging the two when "to" is a tag already.
+func RenameTags(c *gin.Context) {
+	var request renameTagRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		theErr := errorutils.NewUnprocessibleEntityError("invalid json body")
+		respondError(c, theErr)
+		return
+	}
+	rename, err := services.MessagesService.RenameTag(c.Request.Context(), request.From, request.To)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rename)
+}
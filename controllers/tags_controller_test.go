@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/services"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListTags_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	listTagsService = func() ([]domain.TagCount, errorutils.MessageErr) {
+		return []domain.TagCount{{Name: "go", Count: 3}, {Name: "work", Count: 1}}, nil
+	}
+	rr := performRequest(http.MethodGet, "/tags", nil)
+
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[{"name": "go", "count": 3}, {"name": "work", "count": 1}]`, rr.Body.String())
+}
+
+func TestRenameTags_Success(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	renameTagService = func(from, to string) (*domain.TagRename, errorutils.MessageErr) {
+		assert.EqualValues(t, "work", from)
+		assert.EqualValues(t, "job", to)
+		return &domain.TagRename{From: from, To: to, Merged: true, MessageIDs: []int64{1, 4}}, nil
+	}
+	rr := performRequest(http.MethodPost, "/tags:rename", []byte(`{"from": "work", "to": "job"}`))
+
+	var rename domain.TagRename
+	err := json.Unmarshal(rr.Body.Bytes(), &rename)
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.True(t, rename.Merged)
+	assert.EqualValues(t, []int64{1, 4}, rename.MessageIDs)
+}
+
+func TestRenameTags_Errors(t *testing.T) {
+	services.MessagesService = &serviceMock{}
+	renameTagService = func(from, to string) (*domain.TagRename, errorutils.MessageErr) {
+		return nil, domain.NewTagNotFoundError(from)
+	}
+	rr := performRequest(http.MethodPost, "/tags:rename", []byte(`{"from": "work", "to": "job"}`))
+	assert.EqualValues(t, http.StatusNotFound, rr.Code)
+
+	rr = performRequest(http.MethodPost, "/tags:rename", []byte(`{"from": "work"}`))
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rr.Code)
+}
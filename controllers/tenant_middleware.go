@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/domain"
+)
+
+// ResolveTenant scopes the request context to the tenant of the caller, as
+// auth.Tenant picks it from the principal and the X-Tenant-ID header. It
+// must run after Authenticate.
+func ResolveTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, _ := auth.PrincipalFrom(c.Request.Context())
+		tenant, err := auth.Tenant(principal, strings.TrimSpace(c.GetHeader(auth.TenantHeader)))
+		if err != nil {
+			respondError(c, err)
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(domain.WithTenant(c.Request.Context(), tenant))
+		c.Next()
+	}
+}
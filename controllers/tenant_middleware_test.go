@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func performTenantRequest(principal *auth.Principal, tenant string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if principal != nil {
+			c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		}
+	}, ResolveTenant())
+	r.GET("/tenant", func(c *gin.Context) {
+		c.String(http.StatusOK, domain.TenantFrom(c.Request.Context()))
+	})
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/tenant", nil)
+	if tenant != "" {
+		req.Header.Set(auth.TenantHeader, tenant)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestResolveTenant(t *testing.T) {
+	rr := performTenantRequest(nil, "acme")
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, "acme", rr.Body.String())
+
+	rr = performTenantRequest(&auth.Principal{ID: "alice", TenantID: "acme"}, "")
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, "acme", rr.Body.String())
+
+	rr = performTenantRequest(&auth.Principal{ID: "alice", TenantID: "acme"}, "globex")
+	assert.EqualValues(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), auth.CodeTenantMismatch)
+
+	rr = performTenantRequest(nil, "not a tenant")
+	assert.EqualValues(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), auth.CodeInvalidTenant)
+}
@@ -0,0 +1,210 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/silvergama/efficientAPI/config"
+	"github.com/silvergama/efficientAPI/utils/error_formats"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+var (
+	APIKeyRepo APIKeyRepository = NewMemoryAPIKeyRepository()
+)
+
+const (
+	apiKeyColumns     = "id, name, principal_id, roles, secret_hash, created_at, rotated_at, revoked_at, tenant_id"
+	queryInsertAPIKey = "INSERT INTO api_keys(id, name, principal_id, roles, secret_hash, created_at, tenant_id) VALUES(?, ?, ?, ?, ?, ?, ?);"
+	queryGetAPIKey    = "SELECT " + apiKeyColumns + " FROM api_keys WHERE id=?;"
+	queryListAPIKeys  = "SELECT " + apiKeyColumns + " FROM api_keys ORDER BY created_at, id;"
+	queryRotateAPIKey = "UPDATE api_keys SET secret_hash=?, rotated_at=? WHERE id=? AND revoked_at IS NULL;"
+	queryRevokeAPIKey = "UPDATE api_keys SET revoked_at=? WHERE id=? AND revoked_at IS NULL;"
+)
+
+// CodeAPIKeyNotFound identifies the not found errors of the api keys, which
+// clients shouldn't mistake for a missing message.
+const CodeAPIKeyNotFound = "api_key_not_found"
+
+// APIKey lets a program authenticate as PrincipalID. Only the hash of its
+// secret is kept, the secret itself is shown once, when created or rotated.
+type APIKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	PrincipalID string     `json:"principal_id"`
+	Roles       []string   `json:"roles"`
+	SecretHash  string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RotatedAt   *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	// TenantID binds the key to a tenant, the key acting for no other.
+	TenantID string `json:"tenant_id,omitempty"`
+}
+
+// IssuedAPIKey is an APIKey along with the key handed to the client, as
+// answered once when the key is created or rotated.
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// Active tells whether the key still authenticates.
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil
+}
+
+// Validate trims the name and principal of k and checks them.
+func (k *APIKey) Validate() errorutils.MessageErr {
+	k.Name = strings.TrimSpace(k.Name)
+	k.PrincipalID = strings.TrimSpace(k.PrincipalID)
+	var violations []errorutils.FieldError
+	if k.Name == "" {
+		violations = append(violations, errorutils.FieldError{Field: "name", Code: CodeRequired, Message: "Please enter a name for the key"})
+	}
+	if k.PrincipalID == "" {
+		violations = append(violations, errorutils.FieldError{Field: "principal_id", Code: CodeRequired, Message: "Please enter the principal the key authenticates"})
+	}
+	if k.TenantID != "" && !ValidTenant(k.TenantID) {
+		violations = append(violations, errorutils.FieldError{Field: "tenant_id", Code: CodeForbiddenChar, Message: "tenant_id must be 1 to 64 letters, digits, - or _"})
+	}
+	for _, role := range k.Roles {
+		if role == "" || strings.Contains(role, ",") {
+			violations = append(violations, errorutils.FieldError{Field: "roles", Code: CodeForbiddenChar, Message: "roles must be non empty and hold no comma"})
+			break
+		}
+	}
+	return newValidationError(violations)
+}
+
+// NewAPIKeyNotFoundError is returned for the unknown, and on change the revoked, api keys.
+func NewAPIKeyNotFoundError(id string) errorutils.MessageErr {
+	return errorutils.WithCode(errorutils.NewNotFoundError(fmt.Sprintf("no active api key %q", id)), CodeAPIKeyNotFound)
+}
+
+// APIKeyRepository stores the api keys.
+type APIKeyRepository interface {
+	CreateAPIKey(context.Context, *APIKey) errorutils.MessageErr
+	// GetAPIKey returns the key id, revoked or not.
+	GetAPIKey(ctx context.Context, id string) (*APIKey, errorutils.MessageErr)
+	ListAPIKeys(context.Context) ([]APIKey, errorutils.MessageErr)
+	// RotateAPIKey replaces the secret hash of the active key id.
+	RotateAPIKey(ctx context.Context, id string, secretHash string, at time.Time) errorutils.MessageErr
+	RevokeAPIKey(ctx context.Context, id string, at time.Time) errorutils.MessageErr
+}
+
+// NewAPIKeyRepository returns the repository of the api keys stored in db,
+// a database of driver, or an in-memory one when db is nil.
+func NewAPIKeyRepository(db *sql.DB, driver string) APIKeyRepository {
+	if db == nil {
+		return NewMemoryAPIKeyRepository()
+	}
+	d := mysqlDialect
+	switch driver {
+	case config.SQLiteDriver:
+		d = sqliteDialect
+	case config.PostgresDriver:
+		d = postgresDialect
+	}
+	return &apiKeyRepo{db: db, dialect: d}
+}
+
+type apiKeyRepo struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func (r *apiKeyRepo) CreateAPIKey(ctx context.Context, key *APIKey) errorutils.MessageErr {
+	_, err := r.db.ExecContext(ctx, r.dialect.rebind(queryInsertAPIKey),
+		key.ID, key.Name, key.PrincipalID, strings.Join(key.Roles, ","), key.SecretHash, key.CreatedAt, key.TenantID)
+	if err != nil {
+		return error_formats.ParseError(err)
+	}
+	return nil
+}
+
+func (r *apiKeyRepo) GetAPIKey(ctx context.Context, id string) (*APIKey, errorutils.MessageErr) {
+	var key APIKey
+	if err := scanAPIKey(r.db.QueryRowContext(ctx, r.dialect.rebind(queryGetAPIKey), id), &key); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewAPIKeyNotFoundError(id)
+		}
+		return nil, error_formats.ParseError(err)
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepo) ListAPIKeys(ctx context.Context) ([]APIKey, errorutils.MessageErr) {
+	rows, err := r.db.QueryContext(ctx, queryListAPIKeys)
+	if err != nil {
+		return nil, error_formats.ParseError(err)
+	}
+	defer rows.Close()
+
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		var key APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			return nil, error_formats.ParseError(err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, error_formats.ParseError(err)
+	}
+	return keys, nil
+}
+
+func (r *apiKeyRepo) RotateAPIKey(ctx context.Context, id string, secretHash string, at time.Time) errorutils.MessageErr {
+	return r.change(ctx, id, queryRotateAPIKey, secretHash, at, id)
+}
+
+func (r *apiKeyRepo) RevokeAPIKey(ctx context.Context, id string, at time.Time) errorutils.MessageErr {
+	return r.change(ctx, id, queryRevokeAPIKey, at, id)
+}
+
+// change runs query on the active key id, reporting a not found error when
+// there is none.
+func (r *apiKeyRepo) change(ctx context.Context, id string, query string, args ...interface{}) errorutils.MessageErr {
+	result, err := r.db.ExecContext(ctx, r.dialect.rebind(query), args...)
+	if err != nil {
+		return error_formats.ParseError(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return error_formats.ParseError(err)
+	}
+	if affected == 0 {
+		return NewAPIKeyNotFoundError(id)
+	}
+	return nil
+}
+
+// scanAPIKey reads a row selected with apiKeyColumns.
+func scanAPIKey(row rowScanner, key *APIKey) error {
+	var (
+		roles                string
+		rotatedAt, revokedAt sql.NullTime
+	)
+	if err := row.Scan(&key.ID, &key.Name, &key.PrincipalID, &roles, &key.SecretHash, &key.CreatedAt, &rotatedAt, &revokedAt, &key.TenantID); err != nil {
+		return err
+	}
+	key.Roles = splitRoles(roles)
+	key.RotatedAt, key.RevokedAt = nil, nil
+	if rotatedAt.Valid {
+		key.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return nil
+}
+
+func splitRoles(roles string) []string {
+	if roles == "" {
+		return []string{}
+	}
+	return strings.Split(roles, ",")
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// memoryAPIKeyRepo is an APIKeyRepository kept in process memory, for the
+// in-memory driver and the tests.
+type memoryAPIKeyRepo struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+func NewMemoryAPIKeyRepository() APIKeyRepository {
+	return &memoryAPIKeyRepo{keys: make(map[string]APIKey)}
+}
+
+func (r *memoryAPIKeyRepo) CreateAPIKey(ctx context.Context, key *APIKey) errorutils.MessageErr {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[key.ID]; ok {
+		return errorutils.NewConflictError("an api key with this id already exists")
+	}
+	stored := *key
+	stored.Roles = append([]string{}, key.Roles...)
+	r.keys[key.ID] = stored
+	return nil
+}
+
+func (r *memoryAPIKeyRepo) GetAPIKey(ctx context.Context, id string) (*APIKey, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, NewAPIKeyNotFoundError(id)
+	}
+	return &key, nil
+}
+
+func (r *memoryAPIKeyRepo) ListAPIKeys(ctx context.Context) ([]APIKey, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (r *memoryAPIKeyRepo) RotateAPIKey(ctx context.Context, id string, secretHash string, at time.Time) errorutils.MessageErr {
+	return r.change(ctx, id, func(key *APIKey) {
+		key.SecretHash = secretHash
+		key.RotatedAt = &at
+	})
+}
+
+func (r *memoryAPIKeyRepo) RevokeAPIKey(ctx context.Context, id string, at time.Time) errorutils.MessageErr {
+	return r.change(ctx, id, func(key *APIKey) {
+		key.RevokedAt = &at
+	})
+}
+
+// change applies fn to the active key id.
+func (r *memoryAPIKeyRepo) change(ctx context.Context, id string, fn func(*APIKey)) errorutils.MessageErr {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || !key.Active() {
+		return NewAPIKeyNotFoundError(id)
+	}
+	fn(&key)
+	r.keys[id] = key
+	return nil
+}
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAPIKeyRepository runs the behavior every APIKeyRepository shares.
+func testAPIKeyRepository(t *testing.T, repo APIKeyRepository) {
+	ctx := context.Background()
+	tm := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	err := repo.CreateAPIKey(ctx, &APIKey{ID: "k2", Name: "ci", PrincipalID: "robot", Roles: []string{}, SecretHash: "hash2", CreatedAt: tm.Add(time.Minute)})
+	assert.Nil(t, err)
+	err = repo.CreateAPIKey(ctx, &APIKey{ID: "k1", Name: "admin", PrincipalID: "alice", Roles: []string{"admin", "editor"}, SecretHash: "hash1", CreatedAt: tm, TenantID: "acme"})
+	assert.Nil(t, err)
+
+	key, err := repo.GetAPIKey(ctx, "k1")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "alice", key.PrincipalID)
+	assert.EqualValues(t, []string{"admin", "editor"}, key.Roles)
+	assert.EqualValues(t, "hash1", key.SecretHash)
+	assert.EqualValues(t, "acme", key.TenantID)
+	assert.True(t, key.CreatedAt.Equal(tm))
+	assert.True(t, key.Active())
+
+	keys, err := repo.ListAPIKeys(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(keys))
+	assert.EqualValues(t, "k1", keys[0].ID)
+	assert.EqualValues(t, []string{}, keys[1].Roles)
+	assert.EqualValues(t, "", keys[1].TenantID)
+
+	err = repo.RotateAPIKey(ctx, "k1", "hash1b", tm.Add(time.Hour))
+	assert.Nil(t, err)
+	key, _ = repo.GetAPIKey(ctx, "k1")
+	assert.EqualValues(t, "hash1b", key.SecretHash)
+	assert.NotNil(t, key.RotatedAt)
+
+	err = repo.RevokeAPIKey(ctx, "k1", tm.Add(2*time.Hour))
+	assert.Nil(t, err)
+	key, err = repo.GetAPIKey(ctx, "k1")
+	assert.Nil(t, err)
+	assert.False(t, key.Active())
+
+	for _, err := range []errorutils.MessageErr{
+		repo.RotateAPIKey(ctx, "k1", "hash1c", tm),
+		repo.RevokeAPIKey(ctx, "k1", tm),
+		repo.RevokeAPIKey(ctx, "missing", tm),
+	} {
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusNotFound, err.Status())
+		assert.EqualValues(t, CodeAPIKeyNotFound, err.Code())
+	}
+	_, err = repo.GetAPIKey(ctx, "missing")
+	assert.EqualValues(t, CodeAPIKeyNotFound, err.Code())
+}
+
+func TestMemoryAPIKeyRepo(t *testing.T) {
+	testAPIKeyRepository(t, NewMemoryAPIKeyRepository())
+}
+
+func TestAPIKey_Validate(t *testing.T) {
+	key := APIKey{Name: "  ci ", PrincipalID: " robot "}
+	assert.Nil(t, key.Validate())
+	assert.EqualValues(t, "ci", key.Name)
+	assert.EqualValues(t, "robot", key.PrincipalID)
+
+	err := (&APIKey{Roles: []string{"a,b"}}).Validate()
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusUnprocessableEntity, err.Status())
+	assert.EqualValues(t, 3, len(err.Details()))
+}
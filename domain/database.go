@@ -0,0 +1,225 @@
+package domain
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/silvergama/efficientAPI/config"
+)
+
+// mysqlTLSConfig is the name the TLS settings are registered under for the MySQL driver.
+const mysqlTLSConfig = "messages"
+
+// OpenMessageRepository returns the repository of cfg.Driver, connected to
+// its database by OpenDatabase. The schema is left to the migrations, whatever
+// the driver. The *sql.DB is nil for the in-memory driver.
+func OpenMessageRepository(ctx context.Context, cfg config.DBConfig) (messageRepoInterface, *sql.DB, error) {
+	var newRepo func(*sql.DB) messageRepoInterface
+	switch cfg.Driver {
+	case config.MemoryDriver:
+		return NewMemoryMessageRepository(), nil, nil
+	case config.SQLiteDriver:
+		newRepo = NewSQLiteMessageRepository
+	case config.PostgresDriver:
+		newRepo = NewPostgresMessageRepository
+	case "mysql":
+		newRepo = NewMessageRepository
+	default:
+		return nil, nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+
+	db, err := OpenDatabase(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newRepo(db), db, nil
+}
+
+// OpenDatabase connects to the database of cfg.Driver, leaving its schema
+// as it is. The database is pinged until it answers, cfg.PingAttempts times
+// at most, so a wrong address or password fails here rather than on the
+// first request. The *sql.DB is nil for the in-memory driver.
+func OpenDatabase(ctx context.Context, cfg config.DBConfig) (*sql.DB, error) {
+	var (
+		driver, dsn string
+		err         error
+	)
+	switch cfg.Driver {
+	case config.MemoryDriver:
+		return nil, nil
+	case config.SQLiteDriver:
+		driver, dsn = "sqlite3", cfg.Name
+	case config.PostgresDriver:
+		driver = "postgres"
+		dsn, err = postgresDSN(cfg)
+	case "mysql":
+		driver = "mysql"
+		dsn, err = mysqlDSN(cfg)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the %s database: %v", driver, err)
+	}
+	configurePool(db, cfg)
+	if err := pingWithRetry(ctx, db, cfg); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to the %s database: %w", driver, err)
+	}
+	return db, nil
+}
+
+func configurePool(db *sql.DB, cfg config.DBConfig) {
+	if cfg.Driver == config.SQLiteDriver {
+		// SQLite allows a single writer, and every connection to ":memory:" is
+		// a different database, so stick to one connection.
+		db.SetMaxOpenConns(1)
+		return
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// pingWithRetry pings db until it answers, doubling the wait between two
+// attempts, and returns the last error when it never does.
+func pingWithRetry(ctx context.Context, db *sql.DB, cfg config.DBConfig) error {
+	attempts := cfg.PingAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := cfg.PingBackoff
+	for attempt := 1; ; attempt++ {
+		err := ping(ctx, db, cfg.ConnectTimeout)
+		if err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			return fmt.Errorf("no answer after %d attempts: %w", attempts, err)
+		}
+		log.Printf("the database didn't answer (attempt %d of %d), retrying in %s: %v", attempt, attempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func ping(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return db.PingContext(ctx)
+}
+
+func mysqlDSN(cfg config.DBConfig) (string, error) {
+	c := mysql.NewConfig()
+	c.User = cfg.User
+	c.Passwd = cfg.Password
+	c.Net = "tcp"
+	c.Addr = net.JoinHostPort(cfg.Host, cfg.Port)
+	c.DBName = cfg.Name
+	c.Params = map[string]string{"charset": "utf8mb4"}
+	c.ParseTime = true
+	c.Loc = time.Local
+	c.Timeout = cfg.ConnectTimeout
+	c.ReadTimeout = cfg.ReadTimeout
+	c.WriteTimeout = cfg.WriteTimeout
+
+	switch cfg.TLS.Mode {
+	case "", config.TLSDisable:
+		return c.FormatDSN(), nil
+	}
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	if err := mysql.RegisterTLSConfig(mysqlTLSConfig, tlsConfig); err != nil {
+		return "", err
+	}
+	c.TLSConfig = mysqlTLSConfig
+	return c.FormatDSN(), nil
+}
+
+// newTLSConfig builds the TLS settings of the MySQL driver, which takes
+// them as a *tls.Config rather than as options of the DSN.
+func newTLSConfig(cfg config.DBConfig) (*tls.Config, error) {
+	c := &tls.Config{
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.TLS.Mode == config.TLSRequire,
+	}
+	if c.ServerName == "" {
+		c.ServerName = cfg.Host
+	}
+	if cfg.TLS.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the db tls ca: %v", err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in the db tls ca")
+		}
+	}
+	if cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the db tls certificate: %v", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// postgresDSN writes cfg as a libpq URL. Without a TLS mode, TLS follows the
+// libpq defaults and PGSSLMODE. lib/pq has no read or write timeouts.
+func postgresDSN(cfg config.DBConfig) (string, error) {
+	query := url.Values{}
+	if cfg.TLS.Mode != "" {
+		query.Set("sslmode", cfg.TLS.Mode)
+	}
+	if cfg.TLS.CAFile != "" {
+		query.Set("sslrootcert", cfg.TLS.CAFile)
+	}
+	if cfg.TLS.CertFile != "" {
+		query.Set("sslcert", cfg.TLS.CertFile)
+		query.Set("sslkey", cfg.TLS.KeyFile)
+	}
+	if cfg.ConnectTimeout > 0 {
+		// in whole seconds, and at least one since 0 means for ever
+		seconds := int(cfg.ConnectTimeout / time.Second)
+		if seconds < 1 {
+			seconds = 1
+		}
+		query.Set("connect_timeout", strconv.Itoa(seconds))
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     "/" + cfg.Name,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String(), nil
+}
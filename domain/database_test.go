@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/silvergama/efficientAPI/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMessageRepository_Unreachable(t *testing.T) {
+	cfg := config.DBConfig{
+		Driver:         "mysql",
+		User:           "username",
+		Password:       "password",
+		Host:           "127.0.0.1",
+		Port:           "1",
+		Name:           "database",
+		ConnectTimeout: time.Second,
+		PingAttempts:   2,
+		PingBackoff:    time.Millisecond,
+	}
+	repo, db, err := OpenMessageRepository(context.Background(), cfg)
+	assert.Nil(t, repo)
+	assert.Nil(t, db)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no answer after 2 attempts")
+
+	cfg.Driver = "oracle"
+	_, _, err = OpenMessageRepository(context.Background(), cfg)
+	assert.EqualValues(t, `unknown database driver "oracle"`, err.Error())
+}
+
+func TestMysqlDSN(t *testing.T) {
+	dsn, err := mysqlDSN(config.DBConfig{
+		User:           "root",
+		Password:       "secret",
+		Host:           "db.internal",
+		Port:           "3306",
+		Name:           "efficient",
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    30 * time.Second,
+		TLS:            config.TLSConfig{Mode: config.TLSRequire},
+	})
+	assert.Nil(t, err)
+
+	c, err := mysql.ParseDSN(dsn)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "root", c.User)
+	assert.EqualValues(t, "db.internal:3306", c.Addr)
+	assert.EqualValues(t, "efficient", c.DBName)
+	assert.True(t, c.ParseTime)
+	assert.EqualValues(t, "utf8mb4", c.Params["charset"])
+	assert.EqualValues(t, 5*time.Second, c.Timeout)
+	assert.EqualValues(t, 30*time.Second, c.ReadTimeout)
+	assert.EqualValues(t, 0, c.WriteTimeout)
+	assert.EqualValues(t, mysqlTLSConfig, c.TLSConfig)
+
+	_, err = mysqlDSN(config.DBConfig{TLS: config.TLSConfig{Mode: config.TLSVerifyFull, CAFile: "/does/not/exist.pem"}})
+	assert.NotNil(t, err)
+}
+
+func TestPostgresDSN(t *testing.T) {
+	dsn, err := postgresDSN(config.DBConfig{
+		User:           "postgres",
+		Password:       "p@ss",
+		Host:           "db.internal",
+		Port:           "5432",
+		Name:           "efficient",
+		ConnectTimeout: 500 * time.Millisecond,
+		TLS:            config.TLSConfig{Mode: config.TLSVerifyFull, CAFile: "/etc/ssl/ca.pem"},
+	})
+	assert.Nil(t, err)
+
+	u, err := url.Parse(dsn)
+	assert.Nil(t, err)
+	password, _ := u.User.Password()
+	assert.EqualValues(t, "p@ss", password)
+	assert.EqualValues(t, "db.internal:5432", u.Host)
+	assert.EqualValues(t, "/efficient", u.Path)
+	assert.EqualValues(t, url.Values{
+		"sslmode":         {"verify-full"},
+		"sslrootcert":     {"/etc/ssl/ca.pem"},
+		"connect_timeout": {"1"},
+	}, u.Query())
+
+	// no mode keeps the libpq default
+	dsn, _ = postgresDSN(config.DBConfig{Host: "localhost", Port: "5432", Name: "efficient"})
+	u, _ = url.Parse(dsn)
+	assert.Empty(t, u.Query().Get("sslmode"))
+}
+
+func TestPingWithRetry(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing()
+	assert.Nil(t, pingWithRetry(context.Background(), db, config.DBConfig{PingAttempts: 3, PingBackoff: time.Millisecond}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotNil(t, pingWithRetry(ctx, db, config.DBConfig{PingAttempts: 3, PingBackoff: time.Hour}))
+}
+
+func TestCheckHealth(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	repo := NewMessageRepository(db)
+
+	mock.ExpectPing()
+	health := CheckHealth(context.Background(), repo)
+	assert.EqualValues(t, HealthOK, health.Status)
+	assert.NotNil(t, health.Pool)
+	assert.EqualValues(t, 1, health.Pool.OpenConnections)
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	health = CheckHealth(context.Background(), NewCachedMessageRepository(repo, NewLRUCacheStore(1), time.Minute))
+	assert.EqualValues(t, HealthUnavailable, health.Status)
+	assert.EqualValues(t, "connection refused", health.Error)
+	assert.NotNil(t, health.Pool)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	health = CheckHealth(context.Background(), NewMemoryMessageRepository())
+	assert.EqualValues(t, &Health{Status: HealthOK}, health)
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+)
+
+// dialect captures what differs between the SQL databases messageRepo runs
+// on. Queries are written with "?" placeholders and rebound before use. The
+// zero value is the MySQL dialect.
+type dialect struct {
+	// numbered placeholders ($1, $2...) instead of "?"
+	numberedPlaceholders bool
+	// INSERT statements report the new id through RETURNING instead of LastInsertId
+	returningID bool
+	// searches go through LIKE, there is no FULLTEXT index to match against
+	likeSearch bool
+	// INSERT skips the rows breaking a unique key with ON CONFLICT DO NOTHING
+	// instead of INSERT IGNORE
+	onConflict bool
+	// SELECT ... FOR UPDATE locks the rows read, SQLite having no row locks
+	// to take: its writers wait on the database lock instead
+	rowLocks bool
+}
+
+var (
+	mysqlDialect    = dialect{rowLocks: true}
+	sqliteDialect   = dialect{likeSearch: true, onConflict: true}
+	postgresDialect = dialect{numberedPlaceholders: true, returningID: true, likeSearch: true, onConflict: true, rowLocks: true}
+)
+
+// rebind rewrites the "?" placeholders of query for the dialect. Our queries
+// never hold a "?" inside a string literal, so no parsing is needed.
+func (d dialect) rebind(query string) string {
+	if !d.numberedPlaceholders {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// insert turns an INSERT statement into one returning the new id, when the
+// dialect reports ids that way.
+func (d dialect) insert(query string) string {
+	query = d.rebind(query)
+	if !d.returningID {
+		return query
+	}
+	return strings.TrimSuffix(query, ";") + " RETURNING id;"
+}
+
+// insertIgnore turns an INSERT statement into one skipping the rows which
+// would break a unique key, instead of failing.
+func (d dialect) insertIgnore(query string) string {
+	query = d.rebind(query)
+	if !d.onConflict {
+		return strings.Replace(query, "INSERT INTO", "INSERT IGNORE INTO", 1)
+	}
+	return strings.TrimSuffix(query, ";") + " ON CONFLICT DO NOTHING;"
+}
+
+// lock turns a SELECT statement into one locking the rows it reads until the
+// end of the transaction, when the dialect can.
+func (d dialect) lock(query string) string {
+	query = d.rebind(query)
+	if !d.rowLocks {
+		return query
+	}
+	return strings.TrimSuffix(query, ";") + " FOR UPDATE;"
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+)
+
+// The statuses of a Health.
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// PoolStats is the state of the connection pool of the database, from sql.DBStats.
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+func newPoolStats(s sql.DBStats) *PoolStats {
+	return &PoolStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMs:     s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
+
+// Health tells whether the database of a repository answers. Pool is nil
+// for the repositories without one.
+type Health struct {
+	Status string     `json:"status"`
+	Error  string     `json:"error,omitempty"`
+	Pool   *PoolStats `json:"pool,omitempty"`
+}
+
+// pooled is implemented by the repositories running on a *sql.DB.
+type pooled interface {
+	DB() *sql.DB
+}
+
+// DB returns the database the repository runs on.
+func (mr *messageRepo) DB() *sql.DB {
+	return mr.db
+}
+
+// DB returns the database of the cached repository, nil when it has none.
+func (r *CachedMessageRepository) DB() *sql.DB {
+	if p, ok := r.messageRepoInterface.(pooled); ok {
+		return p.DB()
+	}
+	return nil
+}
+
+// CheckHealth pings the database of repo, the in-memory repository being
+// always healthy.
+func CheckHealth(ctx context.Context, repo MessageRepository) *Health {
+	health := &Health{Status: HealthOK}
+	p, ok := repo.(pooled)
+	if !ok || p.DB() == nil {
+		return health
+	}
+	db := p.DB()
+	if err := db.PingContext(ctx); err != nil {
+		health.Status = HealthUnavailable
+		health.Error = err.Error()
+	}
+	health.Pool = newPoolStats(db.Stats())
+	return health
+}
@@ -0,0 +1,343 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/silvergama/efficientAPI/utils/error_formats"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// batchChunkSize bounds the rows of a multi-row statement, keeping it under
+// the placeholder limits of every database.
+const batchChunkSize = 500
+
+const (
+	queryInsertMessagesPrefix  = "INSERT INTO messages(title, body, created_at, version, author_id, tenant_id) VALUES "
+	queryInsertRevisionsPrefix = "INSERT INTO message_revisions(message_id, version, title, body, action, created_at) VALUES "
+	queryUpdateAnyVersion      = "UPDATE messages SET title=?, body=?, version=version+1 WHERE id=? AND tenant_id=? AND deleted_at IS NULL;"
+	queryDeleteMessages        = "UPDATE messages SET deleted_at=? WHERE tenant_id=? AND deleted_at IS NULL AND id IN (%s);"
+	queryGetLiveMessages       = "SELECT " + messageColumns + " FROM messages WHERE tenant_id=? AND deleted_at IS NULL AND id IN (%s);"
+
+	querySavepoint           = "SAVEPOINT batch_item;"
+	queryRollbackToSavepoint = "ROLLBACK TO SAVEPOINT batch_item;"
+	queryReleaseSavepoint    = "RELEASE SAVEPOINT batch_item;"
+)
+
+// BatchResult is the outcome of one item of a batch, Index being its
+// position in the request.
+type BatchResult struct {
+	Index   int                   `json:"index"`
+	ID      int64                 `json:"id,omitempty"`
+	Message *Message              `json:"message,omitempty"`
+	Error   errorutils.MessageErr `json:"error,omitempty"`
+}
+
+// BatchReport tells which items of a batch went through and why the others didn't.
+type BatchReport struct {
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+func NewBatchReport(size int) *BatchReport {
+	return &BatchReport{Results: make([]BatchResult, size)}
+}
+
+func (r *BatchReport) Succeed(index int, id int64, msg *Message) {
+	r.Results[index] = BatchResult{Index: index, ID: id, Message: msg}
+	r.Succeeded++
+}
+
+func (r *BatchReport) Fail(index int, id int64, err errorutils.MessageErr) {
+	r.Results[index] = BatchResult{Index: index, ID: id, Error: err}
+	r.Failed++
+}
+
+// CreateMessages inserts msgs in chunks in a single transaction, see insertMessages.
+// The returned errors match msgs one to one, the items of a chunk the
+// database refused being retried one by one to tell the culprits apart.
+func (mr *messageRepo) CreateMessages(ctx context.Context, msgs []*Message) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	errs := make([]errorutils.MessageErr, len(msgs))
+	err := mr.inTx(ctx, func(tx *sql.Tx) errorutils.MessageErr {
+		for start := 0; start < len(msgs); start += batchChunkSize {
+			end := start + batchChunkSize
+			if end > len(msgs) {
+				end = len(msgs)
+			}
+			chunk := msgs[start:end]
+			chunkErr := withSavepoint(ctx, tx, func() errorutils.MessageErr {
+				return mr.insertMessages(ctx, tx, chunk)
+			})
+			if chunkErr == nil {
+				continue
+			}
+			for i, msg := range chunk {
+				errs[start+i] = withSavepoint(ctx, tx, func() errorutils.MessageErr {
+					msgId, err := mr.insertMessage(ctx, tx, msg)
+					if err != nil {
+						return err
+					}
+					msg.ID = msgId
+					if err := mr.saveTags(ctx, tx, msg.TenantID, msg); err != nil {
+						return err
+					}
+					return mr.insertRevision(ctx, tx, msg, RevisionCreate, msg.CreatedAt)
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// insertMessages writes msgs and their first revision. The messages go to
+// the tenant of ctx.
+func (mr *messageRepo) insertMessages(ctx context.Context, tx *sql.Tx, msgs []*Message) errorutils.MessageErr {
+	tenant := TenantFrom(ctx)
+	for _, msg := range msgs {
+		msg.Version = 1
+		msg.TenantID = tenant
+	}
+	if err := mr.insertMessageRows(ctx, tx, msgs); err != nil {
+		return err
+	}
+	if err := mr.saveTags(ctx, tx, tenant, msgs...); err != nil {
+		return err
+	}
+
+	return insertRevisions(ctx, tx, mr.dialect, msgs, RevisionCreate, time.Time{})
+}
+
+// insertMessageRows inserts msgs and sets their IDs. The dialects returning
+// ids do it with a single statement, the rows of its RETURNING following
+// those of its VALUES. The others insert row by row, LastInsertId only
+// telling the first id of a multi-row INSERT, the next ones not always
+// following it.
+func (mr *messageRepo) insertMessageRows(ctx context.Context, tx *sql.Tx, msgs []*Message) errorutils.MessageErr {
+	if !mr.dialect.returningID {
+		for _, msg := range msgs {
+			msgId, err := mr.insertMessage(ctx, tx, msg)
+			if err != nil {
+				return err
+			}
+			msg.ID = msgId
+		}
+		return nil
+	}
+
+	args := make([]interface{}, 0, 6*len(msgs))
+	for _, msg := range msgs {
+		args = append(args, msg.Title, msg.Body, msg.CreatedAt, msg.Version, nullString(msg.AuthorID), msg.TenantID)
+	}
+	query := queryInsertMessagesPrefix + placeholders(len(msgs), 6) + ";"
+	rows, err := tx.QueryContext(ctx, mr.dialect.insert(query), args...)
+	if err != nil {
+		return error_formats.ParseError(err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		if n == len(msgs) {
+			return errorutils.NewInternalServerError("error trying to save messages: more ids than messages")
+		}
+		if err := rows.Scan(&msgs[n].ID); err != nil {
+			return errorutils.NewInternalServerError(fmt.Sprintf("error trying to save messages %s", err.Error()))
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return error_formats.ParseError(err)
+	}
+	if n != len(msgs) {
+		return errorutils.NewInternalServerError(fmt.Sprintf("error trying to save messages: %d ids for %d messages", n, len(msgs)))
+	}
+	return nil
+}
+
+// UpdateMessages applies every update of msgs in a single transaction,
+// each of them standing or failing on its own. A zero Version overwrites
+// whatever version is stored, otherwise it works as in Update. The messages
+// are refreshed with their stored values, tags included.
+func (mr *messageRepo) UpdateMessages(ctx context.Context, msgs []*Message) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	errs := make([]errorutils.MessageErr, len(msgs))
+	err := mr.inTx(ctx, func(tx *sql.Tx) errorutils.MessageErr {
+		versioned, err := mr.prepared(ctx, tx, mr.dialect.rebind(queryUpdateMessge))
+		if err != nil {
+			return errorutils.NewInternalServerError(fmt.Sprintf("error when trying to prepare messages to update %s", err.Error()))
+		}
+		unversioned, err := mr.prepared(ctx, tx, mr.dialect.rebind(queryUpdateAnyVersion))
+		if err != nil {
+			return errorutils.NewInternalServerError(fmt.Sprintf("error when trying to prepare messages to update %s", err.Error()))
+		}
+
+		now := time.Now()
+		tenant := TenantFrom(ctx)
+		for i, msg := range msgs {
+			errs[i] = withSavepoint(ctx, tx, func() errorutils.MessageErr {
+				var (
+					result sql.Result
+					err    error
+				)
+				if msg.Version == 0 {
+					result, err = unversioned.ExecContext(ctx, msg.Title, msg.Body, msg.ID, tenant)
+				} else {
+					result, err = versioned.ExecContext(ctx, msg.Title, msg.Body, msg.ID, tenant, msg.Version)
+				}
+				if err != nil {
+					return error_formats.ParseError(err)
+				}
+				affected, err := result.RowsAffected()
+				if err != nil {
+					return errorutils.NewInternalServerError(fmt.Sprintf("error trying to update message %s", err.Error()))
+				}
+				if affected == 0 && msg.Version != 0 {
+					return NewVersionConflictError(msg.ID)
+				}
+				if affected == 0 {
+					return error_formats.NewNotFoundError()
+				}
+				if err := mr.saveTags(ctx, tx, tenant, msg); err != nil {
+					return err
+				}
+				stored, snapErr := mr.snapshotRevision(ctx, tx, msg.ID, RevisionUpdate, now)
+				if snapErr != nil {
+					return snapErr
+				}
+				*msg = *stored
+				return mr.loadTags(ctx, tx, msg)
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// DeleteMessages soft deletes the messages of msgIds in a single
+// transaction, the missing or already deleted ones failing with not found.
+// The live messages are read, and locked where the database can, before
+// being deleted by id.
+func (mr *messageRepo) DeleteMessages(ctx context.Context, msgIds []int64) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	deleted := make(map[int64]bool, len(msgIds))
+	err := mr.inTx(ctx, func(tx *sql.Tx) errorutils.MessageErr {
+		now := time.Now()
+		tenant := TenantFrom(ctx)
+		for start := 0; start < len(msgIds); start += batchChunkSize {
+			end := start + batchChunkSize
+			if end > len(msgIds) {
+				end = len(msgIds)
+			}
+			ids := make([]interface{}, 0, end-start)
+			for _, id := range msgIds[start:end] {
+				ids = append(ids, id)
+			}
+
+			query := mr.dialect.lock(fmt.Sprintf(queryGetLiveMessages, placeholders(len(ids), 1)))
+			rows, err := tx.QueryContext(ctx, query, append([]interface{}{tenant}, ids...)...)
+			if err != nil {
+				return error_formats.ParseError(err)
+			}
+			msgs := make([]*Message, 0, len(ids))
+			for rows.Next() {
+				var msg Message
+				if err := scanMessage(rows, &msg); err != nil {
+					rows.Close()
+					return errorutils.NewInternalServerError(fmt.Sprintf("error trying to delete messages %s", err.Error()))
+				}
+				msgs = append(msgs, &msg)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return error_formats.ParseError(err)
+			}
+			if len(msgs) == 0 {
+				continue
+			}
+
+			args := make([]interface{}, 0, len(msgs)+2)
+			args = append(args, now, tenant)
+			for _, msg := range msgs {
+				args = append(args, msg.ID)
+			}
+			query = mr.dialect.rebind(fmt.Sprintf(queryDeleteMessages, placeholders(len(msgs), 1)))
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				return error_formats.ParseError(err)
+			}
+			if err := insertRevisions(ctx, tx, mr.dialect, msgs, RevisionDelete, now); err != nil {
+				return err
+			}
+			for _, msg := range msgs {
+				deleted[msg.ID] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]errorutils.MessageErr, len(msgIds))
+	for i, id := range msgIds {
+		if !deleted[id] {
+			errs[i] = error_formats.NewNotFoundError()
+		}
+		// an ID given twice is only deleted once
+		delete(deleted, id)
+	}
+	return errs, nil
+}
+
+// insertRevisions records msgs with a single statement. A zero at stands for
+// the creation time of each message.
+func insertRevisions(ctx context.Context, tx *sql.Tx, d dialect, msgs []*Message, action RevisionAction, at time.Time) errorutils.MessageErr {
+	args := make([]interface{}, 0, 6*len(msgs))
+	for _, msg := range msgs {
+		when := at
+		if when.IsZero() {
+			when = msg.CreatedAt
+		}
+		args = append(args, msg.ID, msg.Version, msg.Title, msg.Body, action, when)
+	}
+	query := queryInsertRevisionsPrefix + placeholders(len(msgs), 6) + ";"
+	if _, err := tx.ExecContext(ctx, d.rebind(query), args...); err != nil {
+		return error_formats.ParseError(err)
+	}
+	return nil
+}
+
+// withSavepoint undoes what fn did in tx when it fails, leaving the rest of
+// the transaction usable, which Postgres requires after an error.
+func withSavepoint(ctx context.Context, tx *sql.Tx, fn func() errorutils.MessageErr) errorutils.MessageErr {
+	if _, err := tx.ExecContext(ctx, querySavepoint); err != nil {
+		return error_formats.ParseError(err)
+	}
+	if err := fn(); err != nil {
+		if _, rollbackErr := tx.ExecContext(ctx, queryRollbackToSavepoint); rollbackErr != nil {
+			return error_formats.ParseError(rollbackErr)
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, queryReleaseSavepoint); err != nil {
+		return error_formats.ParseError(err)
+	}
+	return nil
+}
+
+// placeholders returns the "(?, ?), (?, ?)" list of rows tuples of cols
+// values, or the plain "?, ?" list of an IN when cols is 1.
+func placeholders(rows, cols int) string {
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", cols), ", ") + ")"
+	if cols == 1 {
+		tuple = "?"
+	}
+	return strings.TrimSuffix(strings.Repeat(tuple+", ", rows), ", ")
+}
@@ -0,0 +1,229 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaceholders(t *testing.T) {
+	assert.EqualValues(t, "?", placeholders(1, 1))
+	assert.EqualValues(t, "?, ?, ?", placeholders(3, 1))
+	assert.EqualValues(t, "(?, ?)", placeholders(1, 2))
+	assert.EqualValues(t, "(?, ?), (?, ?)", placeholders(2, 2))
+}
+
+func TestBatchReport(t *testing.T) {
+	report := NewBatchReport(2)
+	report.Fail(1, 0, NewVersionConflictError(2))
+	report.Succeed(0, 1, &Message{ID: 1})
+	assert.EqualValues(t, 1, report.Succeeded)
+	assert.EqualValues(t, 1, report.Failed)
+	assert.EqualValues(t, 1, report.Results[1].Index)
+	assert.EqualValues(t, http.StatusConflict, report.Results[1].Error.Status())
+}
+
+func TestMessageRepo_CreateMessages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+
+	// the ids of the rows of the chunk come from their LastInsertId, the
+	// revisions going with a single statement
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO messages").WithArgs("first", "body", created_at, 1, "alice", "").WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectExec("INSERT INTO messages").WithArgs("second", "body", created_at, 1, nil, "").WillReturnResult(sqlmock.NewResult(8, 1))
+	mock.ExpectExec("INSERT INTO message_revisions").
+		WithArgs(7, 1, "first", "body", RevisionCreate, created_at, 8, 1, "second", "body", RevisionCreate, created_at).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectExec("RELEASE SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	msgs := []*Message{
+		{Title: "first", Body: "body", CreatedAt: created_at, AuthorID: "alice"},
+		{Title: "second", Body: "body", CreatedAt: created_at},
+	}
+	errs, batchErr := s.CreateMessages(context.Background(), msgs)
+	assert.Nil(t, batchErr)
+	assert.EqualValues(t, []interface{}{nil, nil}, []interface{}{errs[0], errs[1]})
+	assert.EqualValues(t, 7, msgs[0].ID)
+	assert.EqualValues(t, 8, msgs[1].ID)
+
+	// item by item once the chunk is refused
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO messages").WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '-taken' for key 'uq_messages_tenant_title'"})
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO messages").WithArgs("first", "body", created_at, 1, "alice", "").WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectExec("INSERT INTO message_revisions").WithArgs(9, 1, "first", "body", RevisionCreate, created_at).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO messages").WithArgs("taken", "body", created_at, 1, nil, "").WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '-taken' for key 'uq_messages_tenant_title'"})
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT batch_item").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	msgs = []*Message{
+		{Title: "first", Body: "body", CreatedAt: created_at, AuthorID: "alice"},
+		{Title: "taken", Body: "body", CreatedAt: created_at},
+	}
+	errs, batchErr = s.CreateMessages(context.Background(), msgs)
+	assert.Nil(t, batchErr)
+	assert.Nil(t, errs[0])
+	assert.EqualValues(t, 9, msgs[0].ID)
+	if assert.NotNil(t, errs[1]) {
+		assert.EqualValues(t, "title already taken", errs[1].Message())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresMessageRepo_CreateMessages(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPreparedExact(mock, postgresDialect)
+	s := NewPostgresMessageRepository(db)
+
+	// a single statement for the whole chunk, its ids following its rows
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT batch_item;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INSERT INTO messages(title, body, created_at, version, author_id, tenant_id) VALUES ($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12) RETURNING id;").
+		WithArgs("first", "body", created_at, 1, "alice", "", "second", "body", created_at, 1, nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7).AddRow(8))
+	mock.ExpectExec("INSERT INTO message_revisions(message_id, version, title, body, action, created_at) VALUES ($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12);").
+		WithArgs(7, 1, "first", "body", RevisionCreate, created_at, 8, 1, "second", "body", RevisionCreate, created_at).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("RELEASE SAVEPOINT batch_item;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	msgs := []*Message{
+		{Title: "first", Body: "body", CreatedAt: created_at, AuthorID: "alice"},
+		{Title: "second", Body: "body", CreatedAt: created_at},
+	}
+	errs, batchErr := s.CreateMessages(context.Background(), msgs)
+	assert.Nil(t, batchErr)
+	assert.EqualValues(t, []interface{}{nil, nil}, []interface{}{errs[0], errs[1]})
+	assert.EqualValues(t, 7, msgs[0].ID)
+	assert.EqualValues(t, 8, msgs[1].ID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMessageRepo_DeleteMessages(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPreparedExact(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+
+	// the live messages are locked first, then deleted by id
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, title, body, created_at, version, deleted_at, author_id, tenant_id FROM messages WHERE tenant_id=? AND deleted_at IS NULL AND id IN (?, ?, ?) FOR UPDATE;").
+		WithArgs("acme", 1, 2, 1).
+		WillReturnRows(sqlmock.NewRows(messageRow).AddRow(1, "title", "body", created_at, 3, nil, nil, "acme"))
+	mock.ExpectExec("UPDATE messages SET deleted_at=? WHERE tenant_id=? AND deleted_at IS NULL AND id IN (?);").
+		WithArgs(sqlmock.AnyArg(), "acme", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO message_revisions(message_id, version, title, body, action, created_at) VALUES (?, ?, ?, ?, ?, ?);").
+		WithArgs(1, 3, "title", "body", RevisionDelete, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	errs, batchErr := s.DeleteMessages(WithTenant(context.Background(), "acme"), []int64{1, 2, 1})
+	assert.Nil(t, batchErr)
+	if assert.Len(t, errs, 3) {
+		assert.Nil(t, errs[0])
+		assert.EqualValues(t, http.StatusNotFound, errs[1].Status())
+		assert.EqualValues(t, http.StatusNotFound, errs[2].Status())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMemoryMessageRepo_Batch(t *testing.T) {
+	testBatch(t, NewMemoryMessageRepository())
+}
+
+// testBatch checks the per item outcome of the batch operations of a repository.
+func testBatch(t *testing.T, repo messageRepoInterface) {
+	ctx := context.Background()
+	now := time.Now()
+
+	msgs := []*Message{
+		{Title: "first", Body: "body", CreatedAt: now},
+		{Title: "second", Body: "body", CreatedAt: now},
+		{Title: "first", Body: "again", CreatedAt: now},
+	}
+	errs, err := repo.CreateMessages(ctx, msgs)
+	assert.Nil(t, err)
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.NotNil(t, errs[2])
+	assert.NotZero(t, msgs[0].ID)
+	assert.NotZero(t, msgs[1].ID)
+	assert.NotEqual(t, msgs[0].ID, msgs[1].ID)
+	got, err := repo.Get(msgs[1].ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "second", got.Title)
+
+	updates := []*Message{
+		{ID: msgs[0].ID, Title: "first", Body: "new body"},
+		{ID: msgs[1].ID, Title: "second", Body: "new body", Version: 5},
+		{ID: msgs[1].ID + 100, Title: "missing", Body: "body"},
+		{ID: msgs[1].ID, Title: "first", Body: "body", Version: 1},
+	}
+	errs, err = repo.UpdateMessages(ctx, updates)
+	assert.Nil(t, err)
+	assert.Nil(t, errs[0])
+	assert.EqualValues(t, 2, updates[0].Version)
+	assert.EqualValues(t, now.Unix(), updates[0].CreatedAt.Unix())
+	if assert.NotNil(t, errs[1]) {
+		assert.EqualValues(t, http.StatusConflict, errs[1].Status())
+	}
+	if assert.NotNil(t, errs[2]) {
+		assert.EqualValues(t, http.StatusNotFound, errs[2].Status())
+	}
+	assert.NotNil(t, errs[3])
+
+	errs, err = repo.DeleteMessages(ctx, []int64{msgs[0].ID, msgs[1].ID + 100, msgs[0].ID})
+	assert.Nil(t, err)
+	assert.Nil(t, errs[0])
+	assert.NotNil(t, errs[1])
+	assert.NotNil(t, errs[2])
+	_, err = repo.Get(msgs[0].ID)
+	assert.NotNil(t, err)
+
+	revisions, err := repo.Revisions(ctx, msgs[0].ID)
+	assert.Nil(t, err)
+	if assert.Len(t, revisions, 3) {
+		assert.EqualValues(t, RevisionCreate, revisions[0].Action)
+		assert.EqualValues(t, RevisionUpdate, revisions[1].Action)
+		assert.EqualValues(t, RevisionDelete, revisions[2].Action)
+	}
+}
+
+func TestDialect_Lock(t *testing.T) {
+	query := "SELECT id FROM messages WHERE id=?;"
+	assert.EqualValues(t, "SELECT id FROM messages WHERE id=? FOR UPDATE;", mysqlDialect.lock(query))
+	assert.EqualValues(t, "SELECT id FROM messages WHERE id=?;", sqliteDialect.lock(query))
+	assert.EqualValues(t, "SELECT id FROM messages WHERE id=$1 FOR UPDATE;", postgresDialect.lock(query))
+}
@@ -0,0 +1,390 @@
+package domain
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/silvergama/efficientAPI/utils/error_formats"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// CacheStore holds the encoded messages of a CachedMessageRepository. Its
+// three methods map to the GET, SET EX and DEL commands, so a thin adapter
+// over any Redis compatible client lets several servers share one cache.
+type CacheStore interface {
+	// Get reports false when key is missing or expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// CacheStats counts the lookups served by a CachedMessageRepository.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// Shared is the misses which waited for the load of a concurrent miss
+	// of the same message instead of querying the repository themselves.
+	Shared uint64 `json:"shared"`
+	// Errors is the failed calls to the store, each of them read as a miss.
+	Errors uint64 `json:"errors"`
+}
+
+// CachedMessageRepository is a read-through cache in front of another
+// repository. Get and GetContext are answered from the store when they can,
+// the writes go straight to the repository and evict the messages they touch.
+// Everything else, writes included, is the wrapped repository's own.
+type CachedMessageRepository struct {
+	// the counters come first to stay 64-bit aligned for sync/atomic
+	hits, misses, shared, errors uint64
+
+	invalidatingRepo
+	store  CacheStore
+	ttl    time.Duration
+	flight loadGroup
+
+	// mu orders the evictions with the stores of the loads, generation
+	// telling a load that its result may be stale by the time it completes.
+	mu         sync.Mutex
+	generation uint64
+}
+
+// NewCachedMessageRepository caches the messages of repo in store for ttl.
+func NewCachedMessageRepository(repo messageRepoInterface, store CacheStore, ttl time.Duration) *CachedMessageRepository {
+	c := &CachedMessageRepository{store: store, ttl: ttl}
+	c.invalidatingRepo = invalidatingRepo{messageRepoInterface: repo, evict: c.evict}
+	return c
+}
+
+func (c *CachedMessageRepository) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Shared: atomic.LoadUint64(&c.shared),
+		Errors: atomic.LoadUint64(&c.errors),
+	}
+}
+
+func (c *CachedMessageRepository) Get(messageId int64) (*Message, errorutils.MessageErr) {
+	return c.GetContext(context.Background(), messageId)
+}
+
+// GetContext looks messageId up in the store and loads it from the
+// repository on a miss. Concurrent misses of the same message share a single
+// load, and with it the error of the caller running it. Missing messages
+// are never cached. The messages of another tenant than the one of ctx are
+// reported missing, wherever they were found.
+func (c *CachedMessageRepository) GetContext(ctx context.Context, messageId int64) (*Message, errorutils.MessageErr) {
+	key, tenant := messageCacheKey(messageId), TenantFrom(ctx)
+	raw, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+	}
+	if ok {
+		var msg Message
+		if err := json.Unmarshal(raw, &msg); err == nil {
+			atomic.AddUint64(&c.hits, 1)
+			if msg.TenantID != tenant {
+				return nil, error_formats.NewNotFoundError()
+			}
+			return &msg, nil
+		}
+		atomic.AddUint64(&c.errors, 1)
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	// the loads are shared within a tenant only, a load failing for another
+	// tenant telling nothing of this one
+	msg, loadErr, shared := c.flight.do(tenant+"/"+key, func() (*Message, errorutils.MessageErr) {
+		return c.load(ctx, key, messageId)
+	})
+	if shared {
+		atomic.AddUint64(&c.shared, 1)
+	}
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	// the waiters share msg, each of them gets a copy of its own
+	result := *msg
+	result.Tags = copyTags(msg.Tags)
+	return &result, nil
+}
+
+func (c *CachedMessageRepository) load(ctx context.Context, key string, messageId int64) (*Message, errorutils.MessageErr) {
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+
+	msg, err := c.messageRepoInterface.GetContext(ctx, messageId)
+	if err != nil {
+		return nil, err
+	}
+	raw, encodeErr := json.Marshal(msg)
+	if encodeErr != nil {
+		atomic.AddUint64(&c.errors, 1)
+		return msg, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// something was evicted meanwhile, msg may predate that write
+	if c.generation != generation {
+		return msg, nil
+	}
+	if err := c.store.Set(ctx, key, raw, c.ttl); err != nil {
+		atomic.AddUint64(&c.errors, 1)
+	}
+	return msg, nil
+}
+
+// evict drops msgIds from the store. It ignores the context of the request,
+// which may be over while the write it follows went through.
+func (c *CachedMessageRepository) evict(msgIds ...int64) {
+	if len(msgIds) == 0 {
+		return
+	}
+	keys := make([]string, len(msgIds))
+	for i, id := range msgIds {
+		keys[i] = messageCacheKey(id)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if err := c.store.Delete(context.Background(), keys...); err != nil {
+		atomic.AddUint64(&c.errors, 1)
+		log.Printf("error evicting messages %v from the cache: %v", msgIds, err)
+	}
+}
+
+// Begin starts a unit of work on the wrapped repository. Its reads skip the
+// cache, which can't hold the uncommitted writes, and the messages it wrote
+// are evicted once it is committed.
+func (c *CachedMessageRepository) Begin(ctx context.Context) (UnitOfWork, errorutils.MessageErr) {
+	repo, ok := c.messageRepoInterface.(transactional)
+	if !ok {
+		return directUnitOfWork{c}, nil
+	}
+	uow, err := repo.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cached := &cachedUnitOfWork{UnitOfWork: uow, cache: c}
+	cached.repo = invalidatingRepo{messageRepoInterface: uow.Repo(), evict: cached.written}
+	return cached, nil
+}
+
+type cachedUnitOfWork struct {
+	UnitOfWork
+	cache *CachedMessageRepository
+	repo  invalidatingRepo
+
+	mu  sync.Mutex
+	ids []int64
+}
+
+func (u *cachedUnitOfWork) Repo() messageRepoInterface {
+	return &u.repo
+}
+
+func (u *cachedUnitOfWork) written(msgIds ...int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.ids = append(u.ids, msgIds...)
+}
+
+func (u *cachedUnitOfWork) Commit() errorutils.MessageErr {
+	err := u.UnitOfWork.Commit()
+	// evicting after a failed commit is harmless, and the safe bet when it is unknown whether it went through
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.cache.evict(u.ids...)
+	u.ids = nil
+	return err
+}
+
+// invalidatingRepo reports to evict the messages written through it.
+type invalidatingRepo struct {
+	messageRepoInterface
+	evict func(msgIds ...int64)
+}
+
+func (r *invalidatingRepo) Update(msg *Message) (*Message, errorutils.MessageErr) {
+	return r.UpdateContext(context.Background(), msg)
+}
+
+func (r *invalidatingRepo) UpdateContext(ctx context.Context, msg *Message) (*Message, errorutils.MessageErr) {
+	defer r.evict(msg.ID)
+	return r.messageRepoInterface.UpdateContext(ctx, msg)
+}
+
+func (r *invalidatingRepo) Delete(msgId int64) errorutils.MessageErr {
+	return r.DeleteContext(context.Background(), msgId)
+}
+
+func (r *invalidatingRepo) DeleteContext(ctx context.Context, msgId int64) errorutils.MessageErr {
+	defer r.evict(msgId)
+	return r.messageRepoInterface.DeleteContext(ctx, msgId)
+}
+
+func (r *invalidatingRepo) Restore(ctx context.Context, msgId int64) errorutils.MessageErr {
+	defer r.evict(msgId)
+	return r.messageRepoInterface.Restore(ctx, msgId)
+}
+
+func (r *invalidatingRepo) UpdateMessages(ctx context.Context, msgs []*Message) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	ids := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.ID
+	}
+	defer r.evict(ids...)
+	return r.messageRepoInterface.UpdateMessages(ctx, msgs)
+}
+
+func (r *invalidatingRepo) RenameTag(ctx context.Context, from, to string) (*TagRename, errorutils.MessageErr) {
+	rename, err := r.messageRepoInterface.RenameTag(ctx, from, to)
+	if err == nil {
+		r.evict(rename.MessageIDs...)
+	}
+	return rename, err
+}
+
+func (r *invalidatingRepo) DeleteMessages(ctx context.Context, msgIds []int64) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	defer r.evict(msgIds...)
+	return r.messageRepoInterface.DeleteMessages(ctx, msgIds)
+}
+
+func messageCacheKey(msgId int64) string {
+	return "message:" + strconv.FormatInt(msgId, 10)
+}
+
+// loadGroup runs a single load at a time per key, the callers asking for
+// the same key meanwhile waiting for its result.
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+type loadCall struct {
+	done chan struct{}
+	msg  *Message
+	err  errorutils.MessageErr
+}
+
+// do returns the result of fn, or of the call of fn already running for
+// key, shared telling which.
+func (g *loadGroup) do(key string, fn func() (*Message, errorutils.MessageErr)) (msg *Message, err errorutils.MessageErr, shared bool) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.msg, call.err, true
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*loadCall)
+	}
+	call := &loadCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.msg, call.err = fn()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(call.done)
+	return call.msg, call.err, false
+}
+
+// lruCacheStore is a CacheStore in process memory, dropping the least
+// recently used entry when full.
+type lruCacheStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	// front is the most recently used
+	order *list.List
+	now   func() time.Time
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRUCacheStore returns a CacheStore of up to capacity entries, at least
+// one, safe for concurrent use.
+func NewLRUCacheStore(capacity int) CacheStore {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &lruCacheStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+func (s *lruCacheStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && !s.now().Before(entry.expiresAt) {
+		s.remove(elem)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Set keeps value for ttl, forever when ttl is zero.
+func (s *lruCacheStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = s.now().Add(ttl)
+	}
+	if elem, ok := s.entries[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		s.order.MoveToFront(elem)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+func (s *lruCacheStore) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := s.entries[key]; ok {
+			s.remove(elem)
+		}
+	}
+	return nil
+}
+
+// remove must be called with s.mu held.
+func (s *lruCacheStore) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.entries, elem.Value.(*lruEntry).key)
+}
@@ -0,0 +1,221 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRepo counts the lookups reaching the repository, each of them
+// waiting for release when it is set.
+type countingRepo struct {
+	messageRepoInterface
+	gets    int64
+	release chan struct{}
+}
+
+func (r *countingRepo) GetContext(ctx context.Context, msgId int64) (*Message, errorutils.MessageErr) {
+	atomic.AddInt64(&r.gets, 1)
+	if r.release != nil {
+		<-r.release
+	}
+	return r.messageRepoInterface.GetContext(ctx, msgId)
+}
+
+type failingStore struct{}
+
+func (failingStore) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func (failingStore) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingStore) Delete(context.Context, ...string) error {
+	return errors.New("connection refused")
+}
+
+func TestLRUCacheStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewLRUCacheStore(2).(*lruCacheStore)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	assert.Nil(t, store.Set(ctx, "a", []byte("1"), time.Minute))
+	assert.Nil(t, store.Set(ctx, "b", []byte("2"), 0))
+	// a becomes the most recently used, b is dropped for c
+	_, ok, _ := store.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Nil(t, store.Set(ctx, "c", []byte("3"), 0))
+	_, ok, _ = store.Get(ctx, "b")
+	assert.False(t, ok)
+
+	value, ok, err := store.Get(ctx, "c")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.EqualValues(t, "3", value)
+
+	now = now.Add(time.Minute)
+	_, ok, _ = store.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.EqualValues(t, 1, store.order.Len())
+
+	assert.Nil(t, store.Delete(ctx, "c", "missing"))
+	_, ok, _ = store.Get(ctx, "c")
+	assert.False(t, ok)
+}
+
+func TestCachedMessageRepo_ReadThrough(t *testing.T) {
+	inner := &countingRepo{messageRepoInterface: NewMemoryMessageRepository()}
+	repo := NewCachedMessageRepository(inner, NewLRUCacheStore(10), time.Minute)
+
+	msg, err := repo.Create(&Message{Title: "title", Body: "body", CreatedAt: created_at})
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		got, err := repo.Get(msg.ID)
+		assert.Nil(t, err)
+		assert.EqualValues(t, "title", got.Title)
+		assert.True(t, created_at.Equal(got.CreatedAt))
+	}
+	assert.EqualValues(t, 1, inner.gets)
+	assert.EqualValues(t, CacheStats{Hits: 2, Misses: 1}, repo.Stats())
+
+	// missing messages are not cached
+	for i := 0; i < 2; i++ {
+		_, err = repo.Get(42)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusNotFound, err.Status())
+	}
+	assert.EqualValues(t, 3, inner.gets)
+}
+
+func TestCachedMessageRepo_Invalidation(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepo{messageRepoInterface: NewMemoryMessageRepository()}
+	repo := NewCachedMessageRepository(inner, NewLRUCacheStore(10), time.Minute)
+	msg, _ := repo.Create(&Message{Title: "title", Body: "body", CreatedAt: created_at})
+	other, _ := repo.Create(&Message{Title: "other", Body: "body", CreatedAt: created_at})
+
+	_, err := repo.Get(msg.ID)
+	assert.Nil(t, err)
+	_, err = repo.Update(&Message{ID: msg.ID, Title: "new title", Body: "body", Version: 1})
+	assert.Nil(t, err)
+	got, err := repo.Get(msg.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "new title", got.Title)
+	assert.EqualValues(t, 2, got.Version)
+
+	assert.Nil(t, repo.DeleteContext(ctx, msg.ID))
+	_, err = repo.Get(msg.ID)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+
+	assert.Nil(t, repo.Restore(ctx, msg.ID))
+	_, err = repo.Get(msg.ID)
+	assert.Nil(t, err)
+
+	_, err = repo.Get(other.ID)
+	assert.Nil(t, err)
+	errs, err := repo.UpdateMessages(ctx, []*Message{{ID: other.ID, Title: "other title", Body: "body"}})
+	assert.Nil(t, err)
+	assert.Nil(t, errs[0])
+	got, _ = repo.Get(other.ID)
+	assert.EqualValues(t, "other title", got.Title)
+
+	errs, err = repo.DeleteMessages(ctx, []int64{msg.ID, other.ID})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []errorutils.MessageErr{nil, nil}, errs)
+	_, err = repo.Get(msg.ID)
+	assert.NotNil(t, err)
+	_, err = repo.Get(other.ID)
+	assert.NotNil(t, err)
+}
+
+func TestCachedMessageRepo_UnitOfWork(t *testing.T) {
+	repo := NewCachedMessageRepository(NewMemoryMessageRepository(), NewLRUCacheStore(10), time.Minute)
+	MessageRepo = repo
+	defer func() { MessageRepo = &messageRepo{} }()
+	msg, _ := repo.Create(&Message{Title: "title", Body: "body", CreatedAt: created_at})
+	_, err := repo.Get(msg.ID)
+	assert.Nil(t, err)
+
+	err = WithTransaction(context.Background(), func(tx MessageRepository) errorutils.MessageErr {
+		_, err := tx.UpdateContext(context.Background(), &Message{ID: msg.ID, Title: "new title", Body: "body", Version: 1})
+		assert.Nil(t, err)
+		// nothing is evicted before the commit
+		_, ok, _ := repo.store.Get(context.Background(), messageCacheKey(msg.ID))
+		assert.True(t, ok)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	got, err := repo.Get(msg.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "new title", got.Title)
+}
+
+func TestCachedMessageRepo_ConcurrentMisses(t *testing.T) {
+	inner := &countingRepo{messageRepoInterface: NewMemoryMessageRepository()}
+	repo := NewCachedMessageRepository(inner, NewLRUCacheStore(10), time.Minute)
+	msg, _ := repo.Create(&Message{Title: "title", Body: "body", CreatedAt: created_at, Tags: []string{"go", "work"}})
+	inner.release = make(chan struct{})
+
+	const callers = 10
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		got []*Message
+	)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg, err := repo.GetContext(context.Background(), msg.ID)
+			assert.Nil(t, err)
+			assert.EqualValues(t, "title", msg.Title)
+			mu.Lock()
+			got = append(got, msg)
+			mu.Unlock()
+		}()
+	}
+	// let every caller miss before the load completes
+	for atomic.LoadUint64(&repo.misses) < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(inner.release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, inner.gets)
+	assert.EqualValues(t, CacheStats{Misses: callers, Shared: callers - 1}, repo.Stats())
+
+	// the callers sharing the load don't share its tags
+	got[0].Tags[0] = "changed"
+	for _, msg := range got[1:] {
+		assert.EqualValues(t, []string{"go", "work"}, msg.Tags)
+	}
+}
+
+func TestCachedMessageRepo_StoreErrors(t *testing.T) {
+	repo := NewCachedMessageRepository(NewMemoryMessageRepository(), failingStore{}, time.Minute)
+	msg, _ := repo.Create(&Message{Title: "title", Body: "body", CreatedAt: created_at})
+
+	// a broken store only costs the caching
+	got, err := repo.Get(msg.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "title", got.Title)
+	_, err = repo.Update(&Message{ID: msg.ID, Title: "new title", Body: "body", Version: 1})
+	assert.Nil(t, err)
+
+	stats := repo.Stats()
+	assert.EqualValues(t, 1, stats.Misses)
+	assert.EqualValues(t, 3, stats.Errors)
+}
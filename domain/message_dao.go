@@ -1,9 +1,11 @@
 package domain
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"strings"
+	"time"
 
 	"github.com/silvergama/efficientAPI/utils/error_formats"
 	"github.com/silvergama/efficientAPI/utils/errorutils"
@@ -14,11 +16,22 @@ var (
 )
 
 const (
-	queryGetMessage    = "SELECT id, title, body, created_at FROM messages WHERE id=?;"
-	queryInsertMessage = "INSERT INTO messages(title, body, created_at) VALUES(?, ?, ?);"
-	queryUpdateMessge  = "UPDATE messages SET title=?, body=?, created=? WHERE id=?;"
-	queryDeleteMessage = "DELETE FROM messages WHERE id=?;"
-	queryGetAllMessage = "SELECT id, tite, body, created_at FROM messages;"
+	messageColumns       = "id, title, body, created_at, version, deleted_at, author_id, tenant_id"
+	queryGetMessage      = "SELECT " + messageColumns + " FROM messages WHERE id=? AND tenant_id=? AND deleted_at IS NULL;"
+	querySnapshotMessage = "SELECT " + messageColumns + " FROM messages WHERE id=? AND tenant_id=?;"
+	queryInsertMessage   = "INSERT INTO messages(title, body, created_at, version, author_id, tenant_id) VALUES(?, ?, ?, ?, ?, ?);"
+	queryUpdateMessge    = "UPDATE messages SET title=?, body=?, version=version+1 WHERE id=? AND tenant_id=? AND version=? AND deleted_at IS NULL;"
+	queryDeleteMessage   = "UPDATE messages SET deleted_at=? WHERE id=? AND tenant_id=? AND deleted_at IS NULL;"
+	queryRestoreMessage  = "UPDATE messages SET deleted_at=NULL WHERE id=? AND tenant_id=? AND deleted_at IS NOT NULL;"
+	queryPurgeMessages   = "DELETE FROM messages WHERE deleted_at IS NOT NULL AND deleted_at < ?;"
+	queryPurgeRevisions  = "DELETE FROM message_revisions WHERE message_id IN (SELECT id FROM messages WHERE deleted_at IS NOT NULL AND deleted_at < ?);"
+	queryGetAllMessage   = "SELECT " + messageColumns + " FROM messages WHERE tenant_id=? AND deleted_at IS NULL;"
+	queryListMessages    = "SELECT " + messageColumns + " FROM messages"
+
+	revisionColumns     = "id, message_id, version, title, body, action, created_at"
+	queryInsertRevision = "INSERT INTO message_revisions(message_id, version, title, body, action, created_at) VALUES(?, ?, ?, ?, ?, ?);"
+	queryListRevisions  = "SELECT " + revisionColumns + " FROM message_revisions WHERE message_id IN (SELECT id FROM messages WHERE id=? AND tenant_id=?) ORDER BY id;"
+	queryGetRevision    = "SELECT " + revisionColumns + " FROM message_revisions WHERE id=? AND message_id IN (SELECT id FROM messages WHERE id=? AND tenant_id=?);"
 )
 
 type messageRepoInterface interface {
@@ -27,30 +40,57 @@ type messageRepoInterface interface {
 	Update(*Message) (*Message, errorutils.MessageErr)
 	Delete(int64) errorutils.MessageErr
 	GetAll() ([]Message, errorutils.MessageErr)
-	Initialize(string, string, string, string, string, string) *sql.DB
+	GetContext(context.Context, int64) (*Message, errorutils.MessageErr)
+	GetWithDeleted(context.Context, int64) (*Message, errorutils.MessageErr)
+	CreateContext(context.Context, *Message) (*Message, errorutils.MessageErr)
+	UpdateContext(context.Context, *Message) (*Message, errorutils.MessageErr)
+	DeleteContext(context.Context, int64) errorutils.MessageErr
+	GetAllContext(context.Context) ([]Message, errorutils.MessageErr)
+	List(context.Context, ListOptions) (*MessagePage, errorutils.MessageErr)
+	Search(context.Context, SearchOptions) (*SearchPage, errorutils.MessageErr)
+	Restore(context.Context, int64) errorutils.MessageErr
+	Purge(context.Context, time.Time) (int64, errorutils.MessageErr)
+	Revisions(context.Context, int64) ([]Revision, errorutils.MessageErr)
+	GetRevision(ctx context.Context, msgId int64, revisionId int64) (*Revision, errorutils.MessageErr)
+	Tags(context.Context) ([]TagCount, errorutils.MessageErr)
+	RenameTag(ctx context.Context, from string, to string) (*TagRename, errorutils.MessageErr)
+	CreateMessages(context.Context, []*Message) ([]errorutils.MessageErr, errorutils.MessageErr)
+	UpdateMessages(context.Context, []*Message) ([]errorutils.MessageErr, errorutils.MessageErr)
+	DeleteMessages(context.Context, []int64) ([]errorutils.MessageErr, errorutils.MessageErr)
 }
 
 type messageRepo struct {
 	db *sql.DB
+	// tx is set on the repositories of a UnitOfWork, every statement then runs in it.
+	tx      *sql.Tx
+	dialect dialect
+	// stmts is shared with the repositories of the units of work
+	stmts *statements
 }
 
-func (mr *messageRepo) Initialize(DbDriver, DbUser, DbPassword, DbPort, DbHost, DbName string) *sql.DB {
-	var err error
-	DBURL := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local", DbUser, DbPassword, DbHost, DbPort, DbName)
+// dbConn is what *sql.DB and *sql.Tx have in common.
+type dbConn interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
 
-	mr.db, err = sql.Open(DbDriver, DBURL)
-	if err != nil {
-		log.Fatal("This is the error connecting to the database:", err)
+func (mr *messageRepo) conn() dbConn {
+	if mr.tx != nil {
+		return mr.tx
 	}
-	fmt.Printf("We are connected to the %s database", DbDriver)
-
 	return mr.db
 }
 
+// NewMessageRepository wraps a database opened with the "mysql" driver.
 func NewMessageRepository(db *sql.DB) messageRepoInterface {
-	return &messageRepo{
-		db: db,
+	mr := &messageRepo{
+		db:      db,
+		dialect: mysqlDialect,
 	}
+	mr.prepareStatements()
+	return mr
 }
 
 type Address struct {
@@ -63,34 +103,109 @@ type Address struct {
 }
 
 func (mr *messageRepo) Get(messageId int64) (*Message, errorutils.MessageErr) {
-	stmt, err := mr.db.Prepare(queryGetMessage)
-	if err != nil {
-		return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to prepare message: %s", err.Error()))
-	}
-	defer stmt.Close()
+	return mr.GetContext(context.Background(), messageId)
+}
 
-	var msg Message
-	getError := stmt.QueryRow(messageId).Scan(
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// nullString stores an empty string as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// scanMessage reads a row selected with messageColumns.
+func scanMessage(row rowScanner, msg *Message) error {
+	var (
+		deletedAt sql.NullTime
+		authorID  sql.NullString
+	)
+	if err := row.Scan(
 		&msg.ID,
 		&msg.Title,
 		&msg.Body,
 		&msg.CreatedAt,
-	)
+		&msg.Version,
+		&deletedAt,
+		&authorID,
+		&msg.TenantID,
+	); err != nil {
+		return err
+	}
+	msg.AuthorID = authorID.String
+	msg.DeletedAt = nil
+	if deletedAt.Valid {
+		msg.DeletedAt = &deletedAt.Time
+	}
+	return nil
+}
+
+// GetContext is like Get but aborts the query when ctx is done.
+func (mr *messageRepo) GetContext(ctx context.Context, messageId int64) (*Message, errorutils.MessageErr) {
+	query := mr.dialect.rebind(queryGetMessage)
+	stmt, err := mr.prepared(ctx, nil, query)
+	if err != nil {
+		return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to prepare message: %s", err.Error()))
+	}
+
+	var msg Message
+	tenant := TenantFrom(ctx)
+	getError := scanMessage(stmt.QueryRowContext(ctx, messageId, tenant), &msg)
+	if mr.staleStatement(query, getError) {
+		if stmt, getError = mr.prepared(ctx, nil, query); getError == nil {
+			getError = scanMessage(stmt.QueryRowContext(ctx, messageId, tenant), &msg)
+		}
+	}
 	if getError != nil {
-		fmt.Println("This is the error man:", getError)
 		return nil, error_formats.ParseError(getError)
 	}
+	if err := mr.loadTags(ctx, mr.conn(), &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// GetWithDeleted is like GetContext but finds the deleted messages too,
+// as long as they weren't purged.
+func (mr *messageRepo) GetWithDeleted(ctx context.Context, messageId int64) (*Message, errorutils.MessageErr) {
+	query := mr.dialect.rebind(querySnapshotMessage)
+	stmt, err := mr.prepared(ctx, nil, query)
+	if err != nil {
+		return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to prepare message: %s", err.Error()))
+	}
+
+	var msg Message
+	if getError := scanMessage(stmt.QueryRowContext(ctx, messageId, TenantFrom(ctx)), &msg); getError != nil {
+		mr.staleStatement(query, getError)
+		return nil, error_formats.ParseError(getError)
+	}
+	if err := mr.loadTags(ctx, mr.conn(), &msg); err != nil {
+		return nil, err
+	}
 	return &msg, nil
 }
 
 func (mr *messageRepo) GetAll() ([]Message, errorutils.MessageErr) {
-	stmt, err := mr.db.Prepare(queryGetAllMessage)
+	return mr.GetAllContext(context.Background())
+}
+
+// GetAllContext is like GetAll but aborts the query when ctx is done.
+func (mr *messageRepo) GetAllContext(ctx context.Context) ([]Message, errorutils.MessageErr) {
+	query := mr.dialect.rebind(queryGetAllMessage)
+	stmt, err := mr.prepared(ctx, nil, query)
 	if err != nil {
 		return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to prepare all messages %s", err.Error()))
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.Query()
+	tenant := TenantFrom(ctx)
+	rows, err := stmt.QueryContext(ctx, tenant)
+	if mr.staleStatement(query, err) {
+		if stmt, err = mr.prepared(ctx, nil, query); err == nil {
+			rows, err = stmt.QueryContext(ctx, tenant)
+		}
+	}
 	if err != nil {
 		return nil, error_formats.ParseError(err)
 	}
@@ -100,70 +215,439 @@ func (mr *messageRepo) GetAll() ([]Message, errorutils.MessageErr) {
 
 	for rows.Next() {
 		var msg Message
-		getError := rows.Scan(
-			&msg.ID,
-			&msg.Title,
-			&msg.Body,
-			&msg.CreatedAt,
-		)
+		getError := scanMessage(rows, &msg)
 		if getError != nil {
-			return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to get message %s", err.Error()))
+			return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to get message %s", getError.Error()))
 		}
 		results = append(results, msg)
 	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, error_formats.ParseError(rowsErr)
+	}
+	rows.Close()
 	if len(results) == 0 {
 		return nil, errorutils.NewNotFoundError("no records found")
 	}
+	if err := mr.loadTags(ctx, mr.conn(), messagePointers(results)...); err != nil {
+		return nil, err
+	}
 	return results, nil
 }
 
+// List returns one page of messages matching opts. An empty page is not an error.
+func (mr *messageRepo) List(ctx context.Context, opts ListOptions) (*MessagePage, errorutils.MessageErr) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	query, args, err := buildListQuery(TenantFrom(ctx), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, queryErr := mr.conn().QueryContext(ctx, mr.dialect.rebind(query), args...)
+	if queryErr != nil {
+		return nil, error_formats.ParseError(queryErr)
+	}
+	defer rows.Close()
+
+	results := make([]Message, 0, opts.PageSize+1)
+	for rows.Next() {
+		var msg Message
+		if scanErr := scanMessage(rows, &msg); scanErr != nil {
+			return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to list messages %s", scanErr.Error()))
+		}
+		results = append(results, msg)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, error_formats.ParseError(rowsErr)
+	}
+	rows.Close()
+	if err := mr.loadTags(ctx, mr.conn(), messagePointers(results)...); err != nil {
+		return nil, err
+	}
+	return newMessagePage(results, opts), nil
+}
+
+// messagePointers points at every message of msgs, to fill them in.
+func messagePointers(msgs []Message) []*Message {
+	pointers := make([]*Message, len(msgs))
+	for i := range msgs {
+		pointers[i] = &msgs[i]
+	}
+	return pointers
+}
+
+func buildListQuery(tenant string, opts ListOptions) (string, []interface{}, errorutils.MessageErr) {
+	var (
+		where = []string{"deleted_at IS NULL", "tenant_id=?"}
+		args  = []interface{}{tenant}
+	)
+	if opts.Deleted {
+		where[0] = "deleted_at IS NOT NULL"
+	}
+	if opts.TitleContains != "" {
+		where = append(where, "title LIKE ? ESCAPE '!'")
+		args = append(args, "%"+escapeLike(opts.TitleContains)+"%")
+	}
+	if !opts.CreatedFrom.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, opts.CreatedFrom)
+	}
+	if !opts.CreatedTo.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, opts.CreatedTo)
+	}
+	if len(opts.Tags) > 0 {
+		tagged := "id IN (SELECT mt.message_id FROM message_tags mt JOIN tags t ON t.id=mt.tag_id WHERE t.tenant_id=? AND t.name IN (" + placeholders(len(opts.Tags), 1) + ")"
+		args = append(args, tenant)
+		for _, tag := range opts.Tags {
+			args = append(args, tag)
+		}
+		if opts.TagMatch == TagMatchAny {
+			where = append(where, tagged+")")
+		} else {
+			where = append(where, tagged+" GROUP BY mt.message_id HAVING COUNT(*)=?)")
+			args = append(args, len(opts.Tags))
+		}
+	}
+
+	cmp, order := ">", "ASC"
+	if opts.Sort == SortDesc {
+		cmp, order = "<", "DESC"
+	}
+	cursor, err := opts.cursor()
+	if err != nil {
+		return "", nil, err
+	}
+	if cursor != nil {
+		where = append(where, fmt.Sprintf("(created_at %s ? OR (created_at = ? AND id %s ?))", cmp, cmp))
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+
+	query := queryListMessages + " WHERE " + strings.Join(where, " AND ")
+	query += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT ?;", order, order)
+	args = append(args, opts.PageSize+1)
+	return query, args, nil
+}
+
 func (mr *messageRepo) Create(msg *Message) (*Message, errorutils.MessageErr) {
-	fmt.Println("WE REACHED THE DOMAIN")
-	stmt, err := mr.db.Prepare(queryInsertMessage)
+	return mr.CreateContext(context.Background(), msg)
+}
+
+// CreateContext is like Create but aborts the insert when ctx is done.
+// The message goes to the tenant of ctx.
+func (mr *messageRepo) CreateContext(ctx context.Context, msg *Message) (*Message, errorutils.MessageErr) {
+	msg.Version = 1
+	msg.TenantID = TenantFrom(ctx)
+	err := mr.inTx(ctx, func(tx *sql.Tx) errorutils.MessageErr {
+		msgId, err := mr.insertMessage(ctx, tx, msg)
+		if err != nil {
+			return err
+		}
+		msg.ID = msgId
+		if err := mr.saveTags(ctx, tx, msg.TenantID, msg); err != nil {
+			return err
+		}
+		return mr.insertRevision(ctx, tx, msg, RevisionCreate, msg.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (mr *messageRepo) insertMessage(ctx context.Context, tx *sql.Tx, msg *Message) (int64, errorutils.MessageErr) {
+	query := mr.dialect.insert(queryInsertMessage)
+	stmt, err := mr.prepared(ctx, tx, query)
 	if err != nil {
-		return nil, errorutils.NewInternalServerError(fmt.Sprintf("error when trying to prepare message to save %s", err.Error()))
+		return 0, errorutils.NewInternalServerError(fmt.Sprintf("error when trying to prepare message to save %s", err.Error()))
 	}
-	fmt.Println("WE DIDN'T REACH HERE")
-	defer stmt.Close()
 
-	insertResult, createErr := stmt.Exec(
-		msg.Title, msg.Body, msg.CreatedAt,
+	if mr.dialect.returningID {
+		var msgId int64
+		if createErr := stmt.QueryRowContext(ctx, msg.Title, msg.Body, msg.CreatedAt, msg.Version, nullString(msg.AuthorID), msg.TenantID).Scan(&msgId); createErr != nil {
+			mr.staleStatement(query, createErr)
+			return 0, error_formats.ParseError(createErr)
+		}
+		return msgId, nil
+	}
+
+	insertResult, createErr := stmt.ExecContext(ctx,
+		msg.Title, msg.Body, msg.CreatedAt, msg.Version, nullString(msg.AuthorID), msg.TenantID,
 	)
 	if createErr != nil {
-		return nil, error_formats.ParseError(createErr)
+		mr.staleStatement(query, createErr)
+		return 0, error_formats.ParseError(createErr)
 	}
 	msgId, err := insertResult.LastInsertId()
 	if err != nil {
-		return nil, errorutils.NewInternalServerError(fmt.Sprintf("error trying to save message %s", err.Error()))
+		return 0, errorutils.NewInternalServerError(fmt.Sprintf("error trying to save message %s", err.Error()))
 	}
-	msg.ID = msgId
+	return msgId, nil
+}
+
+func (mr *messageRepo) Update(msg *Message) (*Message, errorutils.MessageErr) {
+	return mr.UpdateContext(context.Background(), msg)
+}
+
+// UpdateContext is like Update but aborts the update when ctx is done.
+// The update only applies to the msg.Version of the message, a
+// concurrent update in between makes it fail with a conflict.
+func (mr *messageRepo) UpdateContext(ctx context.Context, msg *Message) (*Message, errorutils.MessageErr) {
+	err := mr.inTx(ctx, func(tx *sql.Tx) errorutils.MessageErr {
+		query := mr.dialect.rebind(queryUpdateMessge)
+		stmt, err := mr.prepared(ctx, tx, query)
+		if err != nil {
+			return errorutils.NewInternalServerError(fmt.Sprintf("error when trying to prepare user to save %s", err.Error()))
+		}
+
+		result, updErr := stmt.ExecContext(ctx, msg.Title, msg.Body, msg.ID, TenantFrom(ctx), msg.Version)
+		if updErr != nil {
+			mr.staleStatement(query, updErr)
+			return error_formats.ParseError(updErr)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return errorutils.NewInternalServerError(fmt.Sprintf("error trying to update message %s", err.Error()))
+		}
+		if affected == 0 {
+			return NewVersionConflictError(msg.ID)
+		}
+		if err := mr.saveTags(ctx, tx, TenantFrom(ctx), msg); err != nil {
+			return err
+		}
+		updated := *msg
+		updated.Version++
+		return mr.insertRevision(ctx, tx, &updated, RevisionUpdate, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	msg.Version++
 
 	return msg, nil
 }
 
-func (mr *messageRepo) Update(msg *Message) (*Message, errorutils.MessageErr) {
-	stmt, err := mr.db.Prepare(queryUpdateMessge)
+func (mr *messageRepo) Delete(msgId int64) errorutils.MessageErr {
+	return mr.DeleteContext(context.Background(), msgId)
+}
+
+// DeleteContext is like Delete but aborts the delete when ctx is done.
+// Messages are only marked as deleted, see Restore and Purge.
+func (mr *messageRepo) DeleteContext(ctx context.Context, msgId int64) errorutils.MessageErr {
+	return mr.inTx(ctx, func(tx *sql.Tx) errorutils.MessageErr {
+		query := mr.dialect.rebind(queryDeleteMessage)
+		stmt, err := mr.prepared(ctx, tx, query)
+		if err != nil {
+			return errorutils.NewInternalServerError(fmt.Sprintf("error when trying prepare message to delete %s", err.Error()))
+		}
+
+		now := time.Now()
+		result, err := stmt.ExecContext(ctx, now, msgId, TenantFrom(ctx))
+		if err != nil {
+			mr.staleStatement(query, err)
+			return error_formats.ParseError(err)
+		}
+		if err := checkAffected(result); err != nil {
+			return err
+		}
+		_, snapErr := mr.snapshotRevision(ctx, tx, msgId, RevisionDelete, now)
+		return snapErr
+	})
+}
+
+// Restore brings back a deleted message that wasn't purged yet.
+func (mr *messageRepo) Restore(ctx context.Context, msgId int64) errorutils.MessageErr {
+	return mr.inTx(ctx, func(tx *sql.Tx) errorutils.MessageErr {
+		query := mr.dialect.rebind(queryRestoreMessage)
+		stmt, err := mr.prepared(ctx, tx, query)
+		if err != nil {
+			return errorutils.NewInternalServerError(fmt.Sprintf("error when trying prepare message to restore %s", err.Error()))
+		}
+
+		result, err := stmt.ExecContext(ctx, msgId, TenantFrom(ctx))
+		if err != nil {
+			mr.staleStatement(query, err)
+			return error_formats.ParseError(err)
+		}
+		if err := checkAffected(result); err != nil {
+			return err
+		}
+		_, snapErr := mr.snapshotRevision(ctx, tx, msgId, RevisionRestore, time.Now())
+		return snapErr
+	})
+}
+
+// Purge removes for good the messages deleted before the given time, along
+// with their revisions and tags, and returns how many they were. The tags no
+// message carries any more go too.
+func (mr *messageRepo) Purge(ctx context.Context, before time.Time) (int64, errorutils.MessageErr) {
+	var purged int64
+	err := mr.inTx(ctx, func(tx *sql.Tx) errorutils.MessageErr {
+		for _, query := range []string{queryPurgeRevisions, queryPurgeMessageTags} {
+			query = mr.dialect.rebind(query)
+			stmt, err := mr.prepared(ctx, tx, query)
+			if err != nil {
+				return errorutils.NewInternalServerError(fmt.Sprintf("error when trying prepare message data to purge %s", err.Error()))
+			}
+			if _, err := stmt.ExecContext(ctx, before); err != nil {
+				mr.staleStatement(query, err)
+				return error_formats.ParseError(err)
+			}
+		}
+
+		query := mr.dialect.rebind(queryPurgeMessages)
+		stmt, err := mr.prepared(ctx, tx, query)
+		if err != nil {
+			return errorutils.NewInternalServerError(fmt.Sprintf("error when trying prepare messages to purge %s", err.Error()))
+		}
+
+		result, err := stmt.ExecContext(ctx, before)
+		if err != nil {
+			mr.staleStatement(query, err)
+			return error_formats.ParseError(err)
+		}
+		purged, err = result.RowsAffected()
+		if err != nil {
+			return errorutils.NewInternalServerError(fmt.Sprintf("error trying to purge messages %s", err.Error()))
+		}
+
+		query = mr.dialect.rebind(queryPurgeUnusedTags)
+		stmt, err = mr.prepared(ctx, tx, query)
+		if err != nil {
+			return errorutils.NewInternalServerError(fmt.Sprintf("error when trying prepare tags to purge %s", err.Error()))
+		}
+		if _, err := stmt.ExecContext(ctx); err != nil {
+			mr.staleStatement(query, err)
+			return error_formats.ParseError(err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, errorutils.NewInternalServerError(fmt.Sprintf("error when trying to prepare user to save %s", err.Error()))
+		return 0, err
 	}
-	defer stmt.Close()
+	return purged, nil
+}
 
-	if _, updErr := stmt.Exec(msg.Title, msg.Body, msg.ID); updErr != nil {
-		return nil, error_formats.ParseError(updErr)
+// Revisions returns the history of a message, oldest first.
+func (mr *messageRepo) Revisions(ctx context.Context, msgId int64) ([]Revision, errorutils.MessageErr) {
+	query := mr.dialect.rebind(queryListRevisions)
+	stmt, err := mr.prepared(ctx, nil, query)
+	if err != nil {
+		return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to prepare revisions %s", err.Error()))
 	}
+	rows, err := stmt.QueryContext(ctx, msgId, TenantFrom(ctx))
+	if err != nil {
+		mr.staleStatement(query, err)
+		return nil, error_formats.ParseError(err)
+	}
+	defer rows.Close()
 
-	return msg, nil
+	results := make([]Revision, 0)
+	for rows.Next() {
+		var rev Revision
+		if scanErr := scanRevision(rows, &rev); scanErr != nil {
+			return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to get revisions %s", scanErr.Error()))
+		}
+		results = append(results, rev)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, error_formats.ParseError(rowsErr)
+	}
+	if len(results) == 0 {
+		return nil, error_formats.NewNotFoundError()
+	}
+	return results, nil
 }
 
-func (mr *messageRepo) Delete(msgId int64) errorutils.MessageErr {
-	stmt, err := mr.db.Prepare(queryDeleteMessage)
+// GetRevision returns a single revision, which must belong to the message.
+func (mr *messageRepo) GetRevision(ctx context.Context, msgId int64, revisionId int64) (*Revision, errorutils.MessageErr) {
+	query := mr.dialect.rebind(queryGetRevision)
+	stmt, err := mr.prepared(ctx, nil, query)
+	if err != nil {
+		return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to prepare revision %s", err.Error()))
+	}
+	var rev Revision
+	if err := scanRevision(stmt.QueryRowContext(ctx, revisionId, msgId, TenantFrom(ctx)), &rev); err != nil {
+		mr.staleStatement(query, err)
+		return nil, error_formats.ParseError(err)
+	}
+	return &rev, nil
+}
+
+func scanRevision(row rowScanner, rev *Revision) error {
+	return row.Scan(
+		&rev.ID,
+		&rev.MessageID,
+		&rev.Version,
+		&rev.Title,
+		&rev.Body,
+		&rev.Action,
+		&rev.CreatedAt,
+	)
+}
+
+// snapshotRevision records the message as it is now in tx, for the changes
+// that don't carry its title and body, and returns it.
+func (mr *messageRepo) snapshotRevision(ctx context.Context, tx *sql.Tx, msgId int64, action RevisionAction, at time.Time) (*Message, errorutils.MessageErr) {
+	query := mr.dialect.rebind(querySnapshotMessage)
+	stmt, err := mr.prepared(ctx, tx, query)
+	if err != nil {
+		return nil, errorutils.NewInternalServerError(fmt.Sprintf("error when trying to prepare message snapshot %s", err.Error()))
+	}
+	var msg Message
+	if err := scanMessage(stmt.QueryRowContext(ctx, msgId, TenantFrom(ctx)), &msg); err != nil {
+		mr.staleStatement(query, err)
+		return nil, error_formats.ParseError(err)
+	}
+	if err := mr.insertRevision(ctx, tx, &msg, action, at); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (mr *messageRepo) insertRevision(ctx context.Context, tx *sql.Tx, msg *Message, action RevisionAction, at time.Time) errorutils.MessageErr {
+	query := mr.dialect.rebind(queryInsertRevision)
+	stmt, err := mr.prepared(ctx, tx, query)
 	if err != nil {
-		return errorutils.NewInternalServerError(fmt.Sprintf("error when trying prepare message to delete %s", err.Error()))
+		return errorutils.NewInternalServerError(fmt.Sprintf("error when trying to prepare revision to save %s", err.Error()))
+	}
+	if _, err := stmt.ExecContext(ctx, msg.ID, msg.Version, msg.Title, msg.Body, action, at); err != nil {
+		mr.staleStatement(query, err)
+		return error_formats.ParseError(err)
 	}
-	defer stmt.Close()
+	return nil
+}
 
-	if _, err := stmt.Exec(msgId); err != nil {
+// inTx runs fn in a transaction, which is only committed when fn succeeds.
+// Within a UnitOfWork fn joins its transaction instead.
+func (mr *messageRepo) inTx(ctx context.Context, fn func(*sql.Tx) errorutils.MessageErr) errorutils.MessageErr {
+	if mr.tx != nil {
+		return fn(mr.tx)
+	}
+	mr.prepareMissing(ctx)
+	tx, err := mr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return error_formats.ParseError(err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
 		return error_formats.ParseError(err)
 	}
 	return nil
 }
+
+// checkAffected turns a statement that touched no row into a not found error.
+func checkAffected(result sql.Result) errorutils.MessageErr {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errorutils.NewInternalServerError(fmt.Sprintf("error when processing request: %s", err.Error()))
+	}
+	if affected == 0 {
+		return error_formats.NewNotFoundError()
+	}
+	return nil
+}
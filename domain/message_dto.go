@@ -1,7 +1,7 @@
 package domain
 
 import (
-	"strings"
+	"fmt"
 	"time"
 
 	"github.com/silvergama/efficientAPI/utils/errorutils"
@@ -12,16 +12,32 @@ type Message struct {
 	Title     string    `json:"title"`
 	Body      string    `json:"body"`
 	CreatedAt time.Time `json:"created_at"`
+	// Version starts at 1 and grows with every update, for optimistic locking.
+	Version int64 `json:"version"`
+	// DeletedAt is set once the message is deleted, until it is restored or purged.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// AuthorID is the principal who created the message, and owns it. It is
+	// empty for the messages created before authorship was recorded.
+	AuthorID string `json:"author_id,omitempty"`
+	// TenantID is the tenant the message belongs to, only its callers see it.
+	TenantID string `json:"tenant_id,omitempty"`
+	// Tags are normalized by Validate, sorted. Updating a message with nil
+	// Tags leaves its tags as they are, an empty slice removes them.
+	Tags []string `json:"tags,omitempty"`
 }
 
-func (m *Message) Validate() errorutils.MessageErr {
-	m.Title = strings.TrimSpace(m.Title)
-	m.Body = strings.TrimSpace(m.Body)
-	if m.Title == "" {
-		return errorutils.NewUnprocessibleEntityError("Please enter a valid title")
-	}
-	if m.Body == "" {
-		return errorutils.NewUnprocessibleEntityError("Please enter a valid body")
-	}
-	return nil
+// The codes of the errors below.
+const (
+	CodeVersionConflict = "version_conflict"
+	CodeNotOwner        = "not_owner"
+)
+
+// NewVersionConflictError is returned when a message changed since the version an update was based on.
+func NewVersionConflictError(msgId int64) errorutils.MessageErr {
+	return errorutils.WithCode(errorutils.NewConflictError(fmt.Sprintf("message %d was modified by someone else, reload it and try again", msgId)), CodeVersionConflict)
+}
+
+// NewNotOwnerError is returned when someone else than the author of a message tries to change it.
+func NewNotOwnerError(msgId int64) errorutils.MessageErr {
+	return errorutils.WithCode(errorutils.NewForbiddenError(fmt.Sprintf("message %d belongs to someone else", msgId)), CodeNotOwner)
 }
@@ -0,0 +1,170 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+type SortOrder string
+
+const (
+	SortAsc  SortOrder = "asc"
+	SortDesc SortOrder = "desc"
+)
+
+// ListOptions selects one page of messages. Pages are keyed on
+// (created_at, id), so Cursor must be the NextCursor of the previous page,
+// listed with the same sort order and filters.
+type ListOptions struct {
+	PageSize      int
+	Cursor        string
+	Sort          SortOrder
+	TitleContains string
+	CreatedFrom   time.Time // inclusive, ignored when zero
+	CreatedTo     time.Time // exclusive, ignored when zero
+	// Deleted lists the deleted messages instead of the live ones.
+	Deleted bool
+	// Tags keeps the messages with all of them, or any when TagMatch is
+	// TagMatchAny.
+	Tags     []string
+	TagMatch TagMatch
+}
+
+type MessagePage struct {
+	Items      []Message `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// listCursor is the last message of a page, along with the sort order and
+// filters of its list: a cursor used for another list would skip or repeat
+// messages.
+type listCursor struct {
+	CreatedAt     time.Time `json:"created_at"`
+	ID            int64     `json:"id"`
+	Sort          SortOrder `json:"sort"`
+	TitleContains string    `json:"title,omitempty"`
+	CreatedFrom   time.Time `json:"created_from"`
+	CreatedTo     time.Time `json:"created_to"`
+	Deleted       bool      `json:"deleted,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
+	// TagMatch is only kept along with Tags, it changes nothing without them
+	TagMatch TagMatch `json:"tag_match,omitempty"`
+}
+
+func newListCursor(msg Message, o ListOptions) listCursor {
+	c := listCursor{
+		CreatedAt:     msg.CreatedAt,
+		ID:            msg.ID,
+		Sort:          o.Sort,
+		TitleContains: o.TitleContains,
+		CreatedFrom:   o.CreatedFrom,
+		CreatedTo:     o.CreatedTo,
+		Deleted:       o.Deleted,
+	}
+	if len(o.Tags) > 0 {
+		c.Tags, c.TagMatch = o.Tags, o.TagMatch
+	}
+	return c
+}
+
+// matches tells whether c was made for the list of o, which must be validated.
+func (c *listCursor) matches(o ListOptions) bool {
+	want := newListCursor(Message{}, o)
+	if c.Sort != want.Sort || c.TitleContains != want.TitleContains || c.Deleted != want.Deleted || c.TagMatch != want.TagMatch {
+		return false
+	}
+	if !c.CreatedFrom.Equal(want.CreatedFrom) || !c.CreatedTo.Equal(want.CreatedTo) || len(c.Tags) != len(want.Tags) {
+		return false
+	}
+	for i := range c.Tags {
+		if c.Tags[i] != want.Tags[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate fills in the defaults and rejects options no backend can serve.
+func (o *ListOptions) Validate() errorutils.MessageErr {
+	if o.PageSize == 0 {
+		o.PageSize = DefaultPageSize
+	}
+	if o.PageSize < 0 || o.PageSize > MaxPageSize {
+		return errorutils.NewBadRequestError("page size must be between 1 and 100")
+	}
+	o.Sort = SortOrder(strings.ToLower(string(o.Sort)))
+	if o.Sort == "" {
+		o.Sort = SortAsc
+	}
+	if o.Sort != SortAsc && o.Sort != SortDesc {
+		return errorutils.NewBadRequestError("sort order must be asc or desc")
+	}
+	if !o.CreatedFrom.IsZero() && !o.CreatedTo.IsZero() && !o.CreatedFrom.Before(o.CreatedTo) {
+		return errorutils.NewBadRequestError("created_from must be before created_to")
+	}
+	o.TagMatch = TagMatch(strings.ToLower(string(o.TagMatch)))
+	if o.TagMatch == "" {
+		o.TagMatch = TagMatchAll
+	}
+	if o.TagMatch != TagMatchAll && o.TagMatch != TagMatchAny {
+		return errorutils.NewBadRequestError("tag match must be all or any")
+	}
+	o.Tags = NormalizeTags(o.Tags)
+	if violations := checkTags(o.Tags); len(violations) > 0 {
+		return errorutils.NewBadRequestError(violations[0].Message)
+	}
+	if _, err := o.cursor(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (o *ListOptions) cursor() (*listCursor, errorutils.MessageErr) {
+	if o.Cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return nil, errorutils.NewBadRequestError("invalid cursor")
+	}
+	var c listCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, errorutils.NewBadRequestError("invalid cursor")
+	}
+	if !c.matches(*o) {
+		return nil, errorutils.NewBadRequestError("the cursor belongs to a list with another sort order or filters")
+	}
+	return &c, nil
+}
+
+func encodeCursor(msg Message, o ListOptions) string {
+	raw, _ := json.Marshal(newListCursor(msg, o))
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// newMessagePage expects up to opts.PageSize+1 items: the extra one only
+// tells that another page exists and is not returned.
+func newMessagePage(items []Message, opts ListOptions) *MessagePage {
+	page := &MessagePage{Items: items}
+	if len(items) > opts.PageSize {
+		page.Items = items[:opts.PageSize]
+		page.NextCursor = encodeCursor(page.Items[opts.PageSize-1], opts)
+	}
+	return page
+}
+
+// escapeLike escapes the LIKE wildcards of s using '!' as the escape
+// character, which needs no quoting in any of the SQL dialects we talk to.
+func escapeLike(s string) string {
+	r := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return r.Replace(s)
+}
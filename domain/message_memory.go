@@ -0,0 +1,598 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/silvergama/efficientAPI/utils/error_formats"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// memoryMessageRepo is a messageRepoInterface kept in process memory. It is
+// safe for concurrent use and mirrors the errors of the SQL repository, which
+// makes it a drop-in backend for tests and local runs without MySQL.
+type memoryMessageRepo struct {
+	mu             sync.RWMutex
+	lastID         int64
+	messages       map[int64]Message
+	lastRevisionID int64
+	revisions      map[int64][]Revision
+}
+
+func NewMemoryMessageRepository() messageRepoInterface {
+	return &memoryMessageRepo{
+		messages:  make(map[int64]Message),
+		revisions: make(map[int64][]Revision),
+	}
+}
+
+func (mr *memoryMessageRepo) Get(messageId int64) (*Message, errorutils.MessageErr) {
+	return mr.GetContext(context.Background(), messageId)
+}
+
+func (mr *memoryMessageRepo) GetContext(ctx context.Context, messageId int64) (*Message, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	msg, ok := mr.lookup(TenantFrom(ctx), messageId)
+	if !ok || msg.DeletedAt != nil {
+		return nil, error_formats.NewNotFoundError()
+	}
+	msg.Tags = copyTags(msg.Tags)
+	return &msg, nil
+}
+
+func (mr *memoryMessageRepo) GetWithDeleted(ctx context.Context, messageId int64) (*Message, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	msg, ok := mr.lookup(TenantFrom(ctx), messageId)
+	if !ok {
+		return nil, error_formats.NewNotFoundError()
+	}
+	msg.Tags = copyTags(msg.Tags)
+	return &msg, nil
+}
+
+func (mr *memoryMessageRepo) GetAll() ([]Message, errorutils.MessageErr) {
+	return mr.GetAllContext(context.Background())
+}
+
+func (mr *memoryMessageRepo) GetAllContext(ctx context.Context) ([]Message, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	tenant := TenantFrom(ctx)
+	results := make([]Message, 0, len(mr.messages))
+	for _, msg := range mr.messages {
+		if msg.TenantID == tenant && msg.DeletedAt == nil {
+			msg.Tags = copyTags(msg.Tags)
+			results = append(results, msg)
+		}
+	}
+	if len(results) == 0 {
+		return nil, errorutils.NewNotFoundError("no records found")
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	return results, nil
+}
+
+func (mr *memoryMessageRepo) List(ctx context.Context, opts ListOptions) (*MessagePage, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	cursor, err := opts.cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	tenant := TenantFrom(ctx)
+	title := strings.ToLower(opts.TitleContains)
+	results := make([]Message, 0, len(mr.messages))
+	for _, msg := range mr.messages {
+		if msg.TenantID != tenant || (msg.DeletedAt != nil) != opts.Deleted {
+			continue
+		}
+		if title != "" && !strings.Contains(strings.ToLower(msg.Title), title) {
+			continue
+		}
+		if !opts.CreatedFrom.IsZero() && msg.CreatedAt.Before(opts.CreatedFrom) {
+			continue
+		}
+		if !opts.CreatedTo.IsZero() && !msg.CreatedAt.Before(opts.CreatedTo) {
+			continue
+		}
+		if len(opts.Tags) > 0 && !hasTags(msg.Tags, opts.Tags, opts.TagMatch) {
+			continue
+		}
+		if cursor != nil && !isAfterCursor(msg, cursor, opts.Sort) {
+			continue
+		}
+		msg.Tags = copyTags(msg.Tags)
+		results = append(results, msg)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if opts.Sort == SortDesc {
+			return lessByCreation(results[j], results[i])
+		}
+		return lessByCreation(results[i], results[j])
+	})
+	if len(results) > opts.PageSize+1 {
+		results = results[:opts.PageSize+1]
+	}
+	return newMessagePage(results, opts), nil
+}
+
+func (mr *memoryMessageRepo) Search(ctx context.Context, opts SearchOptions) (*SearchPage, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	offset, _ := opts.offset()
+
+	tenant := TenantFrom(ctx)
+	mr.mu.RLock()
+	hits := make([]SearchHit, 0)
+	for _, msg := range mr.messages {
+		if msg.TenantID != tenant || msg.DeletedAt != nil {
+			continue
+		}
+		if score := likeScore(msg, opts.terms); score > 0 {
+			msg.Tags = copyTags(msg.Tags)
+			hits = append(hits, SearchHit{Message: msg, Score: score})
+		}
+	}
+	mr.mu.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score == hits[j].Score {
+			return hits[i].Message.ID > hits[j].Message.ID
+		}
+		return hits[i].Score > hits[j].Score
+	})
+	if offset > len(hits) {
+		offset = len(hits)
+	}
+	hits = hits[offset:]
+	if len(hits) > opts.PageSize+1 {
+		hits = hits[:opts.PageSize+1]
+	}
+	return newSearchPage(hits, opts, offset), nil
+}
+
+func (mr *memoryMessageRepo) Create(msg *Message) (*Message, errorutils.MessageErr) {
+	return mr.CreateContext(context.Background(), msg)
+}
+
+func (mr *memoryMessageRepo) CreateContext(ctx context.Context, msg *Message) (*Message, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if err := mr.create(TenantFrom(ctx), msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// create must be called with mr.mu held.
+func (mr *memoryMessageRepo) create(tenant string, msg *Message) errorutils.MessageErr {
+	if mr.titleTaken(tenant, msg.Title, 0) {
+		return error_formats.NewDuplicateTitleError()
+	}
+	mr.lastID++
+	msg.ID = mr.lastID
+	msg.Version = 1
+	msg.TenantID = tenant
+	stored := *msg
+	stored.Tags = copyTags(msg.Tags)
+	mr.messages[msg.ID] = stored
+	mr.addRevision(*msg, RevisionCreate, msg.CreatedAt)
+	return nil
+}
+
+func (mr *memoryMessageRepo) Update(msg *Message) (*Message, errorutils.MessageErr) {
+	return mr.UpdateContext(context.Background(), msg)
+}
+
+func (mr *memoryMessageRepo) UpdateContext(ctx context.Context, msg *Message) (*Message, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	current, err := mr.update(TenantFrom(ctx), msg, true)
+	if err != nil {
+		return nil, err
+	}
+	msg.Version = current.Version
+	return msg, nil
+}
+
+// update must be called with mr.mu held. The version of msg is only checked
+// when checkVersion is set.
+func (mr *memoryMessageRepo) update(tenant string, msg *Message, checkVersion bool) (*Message, errorutils.MessageErr) {
+	current, ok := mr.lookup(tenant, msg.ID)
+	if !ok || current.DeletedAt != nil {
+		return nil, error_formats.NewNotFoundError()
+	}
+	if checkVersion && current.Version != msg.Version {
+		return nil, NewVersionConflictError(msg.ID)
+	}
+	if mr.titleTaken(tenant, msg.Title, msg.ID) {
+		return nil, error_formats.NewDuplicateTitleError()
+	}
+	current.Title = msg.Title
+	current.Body = msg.Body
+	if msg.Tags != nil {
+		current.Tags = copyTags(msg.Tags)
+	}
+	current.Version++
+	mr.messages[msg.ID] = current
+	mr.addRevision(current, RevisionUpdate, time.Now())
+	current.Tags = copyTags(current.Tags)
+	return &current, nil
+}
+
+func (mr *memoryMessageRepo) Delete(msgId int64) errorutils.MessageErr {
+	return mr.DeleteContext(context.Background(), msgId)
+}
+
+func (mr *memoryMessageRepo) DeleteContext(ctx context.Context, msgId int64) errorutils.MessageErr {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	return mr.delete(TenantFrom(ctx), msgId, time.Now())
+}
+
+// delete must be called with mr.mu held.
+func (mr *memoryMessageRepo) delete(tenant string, msgId int64, now time.Time) errorutils.MessageErr {
+	msg, ok := mr.lookup(tenant, msgId)
+	if !ok || msg.DeletedAt != nil {
+		return error_formats.NewNotFoundError()
+	}
+	msg.DeletedAt = &now
+	mr.messages[msgId] = msg
+	mr.addRevision(msg, RevisionDelete, now)
+	return nil
+}
+
+func (mr *memoryMessageRepo) CreateMessages(ctx context.Context, msgs []*Message) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	tenant := TenantFrom(ctx)
+	errs := make([]errorutils.MessageErr, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = mr.create(tenant, msg)
+	}
+	return errs, nil
+}
+
+func (mr *memoryMessageRepo) UpdateMessages(ctx context.Context, msgs []*Message) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	tenant := TenantFrom(ctx)
+	errs := make([]errorutils.MessageErr, len(msgs))
+	for i, msg := range msgs {
+		current, err := mr.update(tenant, msg, msg.Version != 0)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		*msg = *current
+	}
+	return errs, nil
+}
+
+func (mr *memoryMessageRepo) DeleteMessages(ctx context.Context, msgIds []int64) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now, tenant := time.Now(), TenantFrom(ctx)
+	errs := make([]errorutils.MessageErr, len(msgIds))
+	for i, id := range msgIds {
+		errs[i] = mr.delete(tenant, id, now)
+	}
+	return errs, nil
+}
+
+func (mr *memoryMessageRepo) Restore(ctx context.Context, msgId int64) errorutils.MessageErr {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	msg, ok := mr.lookup(TenantFrom(ctx), msgId)
+	if !ok || msg.DeletedAt == nil {
+		return error_formats.NewNotFoundError()
+	}
+	msg.DeletedAt = nil
+	mr.messages[msgId] = msg
+	mr.addRevision(msg, RevisionRestore, time.Now())
+	return nil
+}
+
+func (mr *memoryMessageRepo) Purge(ctx context.Context, before time.Time) (int64, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return 0, err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var purged int64
+	for id, msg := range mr.messages {
+		if msg.DeletedAt != nil && msg.DeletedAt.Before(before) {
+			delete(mr.messages, id)
+			delete(mr.revisions, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (mr *memoryMessageRepo) Revisions(ctx context.Context, msgId int64) ([]Revision, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	if _, ok := mr.lookup(TenantFrom(ctx), msgId); !ok {
+		return nil, error_formats.NewNotFoundError()
+	}
+	revisions := mr.revisions[msgId]
+	if len(revisions) == 0 {
+		return nil, error_formats.NewNotFoundError()
+	}
+	return append([]Revision(nil), revisions...), nil
+}
+
+func (mr *memoryMessageRepo) GetRevision(ctx context.Context, msgId int64, revisionId int64) (*Revision, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	if _, ok := mr.lookup(TenantFrom(ctx), msgId); !ok {
+		return nil, error_formats.NewNotFoundError()
+	}
+	for _, rev := range mr.revisions[msgId] {
+		if rev.ID == revisionId {
+			return &rev, nil
+		}
+	}
+	return nil, error_formats.NewNotFoundError()
+}
+
+// Tags counts the tags of the live messages of the tenant of ctx.
+func (mr *memoryMessageRepo) Tags(ctx context.Context) ([]TagCount, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	tenant := TenantFrom(ctx)
+	counts := make(map[string]int64)
+	for _, msg := range mr.messages {
+		if msg.TenantID != tenant || msg.DeletedAt != nil {
+			continue
+		}
+		for _, tag := range msg.Tags {
+			counts[tag]++
+		}
+	}
+	results := make([]TagCount, 0, len(counts))
+	for name, count := range counts {
+		results = append(results, TagCount{Name: name, Count: count})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results, nil
+}
+
+// RenameTag works as the one of the SQL repository, a tag existing for as
+// long as a message of the tenant carries it.
+func (mr *memoryMessageRepo) RenameTag(ctx context.Context, from, to string) (*TagRename, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	tenant := TenantFrom(ctx)
+	rename := &TagRename{From: from, To: to, MessageIDs: make([]int64, 0)}
+	for _, msg := range mr.messages {
+		if msg.TenantID != tenant {
+			continue
+		}
+		if hasTags(msg.Tags, []string{to}, TagMatchAll) {
+			rename.Merged = true
+		}
+		if hasTags(msg.Tags, []string{from}, TagMatchAll) {
+			rename.MessageIDs = append(rename.MessageIDs, msg.ID)
+		}
+	}
+	if len(rename.MessageIDs) == 0 {
+		return nil, NewTagNotFoundError(from)
+	}
+	sort.Slice(rename.MessageIDs, func(i, j int) bool { return rename.MessageIDs[i] < rename.MessageIDs[j] })
+	for _, id := range rename.MessageIDs {
+		msg := mr.messages[id]
+		tags := make([]string, 0, len(msg.Tags))
+		for _, tag := range msg.Tags {
+			if tag == from {
+				tag = to
+			}
+			tags = append(tags, tag)
+		}
+		msg.Tags = NormalizeTags(tags)
+		mr.messages[id] = msg
+	}
+	return rename, nil
+}
+
+// copyTags keeps the stored messages from sharing their tags with the callers.
+func copyTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	return append([]string(nil), tags...)
+}
+
+// addRevision must be called with mr.mu held.
+func (mr *memoryMessageRepo) addRevision(msg Message, action RevisionAction, at time.Time) {
+	mr.lastRevisionID++
+	mr.revisions[msg.ID] = append(mr.revisions[msg.ID], Revision{
+		ID:        mr.lastRevisionID,
+		MessageID: msg.ID,
+		Version:   msg.Version,
+		Title:     msg.Title,
+		Body:      msg.Body,
+		Action:    action,
+		CreatedAt: at,
+	})
+}
+
+// memoryUnitOfWork keeps the repository locked while it works on a copy of
+// it, which becomes the content of the repository on Commit. Only the
+// repository of the unit can be used until then.
+type memoryUnitOfWork struct {
+	parent *memoryMessageRepo
+	repo   *memoryMessageRepo
+	done   bool
+}
+
+func (mr *memoryMessageRepo) Begin(ctx context.Context) (UnitOfWork, errorutils.MessageErr) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	mr.mu.Lock()
+	return &memoryUnitOfWork{parent: mr, repo: mr.clone()}, nil
+}
+
+func (u *memoryUnitOfWork) Repo() messageRepoInterface {
+	return u.repo
+}
+
+func (u *memoryUnitOfWork) Commit() errorutils.MessageErr {
+	if u.done {
+		return errorutils.NewInternalServerError("the transaction is already finished")
+	}
+	u.done = true
+	u.repo.mu.Lock()
+	defer u.repo.mu.Unlock()
+	u.parent.lastID = u.repo.lastID
+	u.parent.messages = u.repo.messages
+	u.parent.lastRevisionID = u.repo.lastRevisionID
+	u.parent.revisions = u.repo.revisions
+	u.parent.mu.Unlock()
+	return nil
+}
+
+func (u *memoryUnitOfWork) Rollback() errorutils.MessageErr {
+	if !u.done {
+		u.done = true
+		u.parent.mu.Unlock()
+	}
+	return nil
+}
+
+// clone must be called with mr.mu held.
+func (mr *memoryMessageRepo) clone() *memoryMessageRepo {
+	c := &memoryMessageRepo{
+		lastID:         mr.lastID,
+		messages:       make(map[int64]Message, len(mr.messages)),
+		lastRevisionID: mr.lastRevisionID,
+		revisions:      make(map[int64][]Revision, len(mr.revisions)),
+	}
+	for id, msg := range mr.messages {
+		c.messages[id] = msg
+	}
+	for id, revisions := range mr.revisions {
+		c.revisions[id] = append([]Revision(nil), revisions...)
+	}
+	return c
+}
+
+// lookup returns the message msgId if it belongs to tenant, deleted or not.
+// It must be called with mr.mu held.
+func (mr *memoryMessageRepo) lookup(tenant string, msgId int64) (Message, bool) {
+	msg, ok := mr.messages[msgId]
+	if !ok || msg.TenantID != tenant {
+		return Message{}, false
+	}
+	return msg, true
+}
+
+// titleTaken tells whether tenant has another message titled title. It must
+// be called with mr.mu held.
+func (mr *memoryMessageRepo) titleTaken(tenant string, title string, exceptID int64) bool {
+	for id, msg := range mr.messages {
+		if id != exceptID && msg.TenantID == tenant && msg.Title == title {
+			return true
+		}
+	}
+	return false
+}
+
+func lessByCreation(a, b Message) bool {
+	if a.CreatedAt.Equal(b.CreatedAt) {
+		return a.ID < b.ID
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+func isAfterCursor(msg Message, cursor *listCursor, order SortOrder) bool {
+	at := Message{ID: cursor.ID, CreatedAt: cursor.CreatedAt}
+	if order == SortDesc {
+		return lessByCreation(msg, at)
+	}
+	return lessByCreation(at, msg)
+}
+
+func contextError(ctx context.Context) errorutils.MessageErr {
+	if err := ctx.Err(); err != nil {
+		return errorutils.NewInternalServerError(fmt.Sprintf("request aborted: %s", err.Error()))
+	}
+	return nil
+}
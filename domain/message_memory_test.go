@@ -0,0 +1,245 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryMessageRepo_CRUD(t *testing.T) {
+	repo := NewMemoryMessageRepository()
+
+	first, err := repo.Create(&Message{Title: "first title", Body: "first body", CreatedAt: created_at})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, first.ID)
+	second, err := repo.Create(&Message{Title: "second title", Body: "second body", CreatedAt: created_at})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, second.ID)
+
+	got, err := repo.Get(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "first title", got.Title)
+
+	_, err = repo.Update(&Message{ID: 1, Title: "updated title", Body: "updated body", Version: 1})
+	assert.Nil(t, err)
+	got, err = repo.Get(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "updated title", got.Title)
+	assert.EqualValues(t, created_at, got.CreatedAt)
+	assert.EqualValues(t, 2, got.Version)
+
+	// an update based on the old version conflicts
+	_, err = repo.Update(&Message{ID: 1, Title: "stale title", Body: "stale body", Version: 1})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusConflict, err.Status())
+
+	all, err := repo.GetAll()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, len(all))
+
+	assert.Nil(t, repo.Delete(1))
+	_, err = repo.Get(1)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+}
+
+// The messages returned must not let the callers change the stored ones
+func TestMemoryMessageRepo_TagsNotShared(t *testing.T) {
+	repo := NewMemoryMessageRepository()
+	ctx := context.Background()
+	_, err := repo.Create(&Message{Title: "title", Body: "body", CreatedAt: created_at, Tags: []string{"go", "work"}})
+	assert.Nil(t, err)
+
+	got, err := repo.Get(1)
+	assert.Nil(t, err)
+	got.Tags[0] = "changed"
+	all, err := repo.GetAll()
+	assert.Nil(t, err)
+	all[0].Tags[0] = "changed"
+	page, err := repo.List(ctx, ListOptions{})
+	assert.Nil(t, err)
+	page.Items[0].Tags[0] = "changed"
+	hits, err := repo.Search(ctx, SearchOptions{Query: "title"})
+	assert.Nil(t, err)
+	hits.Items[0].Message.Tags[0] = "changed"
+	updates := []*Message{{ID: 1, Title: "title", Body: "body", Tags: []string{"go", "work"}}}
+	_, err = repo.UpdateMessages(ctx, updates)
+	assert.Nil(t, err)
+	updates[0].Tags[0] = "changed"
+
+	got, err = repo.Get(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"go", "work"}, got.Tags)
+}
+
+// The errors must be the ones error_formats.ParseError gives for MySQL
+func TestMemoryMessageRepo_Errors(t *testing.T) {
+	repo := NewMemoryMessageRepository()
+
+	_, err := repo.GetAll()
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "no records found", err.Message())
+
+	_, err = repo.Get(42)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "no record matching gived id", err.Message())
+	assert.EqualValues(t, "not_found", err.Error())
+
+	_, err = repo.Update(&Message{ID: 42, Title: "title", Body: "body"})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+
+	err = repo.Delete(42)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+
+	_, err = repo.Create(&Message{Title: "title", Body: "body"})
+	assert.Nil(t, err)
+	_, err = repo.Create(&Message{Title: "title", Body: "other body"})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "title already taken", err.Message())
+
+	_, err = repo.Create(&Message{Title: "other title", Body: "body"})
+	assert.Nil(t, err)
+	_, err = repo.Update(&Message{ID: 2, Title: "title", Body: "body", Version: 1})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "title already taken", err.Message())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = repo.GetContext(ctx, 1)
+	assert.NotNil(t, err)
+}
+
+func TestMemoryMessageRepo_List(t *testing.T) {
+	repo := NewMemoryMessageRepository()
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		_, err := repo.Create(&Message{
+			Title:     fmt.Sprintf("title %d", i),
+			Body:      "body",
+			CreatedAt: base.Add(time.Duration(i) * time.Hour),
+		})
+		assert.Nil(t, err)
+	}
+
+	page, err := repo.List(context.Background(), ListOptions{PageSize: 2})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{1, 2}, ids(page.Items))
+	assert.NotEmpty(t, page.NextCursor)
+
+	// a cursor only pages through the list it was made for
+	for _, opts := range []ListOptions{
+		{PageSize: 2, Cursor: page.NextCursor, Sort: SortDesc},
+		{PageSize: 2, Cursor: page.NextCursor, TitleContains: "title"},
+		{PageSize: 2, Cursor: page.NextCursor, CreatedFrom: base},
+		{PageSize: 2, Cursor: page.NextCursor, Deleted: true},
+		{PageSize: 2, Cursor: page.NextCursor, Tags: []string{"go"}},
+	} {
+		_, err = repo.List(context.Background(), opts)
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusBadRequest, err.Status())
+		}
+	}
+
+	page, err = repo.List(context.Background(), ListOptions{PageSize: 2, Cursor: page.NextCursor})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{3, 4}, ids(page.Items))
+
+	page, err = repo.List(context.Background(), ListOptions{PageSize: 2, Cursor: page.NextCursor})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{5}, ids(page.Items))
+	assert.Empty(t, page.NextCursor)
+
+	page, err = repo.List(context.Background(), ListOptions{Sort: SortDesc, CreatedFrom: base.Add(time.Hour), CreatedTo: base.Add(4 * time.Hour)})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{4, 3, 2}, ids(page.Items))
+
+	page, err = repo.List(context.Background(), ListOptions{TitleContains: "TITLE 3"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{4}, ids(page.Items))
+
+	empty := NewMemoryMessageRepository()
+	page, err = empty.List(context.Background(), ListOptions{})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(page.Items))
+}
+
+func TestMemoryMessageRepo_Concurrent(t *testing.T) {
+	repo := NewMemoryMessageRepository()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msg, err := repo.Create(&Message{Title: fmt.Sprintf("title %d", i), Body: "body"})
+			if err != nil {
+				t.Errorf("Create() error = %v", err)
+				return
+			}
+			if _, err := repo.Get(msg.ID); err != nil {
+				t.Errorf("Get(%d) error = %v", msg.ID, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	all, err := repo.GetAll()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 50, len(all))
+}
+
+func ids(messages []Message) []int64 {
+	result := make([]int64, 0, len(messages))
+	for _, msg := range messages {
+		result = append(result, msg.ID)
+	}
+	return result
+}
+
+func TestMemoryMessageRepo_SoftDelete(t *testing.T) {
+	repo := NewMemoryMessageRepository()
+	ctx := context.Background()
+	_, err := repo.Create(&Message{Title: "kept", Body: "body", CreatedAt: created_at})
+	assert.Nil(t, err)
+	_, err = repo.Create(&Message{Title: "deleted", Body: "body", CreatedAt: created_at})
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.Delete(2))
+	_, err = repo.Get(2)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+	assert.NotNil(t, repo.Delete(2))
+	deleted, err := repo.GetWithDeleted(ctx, 2)
+	assert.Nil(t, err)
+	assert.NotNil(t, deleted.DeletedAt)
+
+	all, err := repo.GetAll()
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{1}, ids(all))
+
+	page, err := repo.List(ctx, ListOptions{Deleted: true})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{2}, ids(page.Items))
+	assert.NotNil(t, page.Items[0].DeletedAt)
+
+	assert.Nil(t, repo.Restore(ctx, 2))
+	assert.NotNil(t, repo.Restore(ctx, 2))
+	got, err := repo.Get(2)
+	assert.Nil(t, err)
+	assert.Nil(t, got.DeletedAt)
+
+	assert.Nil(t, repo.Delete(2))
+	purged, err := repo.Purge(ctx, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, purged)
+	purged, err = repo.Purge(ctx, time.Now().Add(time.Second))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, purged)
+	assert.NotNil(t, repo.Restore(ctx, 2))
+}
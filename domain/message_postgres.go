@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"database/sql"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresMessageRepo runs the SQL message repository on PostgreSQL, which
+// numbers its placeholders and hands back new ids through RETURNING.
+type postgresMessageRepo struct {
+	messageRepo
+}
+
+// NewPostgresMessageRepository wraps a database opened with the "postgres" driver.
+func NewPostgresMessageRepository(db *sql.DB) messageRepoInterface {
+	mr := &postgresMessageRepo{
+		messageRepo{db: db, dialect: postgresDialect},
+	}
+	mr.prepareStatements()
+	return mr
+}
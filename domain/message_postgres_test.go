@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestPostgresMessageRepo_Create(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error %s was not expected when opening a stub database", err)
+	}
+	defer db.Close()
+	expectPreparedExact(mock, postgresDialect)
+	s := NewPostgresMessageRepository(db)
+	tm := time.Now()
+
+	tests := []struct {
+		name    string
+		request *Message
+		mock    func()
+		want    *Message
+		wantErr bool
+	}{
+		{
+			name:    "OK",
+			request: &Message{Title: "title", Body: "body", CreatedAt: tm, AuthorID: "alice"},
+			mock: func() {
+				rows := sqlmock.NewRows([]string{"id"}).AddRow(7)
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO messages(title, body, created_at, version, author_id, tenant_id) VALUES($1, $2, $3, $4, $5, $6) RETURNING id;").WithArgs("title", "body", tm, 1, "alice", "").WillReturnRows(rows)
+				mock.ExpectExec("INSERT INTO message_revisions(message_id, version, title, body, action, created_at) VALUES($1, $2, $3, $4, $5, $6);").
+					WithArgs(7, 1, "title", "body", RevisionCreate, tm).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			want: &Message{ID: 7, Title: "title", Body: "body", CreatedAt: tm, Version: 1, AuthorID: "alice"},
+		},
+		{
+			name:    "Duplicate title",
+			request: &Message{Title: "title", Body: "body", CreatedAt: tm},
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO messages(title, body, created_at, version, author_id, tenant_id) VALUES($1, $2, $3, $4, $5, $6) RETURNING id;").WithArgs("title", "body", tm, 1, nil, "").WillReturnError(&pq.Error{Code: "23505", Message: `duplicate key value violates unique constraint "uq_messages_tenant_title"`})
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+			got, err := s.Create(tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Create() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Create() = %v, want %v", got, tt.want)
+			}
+			if err != nil && err.Message() != "title already taken" {
+				t.Errorf("Create() error message = %q, want the duplicate title one", err.Message())
+			}
+		})
+	}
+}
+
+func TestPostgresMessageRepo_Placeholders(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error %s was not expected when opening a stub database", err)
+	}
+	defer db.Close()
+	expectPreparedExact(mock, postgresDialect)
+	s := NewPostgresMessageRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE messages SET title=$1, body=$2, version=version+1 WHERE id=$3 AND tenant_id=$4 AND version=$5 AND deleted_at IS NULL;").WithArgs("title", "body", 1, "", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO message_revisions(message_id, version, title, body, action, created_at) VALUES($1, $2, $3, $4, $5, $6);").
+		WithArgs(1, 3, "title", "body", RevisionUpdate, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if _, err := s.Update(&Message{ID: 1, Title: "title", Body: "body", Version: 2}); err != nil {
+		t.Errorf("Update() error = %v", err)
+	}
+
+	mock.ExpectQuery("SELECT id, title, body, created_at, version, deleted_at, author_id, tenant_id FROM messages WHERE deleted_at IS NULL AND tenant_id=$1 AND title LIKE $2 ESCAPE '!' ORDER BY created_at ASC, id ASC LIMIT $3;").
+		WithArgs("acme", "%title%", DefaultPageSize+1).WillReturnRows(sqlmock.NewRows([]string{"id", "title", "body", "created_at", "version", "deleted_at", "author_id", "tenant_id"}))
+	if _, err := s.List(WithTenant(context.Background(), "acme"), ListOptions{TitleContains: "title"}); err != nil {
+		t.Errorf("List() error = %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// RevisionAction tells which change produced a revision.
+type RevisionAction string
+
+const (
+	RevisionCreate  RevisionAction = "create"
+	RevisionUpdate  RevisionAction = "update"
+	RevisionDelete  RevisionAction = "delete"
+	RevisionRestore RevisionAction = "restore"
+)
+
+// Revision is a snapshot of a message taken right after each change to it,
+// written in the same transaction as the change.
+type Revision struct {
+	ID        int64          `json:"id"`
+	MessageID int64          `json:"message_id"`
+	Version   int64          `json:"version"`
+	Title     string         `json:"title"`
+	Body      string         `json:"body"`
+	Action    RevisionAction `json:"action"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// DiffOp marks a line of a diff as kept, added or removed.
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = " "
+	DiffInsert DiffOp = "+"
+	DiffDelete DiffOp = "-"
+)
+
+type DiffLine struct {
+	Op   DiffOp `json:"op"`
+	Text string `json:"text"`
+}
+
+// FieldDiff is the line by line difference of a single message field.
+type FieldDiff struct {
+	Field string     `json:"field"`
+	Lines []DiffLine `json:"lines"`
+}
+
+// RevisionDiff lists the fields that changed between two revisions.
+type RevisionDiff struct {
+	MessageID int64       `json:"message_id"`
+	From      int64       `json:"from"`
+	To        int64       `json:"to"`
+	Changes   []FieldDiff `json:"changes"`
+}
+
+// DiffRevisions compares the title and body of two revisions of a message.
+func DiffRevisions(from, to *Revision) *RevisionDiff {
+	diff := &RevisionDiff{
+		MessageID: from.MessageID,
+		From:      from.ID,
+		To:        to.ID,
+		Changes:   make([]FieldDiff, 0, 2),
+	}
+	if from.Title != to.Title {
+		diff.Changes = append(diff.Changes, FieldDiff{Field: "title", Lines: diffLines(from.Title, to.Title)})
+	}
+	if from.Body != to.Body {
+		diff.Changes = append(diff.Changes, FieldDiff{Field: "body", Lines: diffLines(from.Body, to.Body)})
+	}
+	return diff
+}
+
+// diffLines computes a minimal line diff from the longest common subsequence
+// of both texts, which is plenty for message sized inputs.
+func diffLines(a, b string) []DiffLine {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := make([]DiffLine, 0, len(x)+len(y))
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, DiffLine{Op: DiffEqual, Text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Op: DiffDelete, Text: x[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: DiffInsert, Text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		lines = append(lines, DiffLine{Op: DiffDelete, Text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		lines = append(lines, DiffLine{Op: DiffInsert, Text: y[j]})
+	}
+	return lines
+}
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRevisions(t *testing.T) {
+	from := &Revision{ID: 1, MessageID: 1, Title: "title", Body: "one\ntwo\nthree"}
+	to := &Revision{ID: 2, MessageID: 1, Title: "title", Body: "one\n2\nthree\nfour"}
+
+	diff := DiffRevisions(from, to)
+	assert.EqualValues(t, 1, diff.From)
+	assert.EqualValues(t, 2, diff.To)
+	assert.EqualValues(t, []FieldDiff{{
+		Field: "body",
+		Lines: []DiffLine{
+			{Op: DiffEqual, Text: "one"},
+			{Op: DiffDelete, Text: "two"},
+			{Op: DiffInsert, Text: "2"},
+			{Op: DiffEqual, Text: "three"},
+			{Op: DiffInsert, Text: "four"},
+		},
+	}}, diff.Changes)
+
+	assert.Empty(t, DiffRevisions(from, from).Changes)
+
+	diff = DiffRevisions(from, &Revision{ID: 3, Title: "new title", Body: from.Body})
+	assert.Len(t, diff.Changes, 1)
+	assert.EqualValues(t, "title", diff.Changes[0].Field)
+}
+
+func TestMemoryMessageRepo_Revisions(t *testing.T) {
+	testRevisions(t, NewMemoryMessageRepository())
+}
+
+// testRevisions checks the history written by a repository along a message lifetime.
+func testRevisions(t *testing.T, repo messageRepoInterface) {
+	ctx := context.Background()
+	msg, err := repo.Create(&Message{Title: "title", Body: "body", CreatedAt: time.Now()})
+	assert.Nil(t, err)
+	msg.Body = "new body"
+	_, err = repo.Update(msg)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Delete(msg.ID))
+	assert.Nil(t, repo.Restore(ctx, msg.ID))
+
+	revisions, err := repo.Revisions(ctx, msg.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, revisions, 4) {
+		actions := make([]RevisionAction, 0, len(revisions))
+		for _, rev := range revisions {
+			actions = append(actions, rev.Action)
+		}
+		assert.EqualValues(t, []RevisionAction{RevisionCreate, RevisionUpdate, RevisionDelete, RevisionRestore}, actions)
+		assert.EqualValues(t, "body", revisions[0].Body)
+		assert.EqualValues(t, 1, revisions[0].Version)
+		assert.EqualValues(t, "new body", revisions[1].Body)
+		assert.EqualValues(t, 2, revisions[1].Version)
+
+		rev, err := repo.GetRevision(ctx, msg.ID, revisions[0].ID)
+		assert.Nil(t, err)
+		assert.EqualValues(t, revisions[0].ID, rev.ID)
+		assert.EqualValues(t, "body", rev.Body)
+	}
+
+	_, err = repo.GetRevision(ctx, msg.ID+1, revisions[0].ID)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+
+	// a failed update leaves no trace
+	_, err = repo.Update(&Message{ID: msg.ID, Title: "title", Body: "body", Version: 1})
+	assert.NotNil(t, err)
+	revisions, _ = repo.Revisions(ctx, msg.ID)
+	assert.Len(t, revisions, 4)
+
+	assert.Nil(t, repo.Delete(msg.ID))
+	_, err = repo.Purge(ctx, time.Now().Add(time.Second))
+	assert.Nil(t, err)
+	_, err = repo.Revisions(ctx, msg.ID)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+}
@@ -0,0 +1,357 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/silvergama/efficientAPI/utils/error_formats"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+const (
+	// MaxSearchTerms bounds the words and phrases of a query, each of them
+	// costing a LIKE on the backends without a full-text index.
+	MaxSearchTerms = 10
+	// snippetRadius is how much of the body is kept on each side of the
+	// first match, in bytes.
+	snippetRadius = 80
+
+	highlightOpen  = "<mark>"
+	highlightClose = "</mark>"
+
+	queryFullTextSearch = "SELECT " + messageColumns + ", MATCH(title, body) AGAINST (? IN BOOLEAN MODE) AS score FROM messages" +
+		" WHERE deleted_at IS NULL AND tenant_id=? AND MATCH(title, body) AGAINST (? IN BOOLEAN MODE)" +
+		" ORDER BY score DESC, id DESC LIMIT ? OFFSET ?;"
+	// a term found in the title weighs twice one found in the body
+	likeScoreTerm = "(CASE WHEN LOWER(title) LIKE ? ESCAPE '!' THEN 2 ELSE 0 END + CASE WHEN LOWER(body) LIKE ? ESCAPE '!' THEN 1 ELSE 0 END)"
+	likeMatchTerm = "(LOWER(title) LIKE ? ESCAPE '!' OR LOWER(body) LIKE ? ESCAPE '!')"
+)
+
+// SearchOptions selects one page of the messages matching Query. Words
+// must all be found, "quoted phrases" as a whole. Pages follow relevance,
+// so Cursor must be the NextCursor of the previous page of the same query.
+type SearchOptions struct {
+	Query    string
+	PageSize int
+	Cursor   string
+
+	terms []string
+}
+
+// SearchHit is a matching message with its relevance, the higher the
+// better. TitleHighlight and Snippet are HTML escaped with the matches
+// wrapped in <mark> elements.
+type SearchHit struct {
+	Message        Message `json:"message"`
+	Score          float64 `json:"score"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+type SearchPage struct {
+	Items      []SearchHit `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// searchCursor is the offset of the next page, along with a hash of the
+// terms of its query: a cursor used for another query would skip or repeat
+// hits.
+type searchCursor struct {
+	Offset int    `json:"offset"`
+	Terms  string `json:"terms"`
+}
+
+// hashSearchTerms hashes terms regardless of their order, which changes
+// neither the hits nor their scores.
+func hashSearchTerms(terms []string) string {
+	sorted := append([]string(nil), terms...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Validate fills in the defaults and rejects the queries no backend can serve.
+func (o *SearchOptions) Validate() errorutils.MessageErr {
+	if o.PageSize == 0 {
+		o.PageSize = DefaultPageSize
+	}
+	if o.PageSize < 0 || o.PageSize > MaxPageSize {
+		return errorutils.NewBadRequestError("page size must be between 1 and 100")
+	}
+	o.terms = parseSearchQuery(o.Query)
+	if len(o.terms) == 0 {
+		return errorutils.NewBadRequestError("the search query is empty")
+	}
+	if len(o.terms) > MaxSearchTerms {
+		return errorutils.NewBadRequestError(fmt.Sprintf("the search query can't have more than %d terms", MaxSearchTerms))
+	}
+	if _, err := o.offset(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (o *SearchOptions) offset() (int, errorutils.MessageErr) {
+	if o.Cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return 0, errorutils.NewBadRequestError("invalid cursor")
+	}
+	var c searchCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Offset < 0 || c.Terms != hashSearchTerms(o.terms) {
+		return 0, errorutils.NewBadRequestError("invalid cursor")
+	}
+	return c.Offset, nil
+}
+
+// newSearchPage expects up to PageSize+1 hits starting at offset, the extra
+// one only telling that another page exists.
+func newSearchPage(hits []SearchHit, opts SearchOptions, offset int) *SearchPage {
+	page := &SearchPage{Items: hits}
+	if len(hits) > opts.PageSize {
+		page.Items = hits[:opts.PageSize]
+		raw, _ := json.Marshal(searchCursor{Offset: offset + opts.PageSize, Terms: hashSearchTerms(opts.terms)})
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	highlighter := newHighlighter(opts.terms)
+	for i := range page.Items {
+		hit := &page.Items[i]
+		hit.TitleHighlight = highlighter.highlight(hit.Message.Title)
+		hit.Snippet = highlighter.snippet(hit.Message.Body)
+	}
+	return page
+}
+
+// parseSearchQuery splits a query into lower cased words and "quoted
+// phrases", dropping the duplicates.
+func parseSearchQuery(query string) []string {
+	var (
+		terms []string
+		seen  = make(map[string]bool)
+	)
+	add := func(term string) {
+		term = strings.ToLower(strings.Join(strings.Fields(term), " "))
+		if term != "" && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	for i, part := range strings.Split(query, `"`) {
+		// the odd parts are the ones between quotes
+		if i%2 == 1 {
+			add(part)
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			add(word)
+		}
+	}
+	return terms
+}
+
+// fullTextQuery writes terms as a MySQL boolean mode query requiring all
+// of them. The operators of the boolean syntax are stripped from the terms.
+func fullTextQuery(terms []string) string {
+	strip := strings.NewReplacer(`"`, " ", "+", " ", "-", " ", "<", " ", ">", " ", "(", " ", ")", " ", "~", " ", "*", " ", "@", " ")
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		words := strings.Fields(strip.Replace(term))
+		switch len(words) {
+		case 0:
+		case 1:
+			parts = append(parts, "+"+words[0])
+		default:
+			parts = append(parts, `+"`+strings.Join(words, " ")+`"`)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// likeSearchQuery builds the search of terms for the backends without a
+// full-text index, ranking the messages of tenant as likeScore does.
+func likeSearchQuery(tenant string, terms []string, limit, offset int) (string, []interface{}) {
+	scores := make([]string, 0, len(terms))
+	matches := make([]string, 0, len(terms))
+	var scoreArgs, matchArgs []interface{}
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		scores = append(scores, likeScoreTerm)
+		scoreArgs = append(scoreArgs, pattern, pattern)
+		matches = append(matches, likeMatchTerm)
+		matchArgs = append(matchArgs, pattern, pattern)
+	}
+	query := "SELECT " + messageColumns + ", " + strings.Join(scores, " + ") + " AS score FROM messages" +
+		" WHERE deleted_at IS NULL AND tenant_id=? AND " + strings.Join(matches, " AND ") +
+		" ORDER BY score DESC, id DESC LIMIT ? OFFSET ?;"
+	args := append(append(scoreArgs, tenant), matchArgs...)
+	return query, append(args, limit, offset)
+}
+
+// likeScore ranks msg as the LIKE based search does, zero meaning that some
+// term is missing.
+func likeScore(msg Message, terms []string) float64 {
+	title, body := strings.ToLower(msg.Title), strings.ToLower(msg.Body)
+	var score float64
+	for _, term := range terms {
+		inTitle, inBody := strings.Contains(title, term), strings.Contains(body, term)
+		if !inTitle && !inBody {
+			return 0
+		}
+		if inTitle {
+			score += 2
+		}
+		if inBody {
+			score++
+		}
+	}
+	return score
+}
+
+// Search returns one page of the live messages matching opts.Query, the
+// most relevant first. MySQL relies on the FULLTEXT index of title and body,
+// which skips stopwords and words shorter than innodb_ft_min_token_size.
+func (mr *messageRepo) Search(ctx context.Context, opts SearchOptions) (*SearchPage, errorutils.MessageErr) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	offset, _ := opts.offset()
+
+	var (
+		query string
+		args  []interface{}
+	)
+	if mr.dialect.likeSearch {
+		query, args = likeSearchQuery(TenantFrom(ctx), opts.terms, opts.PageSize+1, offset)
+	} else {
+		against := fullTextQuery(opts.terms)
+		if against == "" {
+			return newSearchPage([]SearchHit{}, opts, offset), nil
+		}
+		query, args = queryFullTextSearch, []interface{}{against, TenantFrom(ctx), against, opts.PageSize + 1, offset}
+	}
+
+	rows, err := mr.conn().QueryContext(ctx, mr.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, error_formats.ParseError(err)
+	}
+	defer rows.Close()
+
+	hits := make([]SearchHit, 0, opts.PageSize+1)
+	for rows.Next() {
+		var (
+			hit       SearchHit
+			deletedAt interface{}
+			authorID  sql.NullString
+		)
+		scanErr := rows.Scan(
+			&hit.Message.ID,
+			&hit.Message.Title,
+			&hit.Message.Body,
+			&hit.Message.CreatedAt,
+			&hit.Message.Version,
+			&deletedAt,
+			&authorID,
+			&hit.Message.TenantID,
+			&hit.Score,
+		)
+		if scanErr != nil {
+			return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to search messages %s", scanErr.Error()))
+		}
+		hit.Message.AuthorID = authorID.String
+		hits = append(hits, hit)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, error_formats.ParseError(rowsErr)
+	}
+	rows.Close()
+	msgs := make([]*Message, len(hits))
+	for i := range hits {
+		msgs[i] = &hits[i].Message
+	}
+	if err := mr.loadTags(ctx, mr.conn(), msgs...); err != nil {
+		return nil, err
+	}
+	return newSearchPage(hits, opts, offset), nil
+}
+
+// highlighter marks the terms of a query in the texts of the hits.
+type highlighter struct {
+	re *regexp.Regexp
+}
+
+func newHighlighter(terms []string) *highlighter {
+	if len(terms) == 0 {
+		return &highlighter{}
+	}
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	// longest first, so that a phrase wins over the words it contains
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return &highlighter{re: regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))}
+}
+
+// highlight escapes text and wraps every match in a <mark> element.
+func (h *highlighter) highlight(text string) string {
+	if h.re == nil {
+		return html.EscapeString(text)
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range h.re.FindAllStringIndex(text, -1) {
+		b.WriteString(html.EscapeString(text[last:loc[0]]))
+		b.WriteString(highlightOpen)
+		b.WriteString(html.EscapeString(text[loc[0]:loc[1]]))
+		b.WriteString(highlightClose)
+		last = loc[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// snippet highlights the part of text around its first match, or its
+// beginning when nothing matches.
+func (h *highlighter) snippet(text string) string {
+	start, end := 0, len(text)
+	first := 0
+	if h.re != nil {
+		if loc := h.re.FindStringIndex(text); loc != nil {
+			first = loc[0]
+		}
+	}
+	if first > snippetRadius {
+		start = first - snippetRadius
+	}
+	if end > first+snippetRadius*2 {
+		end = first + snippetRadius*2
+	}
+	// don't cut a character in two
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	snippet := h.highlight(text[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
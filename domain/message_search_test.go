@@ -0,0 +1,184 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	assert.EqualValues(t, []string{"go", "error handling", "tips"}, parseSearchQuery(`Go "Error   handling" tips go`))
+	assert.EqualValues(t, []string{"unterminated phrase"}, parseSearchQuery(`"unterminated phrase`))
+	assert.Empty(t, parseSearchQuery(` "" `))
+}
+
+func TestFullTextQuery(t *testing.T) {
+	assert.EqualValues(t, `+go +"error handling"`, fullTextQuery([]string{"go", "error handling"}))
+	assert.EqualValues(t, `+drop +table`, fullTextQuery([]string{"-drop*", "+table"}))
+	assert.EqualValues(t, ``, fullTextQuery([]string{"***"}))
+}
+
+func TestHighlighter(t *testing.T) {
+	h := newHighlighter(parseSearchQuery(`go "go tips"`))
+	assert.EqualValues(t, "<mark>Go tips</mark> &amp; <mark>go</mark>", h.highlight("Go tips & go"))
+	assert.EqualValues(t, "&lt;b&gt;nothing&lt;/b&gt;", h.highlight("<b>nothing</b>"))
+
+	body := strings.Repeat("a", 200) + " go " + strings.Repeat("b", 200)
+	snippet := h.snippet(body)
+	assert.True(t, strings.HasPrefix(snippet, "…"))
+	assert.True(t, strings.HasSuffix(snippet, "…"))
+	assert.Contains(t, snippet, "<mark>go</mark>")
+
+	assert.EqualValues(t, "short body", h.snippet("short body"))
+	// nothing to match, the beginning is kept whole characters
+	snippet = (&highlighter{}).snippet(strings.Repeat("é", 200))
+	assert.True(t, utf8.ValidString(snippet))
+	assert.True(t, strings.HasSuffix(snippet, "…"))
+}
+
+func TestSearchOptions_Validate(t *testing.T) {
+	opts := SearchOptions{Query: "go"}
+	assert.Nil(t, opts.Validate())
+	assert.EqualValues(t, DefaultPageSize, opts.PageSize)
+
+	for _, opts := range []SearchOptions{
+		{Query: "  "},
+		{Query: "go", PageSize: MaxPageSize + 1},
+		{Query: "go", Cursor: "not a cursor"},
+		{Query: "a b c d e f g h i j k"},
+	} {
+		err := opts.Validate()
+		if assert.NotNil(t, err, opts.Query) {
+			assert.EqualValues(t, http.StatusBadRequest, err.Status())
+		}
+	}
+}
+
+func TestMessageRepo_Search_FullText(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+
+	rows := sqlmock.NewRows([]string{"id", "title", "body", "created_at", "version", "deleted_at", "author_id", "tenant_id", "score"}).
+		AddRow(2, "Go tips", "use go fmt", created_at, 1, nil, nil, "", 3.5).
+		AddRow(1, "Other", "go away", created_at, 1, nil, nil, "", 1.2)
+	mock.ExpectQuery(`SELECT (.+), MATCH\(title, body\) AGAINST \(\? IN BOOLEAN MODE\) AS score FROM messages WHERE deleted_at IS NULL AND tenant_id=\? AND MATCH`).
+		WithArgs(`+go`, "", `+go`, 2, 0).WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT mt.message_id, t.name FROM message_tags mt JOIN tags t ON t.id=mt.tag_id WHERE mt.message_id IN \(\?, \?\)`).WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "name"}).AddRow(2, "golang").AddRow(2, "tips"))
+
+	page, searchErr := s.Search(context.Background(), SearchOptions{Query: "go", PageSize: 1})
+	assert.Nil(t, searchErr)
+	if assert.Len(t, page.Items, 1) {
+		assert.EqualValues(t, 2, page.Items[0].Message.ID)
+		assert.EqualValues(t, []string{"golang", "tips"}, page.Items[0].Message.Tags)
+		assert.EqualValues(t, 3.5, page.Items[0].Score)
+		assert.EqualValues(t, "<mark>Go</mark> tips", page.Items[0].TitleHighlight)
+		assert.EqualValues(t, "use <mark>go</mark> fmt", page.Items[0].Snippet)
+	}
+	assert.NotEmpty(t, page.NextCursor)
+
+	mock.ExpectQuery("SELECT (.+) AS score FROM messages").WithArgs(`+go`, "", `+go`, 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "body", "created_at", "version", "deleted_at", "author_id", "tenant_id", "score"}))
+	page, searchErr = s.Search(context.Background(), SearchOptions{Query: "go", PageSize: 1, Cursor: page.NextCursor})
+	assert.Nil(t, searchErr)
+	assert.Empty(t, page.Items)
+	assert.Empty(t, page.NextCursor)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresMessageRepo_Search(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error %s was not expected when opening a stub database", err)
+	}
+	defer db.Close()
+	expectPreparedExact(mock, postgresDialect)
+	s := NewPostgresMessageRepository(db)
+
+	mock.ExpectQuery("SELECT id, title, body, created_at, version, deleted_at, author_id, tenant_id, "+
+		"(CASE WHEN LOWER(title) LIKE $1 ESCAPE '!' THEN 2 ELSE 0 END + CASE WHEN LOWER(body) LIKE $2 ESCAPE '!' THEN 1 ELSE 0 END) AS score FROM messages "+
+		"WHERE deleted_at IS NULL AND tenant_id=$3 AND (LOWER(title) LIKE $4 ESCAPE '!' OR LOWER(body) LIKE $5 ESCAPE '!') "+
+		"ORDER BY score DESC, id DESC LIMIT $6 OFFSET $7;").
+		WithArgs("%100!%%", "%100!%%", "", "%100!%%", "%100!%%", DefaultPageSize+1, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "body", "created_at", "version", "deleted_at", "author_id", "tenant_id", "score"}).
+			AddRow(1, "title", "100% sure", created_at, 1, nil, nil, "", 1))
+	mock.ExpectQuery("SELECT mt.message_id, t.name FROM message_tags mt JOIN tags t ON t.id=mt.tag_id WHERE mt.message_id IN ($1) ORDER BY t.name;").
+		WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"message_id", "name"}))
+	page, searchErr := s.Search(context.Background(), SearchOptions{Query: "100%"})
+	assert.Nil(t, searchErr)
+	assert.Len(t, page.Items, 1)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMemoryMessageRepo_Search(t *testing.T) {
+	testSearch(t, NewMemoryMessageRepository())
+}
+
+// testSearch checks the matching, ranking and paging of the LIKE based search.
+func testSearch(t *testing.T, repo messageRepoInterface) {
+	ctx := context.Background()
+	for _, msg := range []*Message{
+		{Title: "Error handling", Body: "wrap errors in Go", CreatedAt: time.Now()},
+		{Title: "Go tips", Body: "error handling made easy", CreatedAt: time.Now()},
+		{Title: "Cooking", Body: "handling knives", CreatedAt: time.Now()},
+		{Title: "Deleted go error handling", Body: "gone", CreatedAt: time.Now()},
+	} {
+		_, err := repo.Create(msg)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, repo.Delete(4))
+
+	page, err := repo.Search(ctx, SearchOptions{Query: `"ERROR handling"`})
+	assert.Nil(t, err)
+	// a match in the title ranks first
+	assert.EqualValues(t, []int64{1, 2}, hitIDs(page.Items))
+	assert.EqualValues(t, "<mark>Error handling</mark>", page.Items[0].TitleHighlight)
+
+	page, err = repo.Search(ctx, SearchOptions{Query: "handling go", PageSize: 1})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{2}, hitIDs(page.Items))
+	assert.NotEmpty(t, page.NextCursor)
+	cursor := page.NextCursor
+	page, err = repo.Search(ctx, SearchOptions{Query: "handling go", PageSize: 1, Cursor: cursor})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{1}, hitIDs(page.Items))
+	assert.Empty(t, page.NextCursor)
+	// the order of the terms changes nothing, but the terms themselves do
+	_, err = repo.Search(ctx, SearchOptions{Query: "GO  Handling", PageSize: 1, Cursor: cursor})
+	assert.Nil(t, err)
+	_, err = repo.Search(ctx, SearchOptions{Query: "handling", PageSize: 1, Cursor: cursor})
+	if assert.NotNil(t, err) {
+		assert.EqualValues(t, http.StatusBadRequest, err.Status())
+		assert.EqualValues(t, "invalid cursor", err.Message())
+	}
+
+	page, err = repo.Search(ctx, SearchOptions{Query: "nowhere"})
+	assert.Nil(t, err)
+	assert.NotNil(t, page.Items)
+	assert.Empty(t, page.Items)
+}
+
+func hitIDs(hits []SearchHit) []int64 {
+	ids := make([]int64, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.Message.ID)
+	}
+	return ids
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/silvergama/efficientAPI/migrations"
+)
+
+// sqliteMessageRepo runs the SQL message repository on SQLite, for laptops
+// and embedded deployments without a MySQL server. It shares the "?"
+// placeholders and LastInsertId of MySQL, but searches with LIKE, having no
+// FULLTEXT index, and skips duplicate rows with ON CONFLICT DO NOTHING
+// instead of INSERT IGNORE. See sqliteDialect.
+type sqliteMessageRepo struct {
+	messageRepo
+}
+
+// NewSQLiteMessageRepository wraps a database opened with the "sqlite3" driver.
+// CreateSQLiteSchema must have been run on it.
+func NewSQLiteMessageRepository(db *sql.DB) messageRepoInterface {
+	mr := &sqliteMessageRepo{
+		messageRepo{db: db, dialect: sqliteDialect},
+	}
+	mr.prepareStatements()
+	return mr
+}
+
+// CreateSQLiteSchema brings the schema up to date by applying the pending
+// sqlite3 migrations.
+func CreateSQLiteSchema(db *sql.DB) error {
+	migrator, err := migrations.New(db, "sqlite3")
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Up(context.Background())
+	return err
+}
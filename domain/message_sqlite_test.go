@@ -0,0 +1,243 @@
+//go:build cgo
+// +build cgo
+
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/silvergama/efficientAPI/config"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// openSQLiteTestDatabase opens the sqlite database name with its schema up to date.
+func openSQLiteTestDatabase(tb testing.TB, name string) *sql.DB {
+	db, err := OpenDatabase(context.Background(), config.DBConfig{Driver: config.SQLiteDriver, Name: name, PingAttempts: 1})
+	if err != nil {
+		tb.Fatalf("an error %v was not expected when opening the sqlite database", err)
+	}
+	if err := CreateSQLiteSchema(db); err != nil {
+		db.Close()
+		tb.Fatalf("an error %v was not expected when creating the sqlite schema", err)
+	}
+	return db
+}
+
+func newSQLiteTestRepository(t *testing.T) messageRepoInterface {
+	return NewSQLiteMessageRepository(openSQLiteTestDatabase(t, ":memory:"))
+}
+
+func TestSQLiteMessageRepo_CRUD(t *testing.T) {
+	repo := newSQLiteTestRepository(t)
+	tm := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	msg, err := repo.Create(&Message{Title: "title", Body: "body", CreatedAt: tm, AuthorID: "alice"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, msg.ID)
+
+	got, err := repo.Get(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "title", got.Title)
+	assert.EqualValues(t, "body", got.Body)
+	assert.EqualValues(t, "alice", got.AuthorID)
+	assert.True(t, tm.Equal(got.CreatedAt))
+
+	_, err = repo.Update(&Message{ID: 1, Title: "updated title", Body: "updated body", Version: 1})
+	assert.Nil(t, err)
+	got, err = repo.Get(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "updated title", got.Title)
+	assert.EqualValues(t, 2, got.Version)
+	assert.EqualValues(t, "alice", got.AuthorID)
+
+	_, err = repo.Update(&Message{ID: 1, Title: "stale title", Body: "stale body", Version: 1})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusConflict, err.Status())
+
+	all, err := repo.GetAll()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(all))
+
+	assert.Nil(t, repo.Delete(1))
+	_, err = repo.Get(1)
+	assert.NotNil(t, err)
+}
+
+// SQLite errors must map to the same MessageErr values as the MySQL ones
+func TestSQLiteMessageRepo_Errors(t *testing.T) {
+	repo := newSQLiteTestRepository(t)
+
+	_, err := repo.Get(42)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+	assert.EqualValues(t, "no record matching gived id", err.Message())
+
+	_, err = repo.Create(&Message{Title: "title", Body: "body", CreatedAt: time.Now()})
+	assert.Nil(t, err)
+	_, err = repo.Create(&Message{Title: "title", Body: "other body", CreatedAt: time.Now()})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusConflict, err.Status())
+	assert.EqualValues(t, "title already taken", err.Message())
+}
+
+func TestSQLiteMessageRepo_List(t *testing.T) {
+	repo := newSQLiteTestRepository(t)
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		_, err := repo.Create(&Message{
+			Title:     fmt.Sprintf("title %d", i),
+			Body:      "body",
+			CreatedAt: base.Add(time.Duration(i) * time.Hour),
+		})
+		assert.Nil(t, err)
+	}
+
+	page, err := repo.List(context.Background(), ListOptions{PageSize: 3, Sort: SortDesc})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{5, 4, 3}, ids(page.Items))
+
+	_, err = repo.List(context.Background(), ListOptions{PageSize: 3, Cursor: page.NextCursor})
+	assert.EqualValues(t, http.StatusBadRequest, err.Status())
+	page, err = repo.List(context.Background(), ListOptions{PageSize: 3, Sort: SortDesc, Cursor: page.NextCursor})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{2, 1}, ids(page.Items))
+	assert.Empty(t, page.NextCursor)
+
+	page, err = repo.List(context.Background(), ListOptions{TitleContains: "title 2"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{3}, ids(page.Items))
+}
+
+func TestSQLiteMessageRepo_SoftDelete(t *testing.T) {
+	repo := newSQLiteTestRepository(t)
+	ctx := context.Background()
+	_, err := repo.Create(&Message{Title: "kept", Body: "body", CreatedAt: time.Now()})
+	assert.Nil(t, err)
+	_, err = repo.Create(&Message{Title: "deleted", Body: "body", CreatedAt: time.Now()})
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.Delete(2))
+	_, err = repo.Get(2)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+	deleted, err := repo.GetWithDeleted(ctx, 2)
+	assert.Nil(t, err)
+	assert.NotNil(t, deleted.DeletedAt)
+
+	page, err := repo.List(ctx, ListOptions{})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{1}, ids(page.Items))
+	page, err = repo.List(ctx, ListOptions{Deleted: true})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{2}, ids(page.Items))
+
+	assert.Nil(t, repo.Restore(ctx, 2))
+	_, err = repo.Get(2)
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.Delete(2))
+	purged, err := repo.Purge(ctx, time.Now().Add(time.Second))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, purged)
+	_, err = repo.GetWithDeleted(ctx, 2)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+}
+
+func TestSQLiteMessageRepo_Revisions(t *testing.T) {
+	testRevisions(t, newSQLiteTestRepository(t))
+}
+
+func TestSQLiteMessageRepo_UnitOfWork(t *testing.T) {
+	MessageRepo = newSQLiteTestRepository(t)
+	defer func() { MessageRepo = &messageRepo{} }()
+	ctx := context.Background()
+
+	err := WithTransaction(ctx, func(repo MessageRepository) errorutils.MessageErr {
+		if _, err := repo.CreateContext(ctx, &Message{Title: "dropped", Body: "body", CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+		return errorutils.NewBadRequestError("changed my mind")
+	})
+	assert.NotNil(t, err)
+	_, err = MessageRepo.Get(1)
+	assert.NotNil(t, err)
+
+	err = WithTransaction(ctx, func(repo MessageRepository) errorutils.MessageErr {
+		_, err := repo.CreateContext(ctx, &Message{Title: "kept", Body: "body", CreatedAt: time.Now()})
+		return err
+	})
+	assert.Nil(t, err)
+	page, err := MessageRepo.List(ctx, ListOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, page.Items, 1)
+	revisions, err := MessageRepo.Revisions(ctx, page.Items[0].ID)
+	assert.Nil(t, err)
+	assert.Len(t, revisions, 1)
+}
+
+func TestSQLiteMessageRepo_Batch(t *testing.T) {
+	testBatch(t, newSQLiteTestRepository(t))
+}
+
+func TestSQLiteMessageRepo_Search(t *testing.T) {
+	testSearch(t, newSQLiteTestRepository(t))
+}
+
+func TestSQLiteMessageRepo_TenantIsolation(t *testing.T) {
+	testTenantIsolation(t, newSQLiteTestRepository(t))
+}
+
+func TestSQLiteMessageRepo_Tags(t *testing.T) {
+	testTags(t, newSQLiteTestRepository(t))
+}
+
+// BenchmarkSQLiteMessageRepo_Get compares the lookups with a statement
+// prepared once to the ones preparing it every time on a real database file.
+func BenchmarkSQLiteMessageRepo_Get(b *testing.B) {
+	dir, err := ioutil.TempDir("", "messages")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := openSQLiteTestDatabase(b, filepath.Join(dir, "messages.db"))
+	defer db.Close()
+	repo := NewSQLiteMessageRepository(db)
+	benchmarkGet(b, db, repo, sqliteDialect)
+}
+
+func TestSQLiteAPIKeyRepo(t *testing.T) {
+	db := openSQLiteTestDatabase(t, ":memory:")
+	defer db.Close()
+	testAPIKeyRepository(t, NewAPIKeyRepository(db, config.SQLiteDriver))
+}
+
+func TestSQLiteLoadRBACTables(t *testing.T) {
+	db := openSQLiteTestDatabase(t, ":memory:")
+	defer db.Close()
+
+	roles, bindings, err := LoadRBACTables(context.Background(), db)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string][]string{"member": {"messages:create", "messages:delete", "messages:read", "messages:update", "tags:manage"}}, roles)
+	assert.EqualValues(t, map[string][]string{"@anonymous": {"member"}, "@authenticated": {"member"}}, bindings)
+}
+
+func TestOpenDatabase_LeavesSchema(t *testing.T) {
+	_, db, err := OpenMessageRepository(context.Background(), config.DBConfig{Driver: config.SQLiteDriver, Name: ":memory:", PingAttempts: 1})
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening the sqlite database", err)
+	}
+	defer db.Close()
+
+	var tables int
+	assert.Nil(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='messages';").Scan(&tables))
+	assert.EqualValues(t, 0, tables)
+}
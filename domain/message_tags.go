@@ -0,0 +1,303 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/silvergama/efficientAPI/utils/error_formats"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+const (
+	queryInsertTagsPrefix  = "INSERT INTO tags(tenant_id, name) VALUES "
+	queryGetMessageTagIDs  = "SELECT tag_id FROM message_tags WHERE message_id=?;"
+	queryDeleteMessageTags = "DELETE FROM message_tags WHERE message_id=?;"
+	queryLinkMessageTags   = "INSERT INTO message_tags(message_id, tag_id) SELECT m.id, t.id FROM messages m JOIN tags t ON t.tenant_id=m.tenant_id WHERE m.id=? AND t.name IN (%s);"
+	queryGetMessageTags    = "SELECT mt.message_id, t.name FROM message_tags mt JOIN tags t ON t.id=mt.tag_id WHERE mt.message_id IN (%s) ORDER BY t.name;"
+	queryPurgeMessageTags  = "DELETE FROM message_tags WHERE message_id IN (SELECT id FROM messages WHERE deleted_at IS NOT NULL AND deleted_at < ?);"
+	queryDeleteUnusedTags  = "DELETE FROM tags WHERE id IN (%s) AND NOT EXISTS (SELECT 1 FROM message_tags mt WHERE mt.tag_id=tags.id);"
+	queryPurgeUnusedTags   = "DELETE FROM tags WHERE NOT EXISTS (SELECT 1 FROM message_tags mt WHERE mt.tag_id=tags.id);"
+	queryListTags          = "SELECT t.name, COUNT(*) FROM tags t JOIN message_tags mt ON mt.tag_id=t.id JOIN messages m ON m.id=mt.message_id" +
+		" WHERE t.tenant_id=? AND m.deleted_at IS NULL GROUP BY t.name ORDER BY t.name;"
+	queryGetTagID          = "SELECT id FROM tags WHERE tenant_id=? AND name=?;"
+	queryGetTaggedMessages = "SELECT message_id FROM message_tags WHERE tag_id=? ORDER BY message_id;"
+	queryRenameTag         = "UPDATE tags SET name=? WHERE id=?;"
+	queryMergeMessageTags  = "INSERT INTO message_tags(message_id, tag_id) SELECT mt.message_id, t.id FROM message_tags mt, tags t WHERE mt.tag_id=? AND t.id=?;"
+	queryUnlinkTag         = "DELETE FROM message_tags WHERE tag_id=?;"
+	queryDeleteTag         = "DELETE FROM tags WHERE id=?;"
+)
+
+// TagMatch tells whether the messages listed by tags must have all of them or any.
+type TagMatch string
+
+const (
+	TagMatchAll TagMatch = "all"
+	TagMatchAny TagMatch = "any"
+)
+
+// TagCount is a tag with the number of live messages carrying it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// TagRename is the outcome of renaming a tag. Merged tells the new name was
+// already a tag, which the messages of the old one now carry instead.
+type TagRename struct {
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Merged     bool    `json:"merged"`
+	MessageIDs []int64 `json:"message_ids"`
+}
+
+// CodeTagNotFound identifies the errors of the tags no message ever had.
+const CodeTagNotFound = "tag_not_found"
+
+// NewTagNotFoundError is returned when renaming a tag the tenant doesn't have.
+func NewTagNotFoundError(name string) errorutils.MessageErr {
+	return errorutils.WithCode(errorutils.NewNotFoundError(fmt.Sprintf("tag %q not found", name)), CodeTagNotFound)
+}
+
+// replaceTags makes tags the tags of the message msgId, creating the ones
+// its tenant doesn't have yet. A tag only lives as long as a message carries
+// it, so the ones the message was the last to carry are deleted. Only the
+// tags the message had are looked at: sweeping the whole tenant would scan
+// all its tags and could take one a concurrent write has yet to link, the
+// leftovers being Purge's.
+func (mr *messageRepo) replaceTags(ctx context.Context, tx *sql.Tx, tenant string, msgId int64, tags []string) errorutils.MessageErr {
+	previous, err := mr.messageTagIDs(ctx, tx, msgId)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, mr.dialect.rebind(queryDeleteMessageTags), msgId); err != nil {
+		return error_formats.ParseError(err)
+	}
+	if len(tags) > 0 {
+		args := make([]interface{}, 0, 2*len(tags))
+		names := make([]interface{}, 0, len(tags)+1)
+		names = append(names, msgId)
+		for _, tag := range tags {
+			args = append(args, tenant, tag)
+			names = append(names, tag)
+		}
+		query := queryInsertTagsPrefix + placeholders(len(tags), 2) + ";"
+		if _, err := tx.ExecContext(ctx, mr.dialect.insertIgnore(query), args...); err != nil {
+			return error_formats.ParseError(err)
+		}
+		query = fmt.Sprintf(queryLinkMessageTags, placeholders(len(tags), 1))
+		if _, err := tx.ExecContext(ctx, mr.dialect.rebind(query), names...); err != nil {
+			return error_formats.ParseError(err)
+		}
+	}
+	if len(previous) == 0 {
+		return nil
+	}
+	// the tags the message keeps are linked again by now, so they stay
+	query := fmt.Sprintf(queryDeleteUnusedTags, placeholders(len(previous), 1))
+	if _, err := tx.ExecContext(ctx, mr.dialect.rebind(query), previous...); err != nil {
+		return error_formats.ParseError(err)
+	}
+	return nil
+}
+
+// messageTagIDs returns the ids of the tags of the message msgId.
+func (mr *messageRepo) messageTagIDs(ctx context.Context, tx *sql.Tx, msgId int64) ([]interface{}, errorutils.MessageErr) {
+	rows, err := tx.QueryContext(ctx, mr.dialect.rebind(queryGetMessageTagIDs), msgId)
+	if err != nil {
+		return nil, error_formats.ParseError(err)
+	}
+	defer rows.Close()
+
+	var ids []interface{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, errorutils.NewInternalServerError(fmt.Sprintf("error trying to get tags %s", err.Error()))
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, error_formats.ParseError(err)
+	}
+	return ids, nil
+}
+
+// saveTags runs replaceTags for the msgs with Tags, the others keeping theirs.
+func (mr *messageRepo) saveTags(ctx context.Context, tx *sql.Tx, tenant string, msgs ...*Message) errorutils.MessageErr {
+	for _, msg := range msgs {
+		if msg.Tags == nil {
+			continue
+		}
+		if err := mr.replaceTags(ctx, tx, tenant, msg.ID, msg.Tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTags fills in the Tags of msgs, which must have been read in the
+// tenant of ctx. The rows of the messages must be closed by then, the
+// connection may be the only one.
+func (mr *messageRepo) loadTags(ctx context.Context, conn dbConn, msgs ...*Message) errorutils.MessageErr {
+	byID := make(map[int64][]*Message, len(msgs))
+	for _, msg := range msgs {
+		msg.Tags = nil
+		byID[msg.ID] = append(byID[msg.ID], msg)
+	}
+	for start := 0; start < len(msgs); start += batchChunkSize {
+		end := start + batchChunkSize
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+		ids := make([]interface{}, 0, end-start)
+		for _, msg := range msgs[start:end] {
+			ids = append(ids, msg.ID)
+		}
+		query := fmt.Sprintf(queryGetMessageTags, placeholders(len(ids), 1))
+		rows, err := conn.QueryContext(ctx, mr.dialect.rebind(query), ids...)
+		if err != nil {
+			return error_formats.ParseError(err)
+		}
+		for rows.Next() {
+			var (
+				id   int64
+				name string
+			)
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return errorutils.NewInternalServerError(fmt.Sprintf("error trying to get tags %s", err.Error()))
+			}
+			for _, msg := range byID[id] {
+				msg.Tags = append(msg.Tags, name)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return error_formats.ParseError(err)
+		}
+	}
+	return nil
+}
+
+// Tags returns the tags of the tenant of ctx carried by live messages, by
+// name, with how many of them do.
+func (mr *messageRepo) Tags(ctx context.Context) ([]TagCount, errorutils.MessageErr) {
+	rows, err := mr.conn().QueryContext(ctx, mr.dialect.rebind(queryListTags), TenantFrom(ctx))
+	if err != nil {
+		return nil, error_formats.ParseError(err)
+	}
+	defer rows.Close()
+
+	results := make([]TagCount, 0)
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, errorutils.NewInternalServerError(fmt.Sprintf("Error when trying to list tags %s", err.Error()))
+		}
+		results = append(results, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, error_formats.ParseError(err)
+	}
+	return results, nil
+}
+
+// RenameTag renames the tag from to to across the messages of the tenant of
+// ctx, deleted ones included. When to is a tag already, from is merged into
+// it. The tags no message carries are deleted by replaceTags and Purge, so
+// from is only found, and to only merged into, while a message has them.
+// Neither the versions nor the histories of the messages change.
+func (mr *messageRepo) RenameTag(ctx context.Context, from, to string) (*TagRename, errorutils.MessageErr) {
+	tenant := TenantFrom(ctx)
+	rename := &TagRename{From: from, To: to}
+	err := mr.inTx(ctx, func(tx *sql.Tx) errorutils.MessageErr {
+		fromID, found, err := mr.tagID(ctx, tx, tenant, from)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return NewTagNotFoundError(from)
+		}
+		if rename.MessageIDs, err = mr.taggedMessages(ctx, tx, fromID); err != nil {
+			return err
+		}
+
+		toID, found, err := mr.tagID(ctx, tx, tenant, to)
+		if err != nil {
+			return err
+		}
+		if !found {
+			if _, err := tx.ExecContext(ctx, mr.dialect.rebind(queryRenameTag), to, fromID); err != nil {
+				return error_formats.ParseError(err)
+			}
+			return nil
+		}
+
+		rename.Merged = true
+		if _, err := tx.ExecContext(ctx, mr.dialect.insertIgnore(queryMergeMessageTags), fromID, toID); err != nil {
+			return error_formats.ParseError(err)
+		}
+		if _, err := tx.ExecContext(ctx, mr.dialect.rebind(queryUnlinkTag), fromID); err != nil {
+			return error_formats.ParseError(err)
+		}
+		if _, err := tx.ExecContext(ctx, mr.dialect.rebind(queryDeleteTag), fromID); err != nil {
+			return error_formats.ParseError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rename, nil
+}
+
+func (mr *messageRepo) tagID(ctx context.Context, tx *sql.Tx, tenant string, name string) (int64, bool, errorutils.MessageErr) {
+	var id int64
+	err := tx.QueryRowContext(ctx, mr.dialect.rebind(queryGetTagID), tenant, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, error_formats.ParseError(err)
+	}
+	return id, true, nil
+}
+
+func (mr *messageRepo) taggedMessages(ctx context.Context, tx *sql.Tx, tagId int64) ([]int64, errorutils.MessageErr) {
+	rows, err := tx.QueryContext(ctx, mr.dialect.rebind(queryGetTaggedMessages), tagId)
+	if err != nil {
+		return nil, error_formats.ParseError(err)
+	}
+	defer rows.Close()
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, errorutils.NewInternalServerError(fmt.Sprintf("error trying to rename tag %s", err.Error()))
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, error_formats.ParseError(err)
+	}
+	return ids, nil
+}
+
+// hasTags tells whether tags holds the wanted ones, all of them or any
+// depending on match. Both are normalized.
+func hasTags(tags []string, wanted []string, match TagMatch) bool {
+	found := 0
+	for _, want := range wanted {
+		for _, tag := range tags {
+			if tag == want {
+				found++
+				break
+			}
+		}
+	}
+	if match == TagMatchAny {
+		return found > 0
+	}
+	return found == len(wanted)
+}
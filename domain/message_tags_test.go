@@ -0,0 +1,262 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func listIDs(t *testing.T, repo messageRepoInterface, ctx context.Context, opts ListOptions) []int64 {
+	t.Helper()
+	page, err := repo.List(ctx, opts)
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	return ids(page.Items)
+}
+
+// testTags checks the tagging, filtering and renaming of tags, whatever the
+// repository.
+func testTags(t *testing.T, repo messageRepoInterface) {
+	ctx := context.Background()
+	tm := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	create := func(title string, tags ...string) *Message {
+		msg, err := repo.CreateContext(ctx, &Message{Title: title, Body: "body", CreatedAt: tm, Tags: tags})
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+		return msg
+	}
+	a := create("a", "go", "work")
+	b := create("b", "work")
+	c := create("c", "go", "personal")
+	d := create("d")
+
+	got, err := repo.GetContext(ctx, a.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"go", "work"}, got.Tags)
+	got, err = repo.GetContext(ctx, d.ID)
+	assert.Nil(t, err)
+	assert.Empty(t, got.Tags)
+	all, err := repo.GetAllContext(ctx)
+	assert.Nil(t, err)
+	for _, msg := range all {
+		if msg.ID == b.ID {
+			assert.EqualValues(t, []string{"work"}, msg.Tags)
+		}
+	}
+	hits, err := repo.Search(ctx, SearchOptions{Query: "c"})
+	assert.Nil(t, err)
+	if assert.Len(t, hits.Items, 1) {
+		assert.EqualValues(t, []string{"go", "personal"}, hits.Items[0].Message.Tags)
+	}
+
+	assert.EqualValues(t, []int64{a.ID, b.ID}, listIDs(t, repo, ctx, ListOptions{Tags: []string{"work"}}))
+	assert.EqualValues(t, []int64{a.ID}, listIDs(t, repo, ctx, ListOptions{Tags: []string{"go", "work"}}))
+	assert.EqualValues(t, []int64{a.ID, b.ID, c.ID}, listIDs(t, repo, ctx, ListOptions{Tags: []string{"go", "work"}, TagMatch: TagMatchAny}))
+	assert.Empty(t, listIDs(t, repo, ctx, ListOptions{Tags: []string{"unknown"}}))
+	// the filters are normalized like the tags
+	assert.EqualValues(t, []int64{b.ID}, listIDs(t, repo, ctx, ListOptions{Tags: []string{" WORK"}, TitleContains: "b"}))
+
+	tags, err := repo.Tags(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []TagCount{{"go", 2}, {"personal", 1}, {"work", 2}}, tags)
+
+	// nil tags leave them as they are, an empty slice removes them
+	_, err = repo.UpdateContext(ctx, &Message{ID: b.ID, Title: "b", Body: "new body", Version: 1})
+	assert.Nil(t, err)
+	got, _ = repo.GetContext(ctx, b.ID)
+	assert.EqualValues(t, []string{"work"}, got.Tags)
+	_, err = repo.UpdateContext(ctx, &Message{ID: b.ID, Title: "b", Body: "new body", Version: 2, Tags: []string{}})
+	assert.Nil(t, err)
+	got, _ = repo.GetContext(ctx, b.ID)
+	assert.Empty(t, got.Tags)
+	updates := []*Message{{ID: d.ID, Title: "d", Body: "body", Tags: []string{"urgent"}}}
+	errs, err := repo.UpdateMessages(ctx, updates)
+	assert.Nil(t, err)
+	assert.Nil(t, errs[0])
+	assert.EqualValues(t, []string{"urgent"}, updates[0].Tags)
+
+	// the deleted messages aren't counted, but keep their tags
+	assert.Nil(t, repo.DeleteContext(ctx, c.ID))
+	tags, err = repo.Tags(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []TagCount{{"go", 1}, {"urgent", 1}, {"work", 1}}, tags)
+
+	// a tag goes with the last message carrying it, it can't be renamed nor merged into
+	_, err = repo.UpdateContext(ctx, &Message{ID: d.ID, Title: "d", Body: "body", Version: 2, Tags: []string{"job"}})
+	assert.Nil(t, err)
+	_, err = repo.UpdateContext(ctx, &Message{ID: d.ID, Title: "d", Body: "body", Version: 3, Tags: []string{}})
+	assert.Nil(t, err)
+	_, err = repo.RenameTag(ctx, "urgent", "later")
+	assertNotFound(t, err)
+
+	rename, err := repo.RenameTag(ctx, "work", "job")
+	assert.Nil(t, err)
+	assert.EqualValues(t, &TagRename{From: "work", To: "job", MessageIDs: []int64{a.ID}}, rename)
+	got, _ = repo.GetContext(ctx, a.ID)
+	assert.EqualValues(t, []string{"go", "job"}, got.Tags)
+
+	rename, err = repo.RenameTag(ctx, "go", "job")
+	assert.Nil(t, err)
+	assert.True(t, rename.Merged)
+	assert.EqualValues(t, []int64{a.ID, c.ID}, rename.MessageIDs)
+	got, _ = repo.GetContext(ctx, a.ID)
+	assert.EqualValues(t, []string{"job"}, got.Tags)
+	assert.Nil(t, repo.Restore(ctx, c.ID))
+	got, _ = repo.GetContext(ctx, c.ID)
+	assert.EqualValues(t, []string{"job", "personal"}, got.Tags)
+
+	_, err = repo.RenameTag(ctx, "go", "golang")
+	if assert.NotNil(t, err) {
+		assert.EqualValues(t, http.StatusNotFound, err.Status())
+		assert.EqualValues(t, CodeTagNotFound, err.Code())
+	}
+
+	// tags belong to a tenant
+	acme := WithTenant(ctx, "acme")
+	other, err := repo.CreateContext(acme, &Message{Title: "a", Body: "body", CreatedAt: tm, Tags: []string{"job"}})
+	assert.Nil(t, err)
+	tags, err = repo.Tags(acme)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []TagCount{{"job", 1}}, tags)
+	assert.EqualValues(t, []int64{other.ID}, listIDs(t, repo, acme, ListOptions{Tags: []string{"job"}}))
+	_, err = repo.RenameTag(acme, "urgent", "later")
+	assertNotFound(t, err)
+	rename, err = repo.RenameTag(acme, "job", "task")
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{other.ID}, rename.MessageIDs)
+	got, _ = repo.GetContext(ctx, a.ID)
+	assert.EqualValues(t, []string{"job"}, got.Tags)
+}
+
+func TestMemoryMessageRepo_Tags(t *testing.T) {
+	testTags(t, NewMemoryMessageRepository())
+}
+
+func TestCachedMessageRepo_RenameTag(t *testing.T) {
+	repo := NewCachedMessageRepository(NewMemoryMessageRepository(), NewLRUCacheStore(10), time.Minute)
+	msg, err := repo.CreateContext(context.Background(), &Message{Title: "title", Body: "body", CreatedAt: created_at, Tags: []string{"work"}})
+	assert.Nil(t, err)
+	_, err = repo.GetContext(context.Background(), msg.ID)
+	assert.Nil(t, err)
+
+	// the renamed messages are evicted
+	_, err = repo.RenameTag(context.Background(), "work", "job")
+	assert.Nil(t, err)
+	got, err := repo.GetContext(context.Background(), msg.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"job"}, got.Tags)
+	assert.EqualValues(t, 2, repo.Stats().Misses)
+}
+
+func TestListOptions_Validate_Tags(t *testing.T) {
+	opts := ListOptions{Tags: []string{"Work", "work "}, TagMatch: "ANY"}
+	assert.Nil(t, opts.Validate())
+	assert.EqualValues(t, []string{"work"}, opts.Tags)
+	assert.EqualValues(t, TagMatchAny, opts.TagMatch)
+
+	opts = ListOptions{Tags: []string{"work"}}
+	assert.Nil(t, opts.Validate())
+	assert.EqualValues(t, TagMatchAll, opts.TagMatch)
+
+	for _, opts := range []ListOptions{
+		{Tags: []string{"work"}, TagMatch: "some"},
+		{Tags: []string{""}},
+	} {
+		err := opts.Validate()
+		if assert.NotNil(t, err) {
+			assert.EqualValues(t, http.StatusBadRequest, err.Status())
+		}
+	}
+}
+
+func TestMessageRepo_Tags_SQL(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPreparedExact(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO messages(title, body, created_at, version, author_id, tenant_id) VALUES(?, ?, ?, ?, ?, ?);").
+		WithArgs("title", "body", created_at, 1, nil, "acme").WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectQuery("SELECT tag_id FROM message_tags WHERE message_id=?;").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"tag_id"}))
+	mock.ExpectExec("DELETE FROM message_tags WHERE message_id=?;").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT IGNORE INTO tags(tenant_id, name) VALUES (?, ?), (?, ?);").
+		WithArgs("acme", "go", "acme", "work").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO message_tags(message_id, tag_id) SELECT m.id, t.id FROM messages m JOIN tags t ON t.tenant_id=m.tenant_id WHERE m.id=? AND t.name IN (?, ?);").
+		WithArgs(3, "go", "work").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO message_revisions(message_id, version, title, body, action, created_at) VALUES(?, ?, ?, ?, ?, ?);").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	acme := WithTenant(context.Background(), "acme")
+	_, createErr := s.CreateContext(acme, &Message{Title: "title", Body: "body", CreatedAt: created_at, Tags: []string{"go", "work"}})
+	assert.Nil(t, createErr)
+
+	// only the tags the message had may go, never the whole tenant's
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE messages SET title=?, body=?, version=version+1 WHERE id=? AND tenant_id=? AND version=? AND deleted_at IS NULL;").
+		WithArgs("title", "body", 3, "acme", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT tag_id FROM message_tags WHERE message_id=?;").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"tag_id"}).AddRow(1).AddRow(2))
+	mock.ExpectExec("DELETE FROM message_tags WHERE message_id=?;").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT IGNORE INTO tags(tenant_id, name) VALUES (?, ?);").
+		WithArgs("acme", "go").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO message_tags(message_id, tag_id) SELECT m.id, t.id FROM messages m JOIN tags t ON t.tenant_id=m.tenant_id WHERE m.id=? AND t.name IN (?);").
+		WithArgs(3, "go").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM tags WHERE id IN (?, ?) AND NOT EXISTS (SELECT 1 FROM message_tags mt WHERE mt.tag_id=tags.id);").
+		WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO message_revisions(message_id, version, title, body, action, created_at) VALUES(?, ?, ?, ?, ?, ?);").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+	_, updateErr := s.UpdateContext(acme, &Message{ID: 3, Title: "title", Body: "body", Version: 1, Tags: []string{"go"}})
+	assert.Nil(t, updateErr)
+
+	mock.ExpectQuery("SELECT id, title, body, created_at, version, deleted_at, author_id, tenant_id FROM messages WHERE deleted_at IS NULL AND tenant_id=? AND id IN "+
+		"(SELECT mt.message_id FROM message_tags mt JOIN tags t ON t.id=mt.tag_id WHERE t.tenant_id=? AND t.name IN (?, ?) GROUP BY mt.message_id HAVING COUNT(*)=?) "+
+		"ORDER BY created_at ASC, id ASC LIMIT ?;").
+		WithArgs("acme", "acme", "go", "work", 2, DefaultPageSize+1).WillReturnRows(sqlmock.NewRows(messageRow))
+	_, listErr := s.List(acme, ListOptions{Tags: []string{"work", "go"}})
+	assert.Nil(t, listErr)
+
+	mock.ExpectQuery("SELECT t.name, COUNT(*) FROM tags t JOIN message_tags mt ON mt.tag_id=t.id JOIN messages m ON m.id=mt.message_id" +
+		" WHERE t.tenant_id=? AND m.deleted_at IS NULL GROUP BY t.name ORDER BY t.name;").
+		WithArgs("acme").WillReturnRows(sqlmock.NewRows([]string{"name", "count"}).AddRow("go", 1).AddRow("work", 4))
+	tags, tagsErr := s.Tags(acme)
+	assert.Nil(t, tagsErr)
+	assert.EqualValues(t, []TagCount{{"go", 1}, {"work", 4}}, tags)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM tags WHERE tenant_id=? AND name=?;").WithArgs("acme", "go").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT message_id FROM message_tags WHERE tag_id=? ORDER BY message_id;").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"message_id"}).AddRow(3))
+	mock.ExpectQuery("SELECT id FROM tags WHERE tenant_id=? AND name=?;").WithArgs("acme", "work").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec("INSERT IGNORE INTO message_tags(message_id, tag_id) SELECT mt.message_id, t.id FROM message_tags mt, tags t WHERE mt.tag_id=? AND t.id=?;").
+		WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM message_tags WHERE tag_id=?;").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM tags WHERE id=?;").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	rename, renameErr := s.RenameTag(acme, "go", "work")
+	assert.Nil(t, renameErr)
+	assert.EqualValues(t, &TagRename{From: "go", To: "work", Merged: true, MessageIDs: []int64{3}}, rename)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM tags WHERE tenant_id=? AND name=?;").WithArgs("acme", "go").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+	_, renameErr = s.RenameTag(acme, "go", "work")
+	assert.EqualValues(t, CodeTagNotFound, renameErr.Code())
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDialect_InsertIgnore(t *testing.T) {
+	query := "INSERT INTO tags(tenant_id, name) VALUES (?, ?);"
+	assert.EqualValues(t, "INSERT IGNORE INTO tags(tenant_id, name) VALUES (?, ?);", mysqlDialect.insertIgnore(query))
+	assert.EqualValues(t, "INSERT INTO tags(tenant_id, name) VALUES (?, ?) ON CONFLICT DO NOTHING;", sqliteDialect.insertIgnore(query))
+	assert.EqualValues(t, "INSERT INTO tags(tenant_id, name) VALUES ($1, $2) ON CONFLICT DO NOTHING;", postgresDialect.insertIgnore(query))
+}
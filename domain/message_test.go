@@ -1,9 +1,13 @@
 package domain
 
 import (
+	"context"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"net/http"
 	"reflect"
+	"regexp"
 	"testing"
 	"time"
 
@@ -12,12 +16,34 @@ import (
 
 var created_at = time.Now()
 
+// expectPrepared expects the statements a repository of dialect d prepares
+// when it is built, which the expectations of its queries then run on.
+func expectPrepared(mock sqlmock.Sqlmock, d dialect) {
+	for _, query := range d.preparedQueries() {
+		mock.ExpectPrepare(regexp.QuoteMeta(query))
+	}
+}
+
+// expectNoTags expects the tags of the messages just read to be loaded,
+// finding none.
+func expectNoTags(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT (.+) FROM message_tags").WillReturnRows(sqlmock.NewRows([]string{"message_id", "name"}))
+}
+
+// expectPreparedExact is expectPrepared for the mocks matching queries with sqlmock.QueryMatcherEqual.
+func expectPreparedExact(mock sqlmock.Sqlmock, d dialect) {
+	for _, query := range d.preparedQueries() {
+		mock.ExpectPrepare(query)
+	}
+}
+
 func TestMessageRepo_Get(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("an error %s was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
 	s := NewMessageRepository(db)
 
 	test := []struct {
@@ -40,19 +66,32 @@ func TestMessageRepo_Get(t *testing.T) {
 					"Title",
 					"Body",
 					"CreatedAt",
+					"Version",
+					"DeletedAt",
+					"AuthorID",
+					"TenantID",
 				}).AddRow(
 					1,
 					"title",
 					"body",
 					created_at,
+					1,
+					nil,
+					"alice",
+					"",
 				)
-				mock.ExpectPrepare("SELECT (.+) FROM messages").ExpectQuery().WithArgs(1).WillReturnRows(rows)
+				mock.ExpectQuery("SELECT (.+) FROM messages").WithArgs(1, "").WillReturnRows(rows)
+				mock.ExpectQuery(`SELECT (.+) FROM message_tags mt JOIN tags t ON t.id=mt.tag_id WHERE mt.message_id IN \(\?\)`).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"message_id", "name"}).AddRow(1, "work"))
 			},
 			want: &Message{
 				ID:        1,
 				Title:     "title",
 				Body:      "body",
 				CreatedAt: created_at,
+				Version:   1,
+				AuthorID:  "alice",
+				Tags:      []string{"work"},
 			},
 		},
 		{
@@ -67,7 +106,7 @@ func TestMessageRepo_Get(t *testing.T) {
 					"Body",
 					"CreatedAt",
 				}) // observe that we didn't add any role  here
-				mock.ExpectPrepare("SELECT (.+) FROM messages").ExpectQuery().WithArgs(1).WillReturnRows(rows)
+				mock.ExpectQuery("SELECT (.+) FROM messages").WithArgs(1, "").WillReturnRows(rows)
 			},
 			wantErr: true,
 		},
@@ -83,7 +122,7 @@ func TestMessageRepo_Get(t *testing.T) {
 					"Body",
 					"CreatedAt",
 				}).AddRow(1, "title", "body", created_at)
-				mock.ExpectPrepare("SELECT (.+) FROM wrong_table").ExpectQuery().WithArgs(1).WillReturnRows(rows)
+				mock.ExpectQuery("SELECT (.+) FROM wrong_table").WithArgs(1).WillReturnRows(rows)
 			},
 			wantErr: true,
 		},
@@ -110,6 +149,7 @@ func TestMessageRepo_Create(t *testing.T) {
 		t.Fatalf("an error %s was not expected when opening a stub database", err)
 	}
 	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
 	s := NewMessageRepository(db)
 	tm := time.Now()
 
@@ -130,13 +170,17 @@ func TestMessageRepo_Create(t *testing.T) {
 				CreatedAt: tm,
 			},
 			mock: func() {
-				mock.ExpectPrepare("INSERT INTO messages").ExpectExec().WithArgs("title", "body", tm).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO messages").WithArgs("title", "body", tm, 1, nil, "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO message_revisions").WithArgs(1, 1, "title", "body", RevisionCreate, tm).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 			},
 			want: &Message{
 				ID:        1,
 				Title:     "title",
 				Body:      "body",
 				CreatedAt: tm,
+				Version:   1,
 			},
 		},
 		{
@@ -148,7 +192,7 @@ func TestMessageRepo_Create(t *testing.T) {
 				CreatedAt: tm,
 			},
 			mock: func() {
-				mock.ExpectPrepare("INSERT INTO messges").ExpectExec().WithArgs("title", "body", tm).WillReturnError(errors.New("empty title"))
+				mock.ExpectExec("INSERT INTO messges").WithArgs("title", "body", tm).WillReturnError(errors.New("empty title"))
 			},
 			wantErr: true,
 		},
@@ -161,7 +205,7 @@ func TestMessageRepo_Create(t *testing.T) {
 				CreatedAt: tm,
 			},
 			mock: func() {
-				mock.ExpectPrepare("INSERT INTO messages").ExpectQuery().WithArgs("title", "body", tm).WillReturnError(errors.New("empty body"))
+				mock.ExpectQuery("INSERT INTO messages").WithArgs("title", "body", tm).WillReturnError(errors.New("empty body"))
 			},
 			wantErr: true,
 		},
@@ -174,7 +218,7 @@ func TestMessageRepo_Create(t *testing.T) {
 				CreatedAt: tm,
 			},
 			mock: func() {
-				mock.ExpectPrepare("INSERT INTO wrong_table").ExpectQuery().WithArgs("title", "body", tm).WillReturnError(errors.New("invalid sql query"))
+				mock.ExpectQuery("INSERT INTO wrong_table").WithArgs("title", "body", tm).WillReturnError(errors.New("invalid sql query"))
 			},
 			wantErr: true,
 		},
@@ -201,6 +245,7 @@ func TestMessageRepo_Update(t *testing.T) {
 		t.Fatalf("an error %v was not expected when opening a stab database", err)
 	}
 	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
 	s := NewMessageRepository(db)
 
 	tests := []struct {
@@ -215,18 +260,40 @@ func TestMessageRepo_Update(t *testing.T) {
 			name: "OK",
 			s:    s,
 			request: &Message{
-				ID:    1,
-				Title: "update title",
-				Body:  "update body",
+				ID:      1,
+				Title:   "update title",
+				Body:    "update body",
+				Version: 1,
 			},
 			mock: func() {
-				mock.ExpectPrepare("UPDATE messages").ExpectExec().WithArgs("update title", "update body", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE messages").WithArgs("update title", "update body", 1, "", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO message_revisions").WithArgs(1, 2, "update title", "update body", RevisionUpdate, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 			},
 			want: &Message{
-				ID:    1,
-				Title: "update title",
-				Body:  "update body",
+				ID:      1,
+				Title:   "update title",
+				Body:    "update body",
+				Version: 2,
+			},
+		},
+		{
+			// When the message changed since it was read
+			name: "Version conflict",
+			s:    s,
+			request: &Message{
+				ID:      1,
+				Title:   "update title",
+				Body:    "update body",
+				Version: 1,
+			},
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE messages").WithArgs("update title", "update body", 1, "", 1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
 			},
+			wantErr: true,
 		},
 		{
 			name: "Invalid SQL Query",
@@ -237,7 +304,7 @@ func TestMessageRepo_Update(t *testing.T) {
 				Body:  "update body",
 			},
 			mock: func() {
-				mock.ExpectPrepare("UPDATER messages").ExpectExec().WithArgs("update title", "update body", 1).WillReturnError(errors.New("error in sql query statements"))
+				mock.ExpectExec("UPDATER messages").WithArgs("update title", "update body", 1).WillReturnError(errors.New("error in sql query statements"))
 			},
 			wantErr: true,
 		},
@@ -250,7 +317,7 @@ func TestMessageRepo_Update(t *testing.T) {
 				Body:  "update body",
 			},
 			mock: func() {
-				mock.ExpectPrepare("UPDATE messages").ExpectExec().WithArgs("update title", "update body", 0).WillReturnError(errors.New("invalid update id"))
+				mock.ExpectExec("UPDATE messages").WithArgs("update title", "update body", 0).WillReturnError(errors.New("invalid update id"))
 			},
 			wantErr: true,
 		},
@@ -263,7 +330,7 @@ func TestMessageRepo_Update(t *testing.T) {
 				Body:  "update body",
 			},
 			mock: func() {
-				mock.ExpectPrepare("UPDATE messages").ExpectExec().WithArgs("", "update body", 1).WillReturnError(errors.New("Please enter a valid title"))
+				mock.ExpectExec("UPDATE messages").WithArgs("", "update body", 1).WillReturnError(errors.New("Please enter a valid title"))
 			},
 			wantErr: true,
 		},
@@ -276,7 +343,7 @@ func TestMessageRepo_Update(t *testing.T) {
 				Body:  "",
 			},
 			mock: func() {
-				mock.ExpectPrepare("UPDATE messages").ExpectExec().WithArgs("update title", "", 1).WillReturnError(errors.New("Please enter a valid body"))
+				mock.ExpectExec("UPDATE messages").WithArgs("update title", "", 1).WillReturnError(errors.New("Please enter a valid body"))
 			},
 			wantErr: true,
 		},
@@ -289,7 +356,7 @@ func TestMessageRepo_Update(t *testing.T) {
 				Body:  "update body",
 			},
 			mock: func() {
-				mock.ExpectPrepare("UPDATE messages").ExpectExec().WithArgs("update title", "update body", 1).WillReturnResult(sqlmock.NewErrorResult(errors.New("failed update")))
+				mock.ExpectExec("UPDATE messages").WithArgs("update title", "update body", 1).WillReturnResult(sqlmock.NewErrorResult(errors.New("failed update")))
 			},
 			wantErr: true,
 		},
@@ -317,6 +384,7 @@ func TestMessageRepo_GetAll(t *testing.T) {
 		t.Errorf("un error %v was not expected when opening a stub database conection", err)
 	}
 	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
 	s := NewMessageRepository(db)
 
 	tests := []struct {
@@ -331,8 +399,9 @@ func TestMessageRepo_GetAll(t *testing.T) {
 			name: "OK",
 			s:    s,
 			mock: func() {
-				rows := sqlmock.NewRows([]string{"Id", "Title", "Body", "CreatedAt"}).AddRow(1, "first title", "first body", created_at).AddRow(2, "second title", "second body", created_at)
-				mock.ExpectPrepare("SELECT (.+) FROM messages").ExpectQuery().WillReturnRows(rows)
+				rows := sqlmock.NewRows([]string{"Id", "Title", "Body", "CreatedAt", "Version", "DeletedAt", "AuthorID", "TenantID"}).AddRow(1, "first title", "first body", created_at, 1, nil, nil, "").AddRow(2, "second title", "second body", created_at, 3, nil, nil, "")
+				mock.ExpectQuery("SELECT (.+) FROM messages").WillReturnRows(rows)
+				expectNoTags(mock)
 			},
 			want: []Message{
 				{
@@ -340,21 +409,32 @@ func TestMessageRepo_GetAll(t *testing.T) {
 					Title:     "first title",
 					Body:      "first body",
 					CreatedAt: created_at,
+					Version:   1,
 				},
 				{
 					ID:        2,
 					Title:     "second title",
 					Body:      "second body",
 					CreatedAt: created_at,
+					Version:   3,
 				},
 			},
 		},
+		{
+			name: "Invalid Row",
+			s:    s,
+			mock: func() {
+				rows := sqlmock.NewRows([]string{"Id", "Title", "Body", "CreatedAt", "Version", "DeletedAt", "AuthorID", "TenantID"}).AddRow("not a number", "first title", "first body", created_at, 1, nil, nil, "")
+				mock.ExpectQuery("SELECT (.+) FROM messages").WillReturnRows(rows)
+			},
+			wantErr: true,
+		},
 		{
 			name: "Invalid SQL Syntax",
 			s:    s,
 			mock: func() {
 				_ = sqlmock.NewRows([]string{"Id", "Title", "Body", "CreatedAt"}).AddRow(1, "first title", "first body", created_at).AddRow(2, "second title", "second body", created_at)
-				mock.ExpectPrepare("SELECTS (.+) FROM").ExpectQuery().WillReturnError(errors.New("Error when trying to prepare all messages"))
+				mock.ExpectQuery("SELECTS (.+) FROM").WillReturnError(errors.New("Error when trying to prepare all messages"))
 			},
 			wantErr: true,
 		},
@@ -374,12 +454,38 @@ func TestMessageRepo_GetAll(t *testing.T) {
 	}
 }
 
+func TestMessageRepo_GetAll_RowsError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+
+	// the connection broke off the rows, which must not pass for all of them
+	rows := sqlmock.NewRows([]string{"Id", "Title", "Body", "CreatedAt", "Version", "DeletedAt", "AuthorID", "TenantID"}).
+		AddRow(1, "first title", "first body", created_at, 1, nil, nil, "").
+		AddRow(2, "second title", "second body", created_at, 3, nil, nil, "").
+		RowError(1, driver.ErrBadConn)
+	mock.ExpectQuery("SELECT (.+) FROM messages").WillReturnRows(rows)
+
+	got, getErr := s.GetAll()
+	if getErr == nil || getErr.Status() != http.StatusServiceUnavailable {
+		t.Errorf("GetAll() = %v, %v, want the error of the broken connection", got, getErr)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestMessageRepo_Delete(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Errorf("an error %v was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
 	s := NewMessageRepository(db)
 
 	tests := []struct {
@@ -396,16 +502,34 @@ func TestMessageRepo_Delete(t *testing.T) {
 			s:     s,
 			msgId: 1,
 			mock: func() {
-				mock.ExpectPrepare("DELETE FROM messages").ExpectExec().WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				rows := sqlmock.NewRows([]string{"id", "title", "body", "created_at", "version", "deleted_at", "author_id", "tenant_id"}).
+					AddRow(1, "title", "body", time.Now(), 1, time.Now(), nil, "")
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE messages SET deleted_at").WithArgs(sqlmock.AnyArg(), 1, "").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT (.+) FROM messages WHERE id=").WithArgs(1, "").WillReturnRows(rows)
+				mock.ExpectExec("INSERT INTO message_revisions").WithArgs(1, 1, "title", "body", RevisionDelete, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 			},
 			wantErr: false,
 		},
+		{
+			// When the message doesn't exist or is already deleted
+			name:  "Nothing deleted",
+			s:     s,
+			msgId: 1,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE messages SET deleted_at").WithArgs(sqlmock.AnyArg(), 1, "").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
 		{
 			name:  "Invalid Id/Not found Id",
 			s:     s,
 			msgId: 1,
 			mock: func() {
-				mock.ExpectPrepare("DELETE FROM messages").ExpectExec().WithArgs(100).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("DELETE FROM messages").WithArgs(100).WillReturnResult(sqlmock.NewResult(0, 0))
 			},
 			wantErr: true,
 		},
@@ -413,7 +537,7 @@ func TestMessageRepo_Delete(t *testing.T) {
 			name: "Invalid SQL query",
 			s:    s,
 			mock: func() {
-				mock.ExpectPrepare("DELETE FROMSSS message").ExpectExec().WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("DELETE FROMSSS message").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
 			},
 			wantErr: true,
 		},
@@ -429,13 +553,252 @@ func TestMessageRepo_Delete(t *testing.T) {
 	}
 }
 
-func TestMessageRepo_Initialize(t *testing.T) {
-	dbdriver := "mysql"
-	username := "username"
-	password := "password"
-	host := "host"
-	database := "database"
-	port := "port"
-	dbConnect := MessageRepo.Initialize(dbdriver, username, password, port, host, database)
-	fmt.Println("this is the pull: ", dbConnect)
+func TestMessageRepo_GetContext_Canceled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %s was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+
+	rows := sqlmock.NewRows([]string{"Id", "Title", "Body", "CreatedAt"}).AddRow(1, "title", "body", created_at)
+	mock.ExpectQuery("SELECT (.+) FROM messages").WithArgs(1, "").WillDelayFor(time.Second).WillReturnRows(rows)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	got, getErr := s.GetContext(ctx, 1)
+	if getErr == nil {
+		t.Errorf("GetContext() = %v, want an error once the context is done", got)
+	}
+}
+
+func TestMessageRepo_List(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+
+	first := Message{ID: 1, Title: "first title", Body: "first body", CreatedAt: created_at, Version: 1}
+	second := Message{ID: 2, Title: "second title", Body: "second body", CreatedAt: created_at, Version: 1}
+
+	tests := []struct {
+		name    string
+		s       messageRepoInterface
+		opts    ListOptions
+		mock    func()
+		want    *MessagePage
+		wantErr bool
+	}{
+		{
+			// One more row than the page size means there is a next page
+			name: "OK with next page",
+			s:    s,
+			opts: ListOptions{PageSize: 1},
+			mock: func() {
+				rows := sqlmock.NewRows([]string{"Id", "Title", "Body", "CreatedAt", "Version", "DeletedAt", "AuthorID", "TenantID"}).AddRow(1, "first title", "first body", created_at, 1, nil, nil, "").AddRow(2, "second title", "second body", created_at, 1, nil, nil, "")
+				mock.ExpectQuery(`SELECT (.+) FROM messages WHERE deleted_at IS NULL AND tenant_id=\? ORDER BY created_at ASC, id ASC LIMIT \?`).WithArgs("", 2).WillReturnRows(rows)
+				expectNoTags(mock)
+			},
+			want: &MessagePage{
+				Items:      []Message{first},
+				NextCursor: encodeCursor(first, ListOptions{Sort: SortAsc}),
+			},
+		},
+		{
+			name: "OK with cursor and filters",
+			s:    s,
+			opts: ListOptions{PageSize: 1, Cursor: encodeCursor(first, ListOptions{Sort: SortDesc, TitleContains: "50%"}), Sort: SortDesc, TitleContains: "50%"},
+			mock: func() {
+				rows := sqlmock.NewRows([]string{"Id", "Title", "Body", "CreatedAt", "Version", "DeletedAt", "AuthorID", "TenantID"}).AddRow(2, "second title", "second body", created_at, 1, nil, nil, "")
+				mock.ExpectQuery(`SELECT (.+) FROM messages WHERE deleted_at IS NULL AND tenant_id=\? AND title LIKE \? ESCAPE '!' AND \(created_at < \? OR \(created_at = \? AND id < \?\)\) ORDER BY created_at DESC, id DESC LIMIT \?`).
+					WithArgs("", "%50!%%", sqlmock.AnyArg(), sqlmock.AnyArg(), 1, 2).WillReturnRows(rows)
+				expectNoTags(mock)
+			},
+			want: &MessagePage{
+				Items: []Message{second},
+			},
+		},
+		{
+			// An empty table is an empty page, not a "not found"
+			name: "Empty",
+			s:    s,
+			opts: ListOptions{},
+			mock: func() {
+				rows := sqlmock.NewRows([]string{"Id", "Title", "Body", "CreatedAt", "Version", "DeletedAt", "AuthorID", "TenantID"})
+				mock.ExpectQuery("SELECT (.+) FROM messages").WithArgs("", DefaultPageSize+1).WillReturnRows(rows)
+			},
+			want: &MessagePage{
+				Items: []Message{},
+			},
+		},
+		{
+			name:    "Invalid cursor",
+			s:       s,
+			opts:    ListOptions{Cursor: "%%%"},
+			mock:    func() {},
+			wantErr: true,
+		},
+		{
+			name: "Query error",
+			s:    s,
+			opts: ListOptions{},
+			mock: func() {
+				mock.ExpectQuery("SELECT (.+) FROM messages").WillReturnError(errors.New("query failed"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+			got, err := tt.s.List(context.Background(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("List() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageRepo_Restore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+
+	tests := []struct {
+		name    string
+		msgId   int64
+		mock    func()
+		wantErr bool
+	}{
+		{
+			name:  "OK",
+			msgId: 1,
+			mock: func() {
+				rows := sqlmock.NewRows([]string{"id", "title", "body", "created_at", "version", "deleted_at", "author_id", "tenant_id"}).
+					AddRow(1, "title", "body", time.Now(), 1, nil, nil, "")
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE messages SET deleted_at=NULL").WithArgs(1, "").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT (.+) FROM messages WHERE id=").WithArgs(1, "").WillReturnRows(rows)
+				mock.ExpectExec("INSERT INTO message_revisions").WithArgs(1, 1, "title", "body", RevisionRestore, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			// When the message doesn't exist or isn't deleted
+			name:  "Not found",
+			msgId: 2,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE messages SET deleted_at=NULL").WithArgs(2, "").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+			err := s.Restore(context.Background(), tt.msgId)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Restore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMessageRepo_Purge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+	before := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM message_revisions").WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec("DELETE FROM message_tags").WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec("DELETE FROM messages WHERE deleted_at IS NOT NULL").WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM tags WHERE NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	purged, purgeErr := s.Purge(context.Background(), before)
+	if purgeErr != nil {
+		t.Fatalf("Purge() error = %v", purgeErr)
+	}
+	if purged != 3 {
+		t.Errorf("Purge() = %d, want 3", purged)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM message_revisions").WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM message_tags").WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM messages WHERE deleted_at IS NOT NULL").WithArgs(before).WillReturnError(errors.New("purge failed"))
+	mock.ExpectRollback()
+	if _, purgeErr := s.Purge(context.Background(), before); purgeErr == nil {
+		t.Errorf("Purge() expected an error")
+	}
+}
+
+func TestMessageRepo_Revisions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+	columns := []string{"id", "message_id", "version", "title", "body", "action", "created_at"}
+
+	rows := sqlmock.NewRows(columns).
+		AddRow(1, 1, 1, "title", "body", "create", created_at).
+		AddRow(2, 1, 2, "title", "new body", "update", created_at)
+	mock.ExpectQuery("SELECT (.+) FROM message_revisions WHERE message_id IN").WithArgs(1, "").WillReturnRows(rows)
+	revisions, revErr := s.Revisions(context.Background(), 1)
+	if revErr != nil {
+		t.Fatalf("Revisions() error = %v", revErr)
+	}
+	want := []Revision{
+		{ID: 1, MessageID: 1, Version: 1, Title: "title", Body: "body", Action: RevisionCreate, CreatedAt: created_at},
+		{ID: 2, MessageID: 1, Version: 2, Title: "title", Body: "new body", Action: RevisionUpdate, CreatedAt: created_at},
+	}
+	if !reflect.DeepEqual(revisions, want) {
+		t.Errorf("Revisions() = %v, want %v", revisions, want)
+	}
+
+	mock.ExpectQuery("SELECT (.+) FROM message_revisions WHERE message_id IN").WithArgs(2, "").WillReturnRows(sqlmock.NewRows(columns))
+	if _, revErr := s.Revisions(context.Background(), 2); revErr == nil || revErr.Status() != http.StatusNotFound {
+		t.Errorf("Revisions() error = %v, want not found", revErr)
+	}
+
+	mock.ExpectQuery("SELECT (.+) FROM message_revisions WHERE id=").WithArgs(2, 1, "").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(2, 1, 2, "title", "new body", "update", created_at))
+	revision, revErr := s.GetRevision(context.Background(), 1, 2)
+	if revErr != nil {
+		t.Fatalf("GetRevision() error = %v", revErr)
+	}
+	if !reflect.DeepEqual(revision, &want[1]) {
+		t.Errorf("GetRevision() = %v, want %v", revision, want[1])
+	}
+
+	mock.ExpectQuery("SELECT (.+) FROM message_revisions WHERE id=").WithArgs(3, 1, "").WillReturnRows(sqlmock.NewRows(columns))
+	if _, revErr := s.GetRevision(context.Background(), 1, 3); revErr == nil || revErr.Status() != http.StatusNotFound {
+		t.Errorf("GetRevision() error = %v, want not found", revErr)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
 }
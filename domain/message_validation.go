@@ -0,0 +1,239 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+const (
+	// MaxTitleLength is the size of the title column, in characters.
+	MaxTitleLength = 255
+	// MaxBodyBytes is the size of the MySQL TEXT column holding the body.
+	MaxBodyBytes = 65535
+	// MaxTags is the most tags a message can have.
+	MaxTags = 20
+	// MaxTagLength is the size of the name column of the tags, in characters.
+	MaxTagLength = 64
+)
+
+// The codes of the FieldErrors of the built-in rules.
+const (
+	CodeRequired      = "required"
+	CodeTooLong       = "too_long"
+	CodeInvalidUTF8   = "invalid_utf8"
+	CodeForbiddenChar = "forbidden_character"
+	CodeTooMany       = "too_many"
+)
+
+// Rule checks the value of a field, returning the violation or nil.
+type Rule func(field, value string) *errorutils.FieldError
+
+// Required rejects empty values with message.
+func Required(message string) Rule {
+	return func(field, value string) *errorutils.FieldError {
+		if value == "" {
+			return &errorutils.FieldError{Field: field, Code: CodeRequired, Message: message}
+		}
+		return nil
+	}
+}
+
+// MaxLength rejects the values longer than max characters.
+func MaxLength(max int) Rule {
+	return func(field, value string) *errorutils.FieldError {
+		if utf8.RuneCountInString(value) > max {
+			return &errorutils.FieldError{Field: field, Code: CodeTooLong, Message: fmt.Sprintf("%s must be at most %d characters", field, max)}
+		}
+		return nil
+	}
+}
+
+// MaxBytes rejects the values taking more than max bytes once encoded.
+func MaxBytes(max int) Rule {
+	return func(field, value string) *errorutils.FieldError {
+		if len(value) > max {
+			return &errorutils.FieldError{Field: field, Code: CodeTooLong, Message: fmt.Sprintf("%s must be at most %d bytes", field, max)}
+		}
+		return nil
+	}
+}
+
+// ValidUTF8 rejects the values which aren't valid UTF-8.
+func ValidUTF8() Rule {
+	return func(field, value string) *errorutils.FieldError {
+		if !utf8.ValidString(value) {
+			return &errorutils.FieldError{Field: field, Code: CodeInvalidUTF8, Message: fmt.Sprintf("%s must be valid UTF-8", field)}
+		}
+		return nil
+	}
+}
+
+// NoControlChars rejects the values with control characters, but for the
+// ones listed in allowed.
+func NoControlChars(allowed string) Rule {
+	return func(field, value string) *errorutils.FieldError {
+		for _, r := range value {
+			if unicode.IsControl(r) && !strings.ContainsRune(allowed, r) {
+				return &errorutils.FieldError{Field: field, Code: CodeForbiddenChar, Message: fmt.Sprintf("%s must not contain the character %U", field, r)}
+			}
+		}
+		return nil
+	}
+}
+
+// Validator checks fields against the rules registered for them. A field
+// stops at its first violation, the rules after it assuming it passed, and
+// every field gets checked.
+type Validator struct {
+	mu     sync.RWMutex
+	fields []string
+	rules  map[string][]Rule
+}
+
+func NewValidator() *Validator {
+	return &Validator{rules: make(map[string][]Rule)}
+}
+
+// Register appends rules to the ones of field.
+func (v *Validator) Register(field string, rules ...Rule) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.rules[field]; !ok {
+		v.fields = append(v.fields, field)
+	}
+	v.rules[field] = append(v.rules[field], rules...)
+}
+
+// Check returns the violations of values, keyed by field, in the order the
+// fields were registered. Only the fields present in values are checked.
+func (v *Validator) Check(values map[string]string) []errorutils.FieldError {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	var violations []errorutils.FieldError
+	for _, field := range v.fields {
+		value, ok := values[field]
+		if !ok {
+			continue
+		}
+		for _, rule := range v.rules[field] {
+			if violation := rule(field, value); violation != nil {
+				violations = append(violations, *violation)
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// MessageValidator holds the rules of the fields of a Message, more can be
+// registered at startup.
+var MessageValidator = newMessageValidator()
+
+func newMessageValidator() *Validator {
+	v := NewValidator()
+	v.Register("title",
+		Required("Please enter a valid title"),
+		ValidUTF8(),
+		MaxLength(MaxTitleLength),
+		NoControlChars(""),
+	)
+	v.Register("body",
+		Required("Please enter a valid body"),
+		ValidUTF8(),
+		MaxBytes(MaxBodyBytes),
+		NoControlChars("\t\n\r"),
+	)
+	// checked once per tag
+	v.Register("tags",
+		Required("Tags can't be empty"),
+		ValidUTF8(),
+		MaxLength(MaxTagLength),
+		NoControlChars(""),
+	)
+	return v
+}
+
+// Validate trims the title and body of m, normalizes its tags and checks
+// them against MessageValidator, the error listing every invalid field.
+func (m *Message) Validate() errorutils.MessageErr {
+	return m.ValidateFields("title", "body", "tags")
+}
+
+// ValidateFields is Validate for the given fields only, for the partial
+// updates leaving the others as they are.
+func (m *Message) ValidateFields(fields ...string) errorutils.MessageErr {
+	var tagViolations []errorutils.FieldError
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "title":
+			m.Title = strings.TrimSpace(m.Title)
+			values[field] = m.Title
+		case "body":
+			m.Body = strings.TrimSpace(m.Body)
+			values[field] = m.Body
+		case "tags":
+			m.Tags = NormalizeTags(m.Tags)
+			tagViolations = checkTags(m.Tags)
+		}
+	}
+	return newValidationError(append(MessageValidator.Check(values), tagViolations...))
+}
+
+// NormalizeTags trims and lowercases tags, drops the duplicates and sorts
+// them. nil stays nil, for the updates leaving the tags as they are.
+func NormalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// checkTags returns the violations of the normalized tags, each of them
+// going through the rules of the "tags" field.
+func checkTags(tags []string) []errorutils.FieldError {
+	var violations []errorutils.FieldError
+	if len(tags) > MaxTags {
+		violations = append(violations, errorutils.FieldError{Field: "tags", Code: CodeTooMany, Message: fmt.Sprintf("tags must be at most %d", MaxTags)})
+	}
+	for _, tag := range tags {
+		violations = append(violations, MessageValidator.Check(map[string]string{"tags": tag})...)
+	}
+	return violations
+}
+
+// ValidateTag normalizes tag like NormalizeTags and checks it against the
+// rules of the "tags" field.
+func ValidateTag(tag string) (string, errorutils.MessageErr) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	return tag, newValidationError(checkTags([]string{tag}))
+}
+
+// newValidationError is the 422 listing violations, nil when there are none.
+// Its message joins theirs.
+func newValidationError(violations []errorutils.FieldError) errorutils.MessageErr {
+	if len(violations) == 0 {
+		return nil
+	}
+	messages := make([]string, len(violations))
+	for i, violation := range violations {
+		messages[i] = violation.Message
+	}
+	return errorutils.NewValidationError(strings.Join(messages, "; "), violations...)
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   Message
+		codes map[string]string
+	}{
+		{name: "valid", msg: Message{Title: " title ", Body: "line one\n\tline two"}},
+		{name: "title at the limit", msg: Message{Title: strings.Repeat("é", MaxTitleLength), Body: "body"}},
+		{name: "empty", msg: Message{Title: "  ", Body: ""}, codes: map[string]string{"title": CodeRequired, "body": CodeRequired}},
+		{name: "title too long", msg: Message{Title: strings.Repeat("a", MaxTitleLength+1), Body: "body"}, codes: map[string]string{"title": CodeTooLong}},
+		{name: "body too long", msg: Message{Title: "title", Body: strings.Repeat("é", MaxBodyBytes/2+1)}, codes: map[string]string{"body": CodeTooLong}},
+		{name: "invalid utf-8", msg: Message{Title: "title \xff", Body: "body \xc3"}, codes: map[string]string{"title": CodeInvalidUTF8, "body": CodeInvalidUTF8}},
+		{name: "control characters", msg: Message{Title: "two\nlines", Body: "nul\x00"}, codes: map[string]string{"title": CodeForbiddenChar, "body": CodeForbiddenChar}},
+		{name: "tags", msg: Message{Title: "title", Body: "body", Tags: []string{"work", strings.Repeat("é", MaxTagLength)}}},
+		{name: "empty tag", msg: Message{Title: "title", Body: "body", Tags: []string{" "}}, codes: map[string]string{"tags": CodeRequired}},
+		{name: "tag too long", msg: Message{Title: "title", Body: "body", Tags: []string{strings.Repeat("a", MaxTagLength+1)}}, codes: map[string]string{"tags": CodeTooLong}},
+		{name: "too many tags", msg: Message{Title: "title", Body: "body", Tags: strings.Split("abcdefghijklmnopqrstu", "")}, codes: map[string]string{"tags": CodeTooMany}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.msg.Validate()
+			if tt.codes == nil {
+				assert.Nil(t, err)
+				return
+			}
+			assert.NotNil(t, err)
+			assert.EqualValues(t, http.StatusUnprocessableEntity, err.Status())
+			codes := map[string]string{}
+			for _, detail := range err.Details() {
+				codes[detail.Field] = detail.Code
+			}
+			assert.EqualValues(t, tt.codes, codes)
+		})
+	}
+}
+
+func TestMessage_Validate_Aggregates(t *testing.T) {
+	msg := Message{Title: "", Body: " "}
+	err := msg.Validate()
+	assert.EqualValues(t, "Please enter a valid title; Please enter a valid body", err.Message())
+	assert.EqualValues(t, []errorutils.FieldError{
+		{Field: "title", Code: CodeRequired, Message: "Please enter a valid title"},
+		{Field: "body", Code: CodeRequired, Message: "Please enter a valid body"},
+	}, err.Details())
+}
+
+func TestMessage_ValidateFields(t *testing.T) {
+	// the body is left out, as in a partial update of the title
+	msg := Message{Title: " new title "}
+	assert.Nil(t, msg.ValidateFields("title"))
+	assert.EqualValues(t, "new title", msg.Title)
+
+	err := msg.ValidateFields("body")
+	assert.NotNil(t, err)
+	assert.Len(t, err.Details(), 1)
+}
+
+func TestNormalizeTags(t *testing.T) {
+	assert.Nil(t, NormalizeTags(nil))
+	assert.EqualValues(t, []string{}, NormalizeTags([]string{}))
+	assert.EqualValues(t, []string{"go", "work"}, NormalizeTags([]string{" Work", "go", "work ", "GO"}))
+
+	tag, err := ValidateTag(" Urgent ")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "urgent", tag)
+	_, err = ValidateTag("two\nlines")
+	assert.NotNil(t, err)
+	assert.EqualValues(t, CodeForbiddenChar, err.Details()[0].Code)
+}
+
+func TestValidator_Register(t *testing.T) {
+	v := newMessageValidator()
+	v.Register("title", func(field, value string) *errorutils.FieldError {
+		if strings.HasPrefix(value, "re:") {
+			return &errorutils.FieldError{Field: field, Code: "reply", Message: "replies are not messages"}
+		}
+		return nil
+	})
+	MessageValidator, v = v, MessageValidator
+	defer func() { MessageValidator = v }()
+
+	msg := Message{Title: "re: hello", Body: "body"}
+	err := msg.Validate()
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "reply", err.Details()[0].Code)
+
+	// the built-in rules run first
+	msg = Message{Title: "", Body: "body"}
+	assert.EqualValues(t, CodeRequired, msg.Validate().Details()[0].Code)
+}
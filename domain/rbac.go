@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	queryRolePermissions = "SELECT role, permission FROM rbac_role_permissions ORDER BY role, permission;"
+	queryRoleBindings    = "SELECT subject, role FROM rbac_role_bindings ORDER BY subject, role;"
+)
+
+// LoadRBACTables reads the permissions of the roles and the roles bound to
+// each subject from the rbac tables, for auth.NewPolicy.
+func LoadRBACTables(ctx context.Context, db *sql.DB) (roles map[string][]string, bindings map[string][]string, err error) {
+	if roles, err = loadPairs(ctx, db, queryRolePermissions); err != nil {
+		return nil, nil, err
+	}
+	if bindings, err = loadPairs(ctx, db, queryRoleBindings); err != nil {
+		return nil, nil, err
+	}
+	return roles, bindings, nil
+}
+
+// loadPairs groups the second column of the rows of query by the first.
+func loadPairs(ctx context.Context, db *sql.DB, query string) (map[string][]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pairs := make(map[string][]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		pairs[key] = append(pairs[key], value)
+	}
+	return pairs, rows.Err()
+}
@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/silvergama/efficientAPI/utils/error_formats"
+)
+
+// preparedQueries are the statements messageRepo prepares once and reuses,
+// in the order they are prepared. The other queries change with their arguments.
+func (d dialect) preparedQueries() []string {
+	return []string{
+		d.rebind(queryGetMessage),
+		d.rebind(queryGetAllMessage),
+		d.rebind(querySnapshotMessage),
+		d.insert(queryInsertMessage),
+		d.rebind(queryUpdateMessge),
+		d.rebind(queryUpdateAnyVersion),
+		d.rebind(queryDeleteMessage),
+		d.rebind(queryRestoreMessage),
+		d.rebind(queryPurgeRevisions),
+		d.rebind(queryPurgeMessageTags),
+		d.rebind(queryPurgeMessages),
+		d.rebind(queryPurgeUnusedTags),
+		d.rebind(queryInsertRevision),
+		d.rebind(queryListRevisions),
+		d.rebind(queryGetRevision),
+	}
+}
+
+// statements keeps the queries of a messageRepo prepared on its database,
+// for every goroutine to share. A *sql.Stmt prepares itself again on the
+// connections it wasn't prepared on, those replacing lost ones included,
+// and the ones the server forgot are dropped to be prepared on next use.
+type statements struct {
+	db      *sql.DB
+	queries []string
+	mu      sync.RWMutex
+	stmts   map[string]*sql.Stmt
+}
+
+func newStatements(db *sql.DB, queries []string) *statements {
+	return &statements{db: db, queries: queries, stmts: make(map[string]*sql.Stmt)}
+}
+
+// prepare prepares every query not prepared yet. They all get a try, the
+// error being the one of the first that failed.
+func (s *statements) prepare(ctx context.Context) error {
+	s.mu.RLock()
+	complete := len(s.stmts) == len(s.queries)
+	s.mu.RUnlock()
+	if complete {
+		return nil
+	}
+
+	var first error
+	for _, query := range s.queries {
+		if _, err := s.get(ctx, query); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// lookup returns the statement of query if it is prepared already.
+func (s *statements) lookup(query string) (*sql.Stmt, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stmt, ok := s.stmts[query]
+	return stmt, ok
+}
+
+// get returns the statement of query, preparing it on first use.
+func (s *statements) get(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt, ok := s.lookup(query); ok {
+		return stmt, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stmt, ok := s.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	s.stmts[query] = stmt
+	return stmt, nil
+}
+
+// forget closes the statement of query, the next get preparing it again.
+func (s *statements) forget(query string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stmt, ok := s.stmts[query]; ok {
+		delete(s.stmts, query)
+		stmt.Close()
+	}
+}
+
+// prepareStatements prepares the statements of mr on its database. The
+// ones failing, like those of tables not migrated yet, are prepared on
+// their first use instead.
+func (mr *messageRepo) prepareStatements() {
+	if mr.db == nil {
+		return
+	}
+	mr.stmts = newStatements(mr.db, mr.dialect.preparedQueries())
+	if err := mr.stmts.prepare(context.Background()); err != nil {
+		log.Printf("some message statements will be prepared on first use: %v", err)
+	}
+}
+
+// prepared returns the statement of query prepared for the repository,
+// bound to tx, or else to the transaction of the repository, if any.
+func (mr *messageRepo) prepared(ctx context.Context, tx *sql.Tx, query string) (*sql.Stmt, error) {
+	if mr.stmts == nil {
+		return nil, errors.New("the message repository is not initialized")
+	}
+	if tx == nil {
+		tx = mr.tx
+	}
+	if tx == nil {
+		return mr.stmts.get(ctx, query)
+	}
+	if stmt, ok := mr.stmts.lookup(query); ok {
+		return tx.StmtContext(ctx, stmt), nil
+	}
+	// preparing on the database could wait for a connection forever, when
+	// tx holds the last one, so this one only lives as long as tx
+	return tx.PrepareContext(ctx, query)
+}
+
+// prepareMissing retries the statements which couldn't be prepared yet,
+// before a transaction takes a connection for itself.
+func (mr *messageRepo) prepareMissing(ctx context.Context) {
+	if mr.stmts != nil {
+		mr.stmts.prepare(ctx)
+	}
+}
+
+// staleStatement drops the statement of query when err tells the server no
+// longer knows it, and reports whether the call can be tried again right
+// away with a new one. A transaction is lost by then, so not in one.
+func (mr *messageRepo) staleStatement(query string, err error) bool {
+	if err == nil || error_formats.Classify(err) != error_formats.KindStaleStatement {
+		return false
+	}
+	mr.stmts.forget(query)
+	return mr.tx == nil
+}
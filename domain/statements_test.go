@@ -0,0 +1,253 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var messageRow = []string{"id", "title", "body", "created_at", "version", "deleted_at", "author_id", "tenant_id"}
+
+func TestMessageRepo_ReusesStatements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+
+	// no Prepare in between
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta(queryGetMessage)).WithArgs(1, "").
+			WillReturnRows(sqlmock.NewRows(messageRow).AddRow(1, "title", "body", created_at, 1, nil, nil, ""))
+		expectNoTags(mock)
+		msg, err := s.Get(1)
+		assert.Nil(t, err)
+		assert.EqualValues(t, "title", msg.Title)
+	}
+
+	// transactions run the statements of the repository too
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(queryRestoreMessage)).WithArgs(1, "").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(querySnapshotMessage)).WithArgs(1, "").
+		WillReturnRows(sqlmock.NewRows(messageRow).AddRow(1, "title", "body", created_at, 1, nil, nil, ""))
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertRevision)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	assert.Nil(t, s.Restore(context.Background(), 1))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepo_PreparesOnFirstUse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	// every statement fails to prepare on construction
+	s := NewMessageRepository(db)
+
+	mock.ExpectPrepare(regexp.QuoteMeta(queryGetMessage)).ExpectQuery().WithArgs(1, "").
+		WillReturnRows(sqlmock.NewRows(messageRow).AddRow(1, "title", "body", created_at, 1, nil, nil, ""))
+	expectNoTags(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(queryGetMessage)).WithArgs(2, "").
+		WillReturnRows(sqlmock.NewRows(messageRow).AddRow(2, "title", "body", created_at, 1, nil, nil, ""))
+	expectNoTags(mock)
+	_, err = s.Get(1)
+	assert.Nil(t, err)
+	_, err = s.Get(2)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepo_StaleStatement(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	s := NewMessageRepository(db)
+
+	// the server forgot the statement, it is prepared again and the query retried
+	mock.ExpectQuery(regexp.QuoteMeta(queryGetMessage)).WithArgs(1, "").WillReturnError(&mysql.MySQLError{Number: 1243})
+	mock.ExpectPrepare(regexp.QuoteMeta(queryGetMessage)).ExpectQuery().WithArgs(1, "").
+		WillReturnRows(sqlmock.NewRows(messageRow).AddRow(1, "title", "body", created_at, 1, nil, nil, ""))
+	expectNoTags(mock)
+	msg, err := s.Get(1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, msg.ID)
+
+	// within a transaction the error stands, the next one prepares it again
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteMessage)).WillReturnError(&mysql.MySQLError{Number: 1243})
+	mock.ExpectRollback()
+	assert.NotNil(t, s.Delete(1))
+	mock.ExpectPrepare(regexp.QuoteMeta(queryDeleteMessage))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteMessage)).WithArgs(sqlmock.AnyArg(), 1, "").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(querySnapshotMessage)).WithArgs(1, "").
+		WillReturnRows(sqlmock.NewRows(messageRow).AddRow(1, "title", "body", created_at, 1, created_at, nil, ""))
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertRevision)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	assert.Nil(t, s.Delete(1))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+// roundTrip is the network latency the sqlmock benchmarks give every call
+// reaching the database.
+const roundTrip = 100 * time.Microsecond
+
+// getPreparedPerCall is how GetContext ran before the statements were kept,
+// the baseline of the benchmarks.
+func getPreparedPerCall(ctx context.Context, db *sql.DB, query string, msgId int64) (*Message, error) {
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	var msg Message
+	if err := scanMessage(stmt.QueryRowContext(ctx, msgId), &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// BenchmarkMessageRepo_Get_Sqlmock compares the lookups with a statement
+// prepared once to the ones preparing it every time, with a delay standing
+// for the round trips to the server. sqlmock looks its expectations up
+// linearly, so a new mock is set up every few iterations.
+func BenchmarkMessageRepo_Get_Sqlmock(b *testing.B) {
+	const perMock = 500
+	query := regexp.QuoteMeta(queryGetMessage)
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(messageRow).AddRow(1, "title", "body", created_at, 1, nil, nil, "")
+	}
+
+	setUp := func(b *testing.B, perCall bool) (*sql.DB, messageRepoInterface) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			b.Fatalf("an error %v was not expected when opening a stub database connection", err)
+		}
+		expectPrepared(mock, mysqlDialect)
+		repo := NewMessageRepository(db)
+		for i := 0; i < perMock; i++ {
+			if perCall {
+				mock.ExpectPrepare(query).WillDelayFor(roundTrip)
+			}
+			mock.ExpectQuery(query).WithArgs(1, "").WillDelayFor(roundTrip).WillReturnRows(rows())
+			if !perCall {
+				// the tags loaded by GetContext are left out of the comparison
+				expectNoTags(mock)
+			}
+		}
+		return db, repo
+	}
+
+	for _, perCall := range []bool{false, true} {
+		name := "prepared once"
+		if perCall {
+			name = "prepared per call"
+		}
+		b.Run(name, func(b *testing.B) {
+			ctx := context.Background()
+			var (
+				db   *sql.DB
+				repo messageRepoInterface
+			)
+			for i := 0; i < b.N; i++ {
+				if i%perMock == 0 {
+					b.StopTimer()
+					if db != nil {
+						db.Close()
+					}
+					db, repo = setUp(b, perCall)
+					b.StartTimer()
+				}
+				var err error
+				if perCall {
+					_, err = getPreparedPerCall(ctx, db, queryGetMessage, 1)
+				} else {
+					_, err = repo.GetContext(ctx, 1)
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			db.Close()
+		})
+	}
+}
+
+// BenchmarkMessageRepo_Get_MySQL runs the same comparison on the MySQL
+// server described by the *_TEST variables of the .env file, when reachable.
+func BenchmarkMessageRepo_Get_MySQL(b *testing.B) {
+	if os.Getenv("DATABASE_TEST") == "" {
+		b.Skip("set USERNAME_TEST, PASSWORD_TEST, HOST_TEST, PORT_TEST and DATABASE_TEST to run against MySQL")
+	}
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		os.Getenv("USERNAME_TEST"), os.Getenv("PASSWORD_TEST"), os.Getenv("HOST_TEST"), os.Getenv("PORT_TEST"), os.Getenv("DATABASE_TEST"))
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		b.Skipf("MySQL is not reachable: %v", err)
+	}
+	benchmarkGet(b, db, NewMessageRepository(db), mysqlDialect)
+}
+
+// benchmarkGet times the lookups of a message created in repo, both ways.
+func benchmarkGet(b *testing.B, db *sql.DB, repo messageRepoInterface, d dialect) {
+	ctx := context.Background()
+	msg, createErr := repo.Create(&Message{Title: fmt.Sprintf("benchmark %d", time.Now().UnixNano()), Body: "body", CreatedAt: time.Now()})
+	if createErr != nil {
+		b.Fatal(createErr.Message())
+	}
+	defer repo.Purge(ctx, time.Now().Add(time.Hour))
+	defer repo.Delete(msg.ID)
+	query := d.rebind(queryGetMessage)
+
+	b.Run("prepared once", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.GetContext(ctx, msg.ID); err != nil {
+				b.Fatal(err.Message())
+			}
+		}
+	})
+	b.Run("prepared per call", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := getPreparedPerCall(ctx, db, query, msg.ID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("prepared once parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := repo.GetContext(ctx, msg.ID); err != nil {
+					b.Fatal(err.Message())
+				}
+			}
+		})
+	})
+	b.Run("prepared per call parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := getPreparedPerCall(ctx, db, query, msg.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
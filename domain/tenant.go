@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"context"
+	"regexp"
+)
+
+// DefaultTenant owns the messages of the callers bound to no tenant, and the
+// messages stored before tenants were introduced.
+const DefaultTenant = ""
+
+// tenantPattern is what tenant identifiers look like, keeping them safe to
+// log and to put in headers.
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx scoping the repositories to tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant of ctx, DefaultTenant when none was set.
+func TenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// ValidTenant tells whether tenant is a well-formed identifier. DefaultTenant
+// can't be asked for explicitly.
+func ValidTenant(tenant string) bool {
+	return tenantPattern.MatchString(tenant)
+}
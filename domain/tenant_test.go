@@ -0,0 +1,124 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/silvergama/efficientAPI/utils/error_formats"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidTenant(t *testing.T) {
+	assert.True(t, ValidTenant("acme"))
+	assert.True(t, ValidTenant("Acme_Corp-2"))
+	assert.False(t, ValidTenant(""))
+	assert.False(t, ValidTenant("acme corp"))
+	assert.False(t, ValidTenant("acme/../other"))
+	assert.False(t, ValidTenant(string(make([]byte, 65))))
+
+	assert.EqualValues(t, DefaultTenant, TenantFrom(context.Background()))
+	assert.EqualValues(t, "acme", TenantFrom(WithTenant(context.Background(), "acme")))
+}
+
+func assertNotFound(t *testing.T, err errorutils.MessageErr) {
+	t.Helper()
+	if assert.NotNil(t, err) {
+		assert.EqualValues(t, http.StatusNotFound, err.Status())
+	}
+}
+
+// testTenantIsolation checks that a tenant neither sees nor changes the
+// messages of another, whatever the repository.
+func testTenantIsolation(t *testing.T, repo messageRepoInterface) {
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+	tm := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	msg, err := repo.CreateContext(acme, &Message{Title: "roadmap", Body: "acme secrets", CreatedAt: tm})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "acme", msg.TenantID)
+	id := msg.ID
+
+	// titles are only unique within a tenant
+	other, err := repo.CreateContext(globex, &Message{Title: "roadmap", Body: "globex plans", CreatedAt: tm})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "globex", other.TenantID)
+	_, err = repo.CreateContext(acme, &Message{Title: "roadmap", Body: "again", CreatedAt: tm})
+	if assert.NotNil(t, err) {
+		assert.EqualValues(t, error_formats.CodeDuplicateTitle, err.Code())
+	}
+
+	got, err := repo.GetContext(acme, id)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "acme secrets", got.Body)
+	_, err = repo.GetContext(globex, id)
+	assertNotFound(t, err)
+	// the callers without a tenant are a tenant of their own
+	_, err = repo.GetContext(context.Background(), id)
+	assertNotFound(t, err)
+
+	all, err := repo.GetAllContext(globex)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{other.ID}, ids(all))
+	page, err := repo.List(globex, ListOptions{})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []int64{other.ID}, ids(page.Items))
+	hits, err := repo.Search(globex, SearchOptions{Query: "roadmap"})
+	assert.Nil(t, err)
+	if assert.Len(t, hits.Items, 1) {
+		assert.EqualValues(t, other.ID, hits.Items[0].Message.ID)
+	}
+
+	_, err = repo.UpdateContext(globex, &Message{ID: id, Title: "hijacked", Body: "body", Version: 1})
+	assert.NotNil(t, err)
+	errs, err := repo.UpdateMessages(globex, []*Message{{ID: id, Title: "hijacked", Body: "body"}})
+	assert.Nil(t, err)
+	assertNotFound(t, errs[0])
+	_, err = repo.Revisions(globex, id)
+	assertNotFound(t, err)
+	_, err = repo.GetRevision(globex, id, 1)
+	assertNotFound(t, err)
+
+	assertNotFound(t, repo.DeleteContext(globex, id))
+	errs, err = repo.DeleteMessages(globex, []int64{id})
+	assert.Nil(t, err)
+	assertNotFound(t, errs[0])
+
+	// nothing changed for acme
+	got, err = repo.GetContext(acme, id)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "roadmap", got.Title)
+	assert.EqualValues(t, 1, got.Version)
+	revisions, err := repo.Revisions(acme, id)
+	assert.Nil(t, err)
+	assert.Len(t, revisions, 1)
+
+	assert.Nil(t, repo.DeleteContext(acme, id))
+	assertNotFound(t, repo.Restore(globex, id))
+	deleted, err := repo.List(globex, ListOptions{Deleted: true})
+	assert.Nil(t, err)
+	assert.Empty(t, deleted.Items)
+	assert.Nil(t, repo.Restore(acme, id))
+}
+
+func TestMemoryMessageRepo_TenantIsolation(t *testing.T) {
+	testTenantIsolation(t, NewMemoryMessageRepository())
+}
+
+func TestCachedMessageRepo_TenantIsolation(t *testing.T) {
+	repo := NewMemoryMessageRepository()
+	cache := NewCachedMessageRepository(repo, NewLRUCacheStore(10), time.Minute)
+	acme := WithTenant(context.Background(), "acme")
+	msg, err := repo.CreateContext(acme, &Message{Title: "title", Body: "body", CreatedAt: created_at})
+	assert.Nil(t, err)
+
+	// cached for acme, still missing for globex
+	_, err = cache.GetContext(acme, msg.ID)
+	assert.Nil(t, err)
+	_, err = cache.GetContext(WithTenant(context.Background(), "globex"), msg.ID)
+	assertNotFound(t, err)
+	assert.EqualValues(t, 1, cache.Stats().Hits)
+}
@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/silvergama/efficientAPI/utils/error_formats"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+const maxTransactionAttempts = 3
+
+// MessageRepository names the interface of MessageRepo for the callers of
+// WithTransaction outside this package.
+type MessageRepository = messageRepoInterface
+
+// transactionRetryDelay is how long to wait before the first retry of a
+// deadlocked transaction, every other retry waits a bit longer.
+var transactionRetryDelay = 20 * time.Millisecond
+
+// UnitOfWork is a transaction on the message repository. Nothing done
+// through Repo is seen by anyone else until Commit, and all of it is
+// dropped by Rollback, which is harmless once committed.
+type UnitOfWork interface {
+	Repo() messageRepoInterface
+	Commit() errorutils.MessageErr
+	Rollback() errorutils.MessageErr
+}
+
+// transactional is implemented by the repositories able to start a UnitOfWork.
+type transactional interface {
+	Begin(context.Context) (UnitOfWork, errorutils.MessageErr)
+}
+
+// Begin starts a unit of work on MessageRepo. Repositories without
+// transactions, like test doubles, get one running straight on them.
+func Begin(ctx context.Context) (UnitOfWork, errorutils.MessageErr) {
+	if repo, ok := MessageRepo.(transactional); ok {
+		return repo.Begin(ctx)
+	}
+	return directUnitOfWork{MessageRepo}, nil
+}
+
+// WithTransaction runs fn in a unit of work, committed when fn succeeds and
+// rolled back otherwise. The whole of it is run again when the database
+// aborts it to break a deadlock, so fn must not keep state between calls.
+func WithTransaction(ctx context.Context, fn func(repo MessageRepository) errorutils.MessageErr) errorutils.MessageErr {
+	for attempt := 1; ; attempt++ {
+		err := runTransaction(ctx, fn)
+		if err == nil || !error_formats.IsDeadlock(err) || attempt == maxTransactionAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * transactionRetryDelay):
+		}
+	}
+}
+
+func runTransaction(ctx context.Context, fn func(repo MessageRepository) errorutils.MessageErr) errorutils.MessageErr {
+	uow, err := Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(uow.Repo()); err != nil {
+		uow.Rollback()
+		return err
+	}
+	return uow.Commit()
+}
+
+type sqlUnitOfWork struct {
+	tx   *sql.Tx
+	repo *messageRepo
+}
+
+// Begin starts a transaction, the repository of the UnitOfWork runs every
+// statement in it.
+func (mr *messageRepo) Begin(ctx context.Context) (UnitOfWork, errorutils.MessageErr) {
+	if mr.tx != nil {
+		return nil, errorutils.NewInternalServerError("nested transactions are not supported")
+	}
+	mr.prepareMissing(ctx)
+	tx, err := mr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, error_formats.ParseError(err)
+	}
+	return &sqlUnitOfWork{
+		tx:   tx,
+		repo: &messageRepo{db: mr.db, tx: tx, dialect: mr.dialect, stmts: mr.stmts},
+	}, nil
+}
+
+func (u *sqlUnitOfWork) Repo() messageRepoInterface {
+	return u.repo
+}
+
+func (u *sqlUnitOfWork) Commit() errorutils.MessageErr {
+	if err := u.tx.Commit(); err != nil {
+		return error_formats.ParseError(err)
+	}
+	return nil
+}
+
+func (u *sqlUnitOfWork) Rollback() errorutils.MessageErr {
+	if err := u.tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		return error_formats.ParseError(err)
+	}
+	return nil
+}
+
+type directUnitOfWork struct {
+	repo messageRepoInterface
+}
+
+func (u directUnitOfWork) Repo() messageRepoInterface {
+	return u.repo
+}
+
+func (u directUnitOfWork) Commit() errorutils.MessageErr {
+	return nil
+}
+
+func (u directUnitOfWork) Rollback() errorutils.MessageErr {
+	return nil
+}
@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTransaction_SQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expectPrepared(mock, mysqlDialect)
+	MessageRepo = NewMessageRepository(db)
+	defer func() { MessageRepo = &messageRepo{} }()
+	transactionRetryDelay = time.Millisecond
+	columns := []string{"id", "title", "body", "created_at", "version", "deleted_at", "author_id", "tenant_id"}
+
+	tests := []struct {
+		name       string
+		mock       func()
+		wantStatus int
+	}{
+		{
+			name: "Committed",
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT (.+) FROM messages").WithArgs(1, "").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "title", "body", created_at, 1, nil, nil, ""))
+				expectNoTags(mock)
+				mock.ExpectExec("UPDATE messages").WithArgs("title", "new body", 1, "", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO message_revisions").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "Rolled back",
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT (.+) FROM messages").WithArgs(1, "").WillReturnRows(sqlmock.NewRows(columns))
+				mock.ExpectRollback()
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "Retried after a deadlock",
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT (.+) FROM messages").WithArgs(1, "").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "title", "body", created_at, 1, nil, nil, ""))
+				expectNoTags(mock)
+				mock.ExpectExec("UPDATE messages").WithArgs("title", "new body", 1, "", 1).WillReturnError(&mysql.MySQLError{Number: 1213})
+				mock.ExpectRollback()
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT (.+) FROM messages").WithArgs(1, "").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "title", "body", created_at, 1, nil, nil, ""))
+				expectNoTags(mock)
+				mock.ExpectExec("UPDATE messages").WithArgs("title", "new body", 1, "", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO message_revisions").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "Deadlocked every time",
+			mock: func() {
+				for i := 0; i < maxTransactionAttempts; i++ {
+					mock.ExpectBegin()
+					mock.ExpectQuery("SELECT (.+) FROM messages").WithArgs(1, "").WillReturnError(&mysql.MySQLError{Number: 1213})
+					mock.ExpectRollback()
+				}
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock()
+			err := WithTransaction(context.Background(), func(repo MessageRepository) errorutils.MessageErr {
+				msg, err := repo.GetContext(context.Background(), 1)
+				if err != nil {
+					return err
+				}
+				msg.Body = "new body"
+				_, err = repo.UpdateContext(context.Background(), msg)
+				return err
+			})
+			if tt.wantStatus == 0 {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.EqualValues(t, tt.wantStatus, err.Status())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestWithTransaction_Memory(t *testing.T) {
+	MessageRepo = NewMemoryMessageRepository()
+	defer func() { MessageRepo = &messageRepo{} }()
+	ctx := context.Background()
+
+	err := WithTransaction(ctx, func(repo MessageRepository) errorutils.MessageErr {
+		if _, err := repo.CreateContext(ctx, &Message{Title: "dropped", Body: "body", CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+		return errorutils.NewBadRequestError("changed my mind")
+	})
+	assert.NotNil(t, err)
+	_, err = MessageRepo.Get(1)
+	assert.NotNil(t, err)
+
+	counter, err := MessageRepo.Create(&Message{Title: "counter", Body: "0", CreatedAt: time.Now()})
+	assert.Nil(t, err)
+
+	// read-modify-write cycles don't step on each other
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := WithTransaction(ctx, func(repo MessageRepository) errorutils.MessageErr {
+				msg, err := repo.GetContext(ctx, counter.ID)
+				if err != nil {
+					return err
+				}
+				msg.Body += "+"
+				_, err = repo.UpdateContext(ctx, msg)
+				return err
+			})
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	msg, err := MessageRepo.Get(counter.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 21, msg.Version)
+	assert.Len(t, msg.Body, 21)
+}
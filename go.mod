@@ -1,13 +1,16 @@
 module github.com/silvergama/efficientAPI
 
-go 1.13
+go 1.16
 
 require (
 	github.com/DATA-DOG/go-sqlmock v1.4.1
 	github.com/aws/aws-sdk-go v1.31.2 // indirect
-	github.com/gin-gonic/gin v1.6.3 // indirect
+	github.com/gin-gonic/gin v1.6.3
 	github.com/go-sql-driver/mysql v1.5.0
-	github.com/joho/godotenv v1.3.0 // indirect
+	github.com/golang-jwt/jwt/v4 v4.5.0
+	github.com/joho/godotenv v1.3.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/silvergama/efficient-api v0.0.0-20200823020333-dc54c2cee44e // indirect
 	github.com/stretchr/testify v1.5.1
 )
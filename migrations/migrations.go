@@ -0,0 +1,259 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql
+var files embed.FS
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+const (
+	queryCreateVersionTable = "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, applied_at TIMESTAMP NOT NULL);"
+	queryGetVersions        = "SELECT version, applied_at FROM schema_migrations ORDER BY version;"
+	queryInsertVersion      = "INSERT INTO schema_migrations (version, applied_at) VALUES (%d, CURRENT_TIMESTAMP);"
+	queryDeleteVersion      = "DELETE FROM schema_migrations WHERE version = %d;"
+)
+
+// Migration is one versioned schema change, shipped inside the binary as
+// sql/<driver>/<version>_<name>.up.sql and its .down.sql counterpart.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status tells whether a migration has been applied, and when.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load returns the migrations of driver sorted by version.
+func Load(driver string) ([]Migration, error) {
+	dir := path.Join("sql", driver)
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		parts := fileName.FindStringSubmatch(entry.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		version, _ := strconv.ParseInt(parts[1], 10, 64)
+		content, err := fs.ReadFile(files, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// Migrator applies the migrations of one driver to a database, keeping
+// track of the applied versions in the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+
+	// DryRun prints the statements to Out instead of running them.
+	DryRun bool
+	Out    io.Writer
+}
+
+func New(db *sql.DB, driver string) (*Migrator, error) {
+	migrations, err := Load(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		Out:        io.Discard,
+	}, nil
+}
+
+// Status lists every known migration, applied or not.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		result = append(result, Status{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+	}
+	return result, nil
+}
+
+// Up applies every pending migration in version order and returns how many ran.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := m.run(ctx, migration, migration.Up, fmt.Sprintf(queryInsertVersion, migration.Version)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns how many ran.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := m.run(ctx, migration, migration.Down, fmt.Sprintf(queryDeleteVersion, migration.Version)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (m *Migrator) ensureVersionTable(ctx context.Context) error {
+	if m.DryRun {
+		return nil
+	}
+	if _, err := m.db.ExecContext(ctx, queryCreateVersionTable); err != nil {
+		return fmt.Errorf("error creating the schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+// applied returns the applied versions. A dry run doesn't create the
+// schema_migrations table, so there an unreadable table means nothing was applied.
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	if err := m.ensureVersionTable(ctx); err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64]time.Time)
+	rows, err := m.db.QueryContext(ctx, queryGetVersions)
+	if err != nil {
+		if m.DryRun {
+			return result, nil
+		}
+		return nil, fmt.Errorf("error reading the schema_migrations table: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error reading the schema_migrations table: %v", err)
+		}
+		result[version] = appliedAt
+	}
+	return result, rows.Err()
+}
+
+// run executes the statements of one migration direction together with the
+// schema_migrations bookkeeping in a single transaction. MySQL commits DDL
+// implicitly, so there a failing migration may be left half applied.
+func (m *Migrator) run(ctx context.Context, migration Migration, script, bookkeeping string) error {
+	statements := append(splitStatements(script), bookkeeping)
+	if m.DryRun {
+		fmt.Fprintf(m.Out, "-- %d_%s\n", migration.Version, migration.Name)
+		for _, stmt := range statements {
+			fmt.Fprintln(m.Out, stmt)
+		}
+		return nil
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting migration %d_%s: %v", migration.Version, migration.Name, err)
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error running migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing migration %d_%s: %v", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+// splitStatements cuts a script on the semicolons ending a line, since not
+// every driver runs several statements in one Exec.
+func splitStatements(script string) []string {
+	var (
+		result  []string
+		current strings.Builder
+	)
+	for _, line := range strings.Split(script, "\n") {
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if stmt := strings.TrimSpace(current.String()); stmt != "" {
+				result = append(result, stmt)
+			}
+			current.Reset()
+		}
+	}
+	if stmt := strings.TrimSpace(current.String()); stmt != "" {
+		result = append(result, stmt)
+	}
+	return result
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	for _, driver := range []string{"mysql", "postgres", "sqlite3"} {
+		t.Run(driver, func(t *testing.T) {
+			migrations, err := Load(driver)
+			assert.Nil(t, err)
+			assert.NotEmpty(t, migrations)
+			for i, m := range migrations {
+				assert.NotEmpty(t, m.Up)
+				assert.NotEmpty(t, m.Down)
+				if i > 0 {
+					assert.True(t, migrations[i-1].Version < m.Version)
+				}
+			}
+		})
+	}
+
+	// every driver must know the same versions
+	mysql, _ := Load("mysql")
+	postgres, _ := Load("postgres")
+	sqlite, _ := Load("sqlite3")
+	assert.EqualValues(t, len(mysql), len(postgres))
+	assert.EqualValues(t, len(mysql), len(sqlite))
+
+	_, err := Load("oracle")
+	assert.NotNil(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := "CREATE TABLE a (\n\tid INT\n);\nCREATE INDEX i ON a (id);\n\n"
+	assert.EqualValues(t, []string{
+		"CREATE TABLE a (\n\tid INT\n);",
+		"CREATE INDEX i ON a (id);",
+	}, splitStatements(script))
+}
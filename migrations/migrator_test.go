@@ -0,0 +1,84 @@
+//go:build cgo
+// +build cgo
+
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMigrator(t *testing.T) (*Migrator, *sql.DB) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("an error %v was not expected when opening a sqlite database", err)
+	}
+	db.SetMaxOpenConns(1)
+	migrator, err := New(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("an error %v was not expected when loading the migrations", err)
+	}
+	return migrator, db
+}
+
+func tableExists(db *sql.DB, name string) bool {
+	var found string
+	err := db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name=?", name).Scan(&found)
+	return err == nil
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	migrator, db := newTestMigrator(t)
+	defer db.Close()
+	ctx := context.Background()
+	total := len(migrator.migrations)
+
+	applied, err := migrator.Up(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, total, applied)
+	assert.True(t, tableExists(db, "messages"))
+
+	// nothing left to apply the second time
+	applied, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, applied)
+
+	status, err := migrator.Status(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, total, len(status))
+	for _, s := range status {
+		assert.True(t, s.Applied)
+	}
+
+	reverted, err := migrator.Down(ctx, total)
+	assert.Nil(t, err)
+	assert.EqualValues(t, total, reverted)
+	assert.False(t, tableExists(db, "messages"))
+
+	status, err = migrator.Status(ctx)
+	assert.Nil(t, err)
+	for _, s := range status {
+		assert.False(t, s.Applied)
+	}
+}
+
+func TestMigrator_DryRun(t *testing.T) {
+	migrator, db := newTestMigrator(t)
+	defer db.Close()
+	var out bytes.Buffer
+	migrator.DryRun = true
+	migrator.Out = &out
+
+	applied, err := migrator.Up(context.Background())
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(migrator.migrations), applied)
+	assert.Contains(t, out.String(), "-- 1_create_messages")
+	assert.Contains(t, out.String(), "CREATE TABLE messages")
+	assert.False(t, tableExists(db, "messages"))
+	assert.False(t, tableExists(db, "schema_migrations"))
+}
@@ -0,0 +1,8 @@
+CREATE TABLE messages (
+	id         BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	title      VARCHAR(255) NOT NULL,
+	body       TEXT NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	UNIQUE KEY uq_messages_title (title),
+	KEY idx_messages_created_at (created_at, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
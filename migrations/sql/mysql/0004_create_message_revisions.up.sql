@@ -0,0 +1,13 @@
+CREATE TABLE message_revisions (
+	id         BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	message_id BIGINT NOT NULL,
+	version    BIGINT NOT NULL,
+	title      VARCHAR(255) NOT NULL,
+	body       TEXT NOT NULL,
+	action     VARCHAR(16) NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	KEY idx_message_revisions_message_id (message_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO message_revisions (message_id, version, title, body, action, created_at)
+SELECT id, version, title, body, 'create', created_at FROM messages;
@@ -0,0 +1 @@
+ALTER TABLE messages DROP INDEX ft_messages_title_body;
@@ -0,0 +1 @@
+ALTER TABLE messages ADD FULLTEXT INDEX ft_messages_title_body (title, body);
@@ -0,0 +1,2 @@
+DROP INDEX idx_messages_author_id ON messages;
+ALTER TABLE messages DROP COLUMN author_id;
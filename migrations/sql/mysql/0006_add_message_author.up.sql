@@ -0,0 +1,2 @@
+ALTER TABLE messages ADD COLUMN author_id VARCHAR(255) NULL;
+CREATE INDEX idx_messages_author_id ON messages (author_id);
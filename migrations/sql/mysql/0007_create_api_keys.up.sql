@@ -0,0 +1,10 @@
+CREATE TABLE api_keys (
+	id           VARCHAR(32) NOT NULL PRIMARY KEY,
+	name         VARCHAR(255) NOT NULL,
+	principal_id VARCHAR(255) NOT NULL,
+	roles        VARCHAR(255) NOT NULL,
+	secret_hash  CHAR(64) NOT NULL,
+	created_at   DATETIME(6) NOT NULL,
+	rotated_at   DATETIME(6) NULL,
+	revoked_at   DATETIME(6) NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
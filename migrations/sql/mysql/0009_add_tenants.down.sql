@@ -0,0 +1,4 @@
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+DROP INDEX idx_messages_tenant_created_at ON messages;
+ALTER TABLE messages DROP INDEX uq_messages_tenant_title, ADD UNIQUE KEY uq_messages_title (title);
+ALTER TABLE messages DROP COLUMN tenant_id;
@@ -0,0 +1,4 @@
+ALTER TABLE messages ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE messages DROP INDEX uq_messages_title, ADD UNIQUE KEY uq_messages_tenant_title (tenant_id, title);
+CREATE INDEX idx_messages_tenant_created_at ON messages (tenant_id, created_at, id);
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
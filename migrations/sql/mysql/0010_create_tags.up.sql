@@ -0,0 +1,16 @@
+CREATE TABLE tags (
+	id        BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	tenant_id VARCHAR(64) NOT NULL DEFAULT '',
+	name      VARCHAR(64) NOT NULL,
+	UNIQUE KEY uq_tags_tenant_name (tenant_id, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE message_tags (
+	message_id BIGINT NOT NULL,
+	tag_id     BIGINT NOT NULL,
+	PRIMARY KEY (message_id, tag_id),
+	KEY idx_message_tags_tag_id (tag_id, message_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO rbac_role_permissions (role, permission) VALUES
+	('member', 'tags:manage');
@@ -0,0 +1,8 @@
+CREATE TABLE messages (
+	id         BIGSERIAL PRIMARY KEY,
+	title      VARCHAR(255) NOT NULL,
+	body       TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	CONSTRAINT uq_messages_title UNIQUE (title)
+);
+CREATE INDEX idx_messages_created_at ON messages (created_at, id);
@@ -0,0 +1 @@
+ALTER TABLE messages ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,10 @@
+CREATE TABLE api_keys (
+	id           VARCHAR(32) PRIMARY KEY,
+	name         VARCHAR(255) NOT NULL,
+	principal_id VARCHAR(255) NOT NULL,
+	roles        VARCHAR(255) NOT NULL,
+	secret_hash  CHAR(64) NOT NULL,
+	created_at   TIMESTAMPTZ NOT NULL,
+	rotated_at   TIMESTAMPTZ NULL,
+	revoked_at   TIMESTAMPTZ NULL
+);
@@ -0,0 +1,5 @@
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+DROP INDEX idx_messages_tenant_created_at;
+ALTER TABLE messages DROP CONSTRAINT uq_messages_tenant_title;
+ALTER TABLE messages ADD CONSTRAINT uq_messages_title UNIQUE (title);
+ALTER TABLE messages DROP COLUMN tenant_id;
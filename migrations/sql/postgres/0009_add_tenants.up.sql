@@ -0,0 +1,5 @@
+ALTER TABLE messages ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE messages DROP CONSTRAINT uq_messages_title;
+ALTER TABLE messages ADD CONSTRAINT uq_messages_tenant_title UNIQUE (tenant_id, title);
+CREATE INDEX idx_messages_tenant_created_at ON messages (tenant_id, created_at, id);
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DELETE FROM rbac_role_permissions WHERE role='member' AND permission='tags:manage';
+DROP TABLE message_tags;
+DROP TABLE tags;
@@ -0,0 +1,16 @@
+CREATE TABLE tags (
+	id        BIGSERIAL PRIMARY KEY,
+	tenant_id VARCHAR(64) NOT NULL DEFAULT '',
+	name      VARCHAR(64) NOT NULL,
+	CONSTRAINT uq_tags_tenant_name UNIQUE (tenant_id, name)
+);
+
+CREATE TABLE message_tags (
+	message_id BIGINT NOT NULL,
+	tag_id     BIGINT NOT NULL,
+	PRIMARY KEY (message_id, tag_id)
+);
+CREATE INDEX idx_message_tags_tag_id ON message_tags (tag_id, message_id);
+
+INSERT INTO rbac_role_permissions (role, permission) VALUES
+	('member', 'tags:manage');
@@ -0,0 +1,7 @@
+CREATE TABLE messages (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	title      VARCHAR(255) NOT NULL UNIQUE,
+	body       TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX idx_messages_created_at ON messages (created_at, id);
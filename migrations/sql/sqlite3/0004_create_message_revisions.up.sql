@@ -0,0 +1,13 @@
+CREATE TABLE message_revisions (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	message_id BIGINT NOT NULL,
+	version    BIGINT NOT NULL,
+	title      VARCHAR(255) NOT NULL,
+	body       TEXT NOT NULL,
+	action     VARCHAR(16) NOT NULL,
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX idx_message_revisions_message_id ON message_revisions (message_id, id);
+
+INSERT INTO message_revisions (message_id, version, title, body, action, created_at)
+SELECT id, version, title, body, 'create', created_at FROM messages;
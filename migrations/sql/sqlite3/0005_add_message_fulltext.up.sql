@@ -0,0 +1,2 @@
+-- only MySQL has a FULLTEXT index, the search runs on LIKE here
+SELECT 1;
@@ -0,0 +1,2 @@
+DROP INDEX idx_messages_author_id;
+ALTER TABLE messages DROP COLUMN author_id;
@@ -0,0 +1,2 @@
+DROP TABLE rbac_role_bindings;
+DROP TABLE rbac_role_permissions;
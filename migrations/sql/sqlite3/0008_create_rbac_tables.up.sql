@@ -0,0 +1,21 @@
+CREATE TABLE rbac_role_permissions (
+	role       VARCHAR(64) NOT NULL,
+	permission VARCHAR(128) NOT NULL,
+	PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE rbac_role_bindings (
+	subject VARCHAR(255) NOT NULL,
+	role    VARCHAR(64) NOT NULL,
+	PRIMARY KEY (subject, role)
+);
+
+INSERT INTO rbac_role_permissions (role, permission) VALUES
+	('member', 'messages:read'),
+	('member', 'messages:create'),
+	('member', 'messages:update'),
+	('member', 'messages:delete');
+
+INSERT INTO rbac_role_bindings (subject, role) VALUES
+	('@authenticated', 'member'),
+	('@anonymous', 'member');
@@ -0,0 +1,16 @@
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+CREATE TABLE messages_global (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	title      VARCHAR(255) NOT NULL UNIQUE,
+	body       TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	version    BIGINT NOT NULL DEFAULT 1,
+	deleted_at DATETIME NULL,
+	author_id  VARCHAR(255) NULL
+);
+INSERT INTO messages_global (id, title, body, created_at, version, deleted_at, author_id)
+SELECT id, title, body, created_at, version, deleted_at, author_id FROM messages;
+DROP TABLE messages;
+ALTER TABLE messages_global RENAME TO messages;
+CREATE INDEX idx_messages_created_at ON messages (created_at, id);
+CREATE INDEX idx_messages_author_id ON messages (author_id);
@@ -0,0 +1,20 @@
+-- the inline UNIQUE of the title can't be dropped, the table is rebuilt
+CREATE TABLE messages_tenants (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	title      VARCHAR(255) NOT NULL,
+	body       TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	version    BIGINT NOT NULL DEFAULT 1,
+	deleted_at DATETIME NULL,
+	author_id  VARCHAR(255) NULL,
+	tenant_id  VARCHAR(64) NOT NULL DEFAULT '',
+	CONSTRAINT uq_messages_tenant_title UNIQUE (tenant_id, title)
+);
+INSERT INTO messages_tenants (id, title, body, created_at, version, deleted_at, author_id)
+SELECT id, title, body, created_at, version, deleted_at, author_id FROM messages;
+DROP TABLE messages;
+ALTER TABLE messages_tenants RENAME TO messages;
+CREATE INDEX idx_messages_created_at ON messages (created_at, id);
+CREATE INDEX idx_messages_author_id ON messages (author_id);
+CREATE INDEX idx_messages_tenant_created_at ON messages (tenant_id, created_at, id);
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
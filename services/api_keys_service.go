@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+var (
+	APIKeysService apiKeysServiceInterface = &apiKeysService{}
+)
+
+type apiKeysService struct{}
+
+type apiKeysServiceInterface interface {
+	CreateAPIKey(context.Context, domain.APIKey) (*domain.IssuedAPIKey, errorutils.MessageErr)
+	ListAPIKeys(context.Context) ([]domain.APIKey, errorutils.MessageErr)
+	RotateAPIKey(ctx context.Context, id string) (*domain.IssuedAPIKey, errorutils.MessageErr)
+	RevokeAPIKey(ctx context.Context, id string) errorutils.MessageErr
+}
+
+// requireAdmin lets only the admins manage the api keys, and returns the
+// admin.
+func requireAdmin(ctx context.Context) (*auth.Principal, errorutils.MessageErr) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil, auth.NewMissingCredentialsError()
+	}
+	if !p.HasRole(auth.RoleAdmin) {
+		return nil, errorutils.NewForbiddenError("only the admins can manage the api keys")
+	}
+	return p, nil
+}
+
+// requireTenantKey lets the admins bound to a tenant manage the keys of
+// their tenant only, the others being reported missing.
+func requireTenantKey(ctx context.Context, admin *auth.Principal, id string) errorutils.MessageErr {
+	if admin.TenantID == "" {
+		return nil
+	}
+	key, err := domain.APIKeyRepo.GetAPIKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key.TenantID != admin.TenantID {
+		return domain.NewAPIKeyNotFoundError(id)
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new key for the principal and roles of key and
+// returns it with its secret, which can't be read back later. The admins
+// bound to a tenant create keys bound to it.
+func (s *apiKeysService) CreateAPIKey(ctx context.Context, key domain.APIKey) (*domain.IssuedAPIKey, errorutils.MessageErr) {
+	admin, err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if admin.TenantID != "" {
+		if key.TenantID != "" && key.TenantID != admin.TenantID {
+			return nil, errorutils.WithCode(errorutils.NewForbiddenError("you can only create keys for your tenant"), auth.CodeTenantMismatch)
+		}
+		key.TenantID = admin.TenantID
+	}
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	if key.Roles == nil {
+		key.Roles = []string{}
+	}
+	id, genErr := auth.NewAPIKeyID()
+	if genErr != nil {
+		return nil, errorutils.Wrap(errorutils.NewInternalServerError("error generating the api key"), genErr)
+	}
+	secret, genErr := auth.NewAPIKeySecret()
+	if genErr != nil {
+		return nil, errorutils.Wrap(errorutils.NewInternalServerError("error generating the api key"), genErr)
+	}
+	key.ID = id
+	key.SecretHash = auth.HashAPIKeySecret(secret)
+	key.CreatedAt = time.Now().UTC()
+	key.RotatedAt, key.RevokedAt = nil, nil
+	if err := domain.APIKeyRepo.CreateAPIKey(ctx, &key); err != nil {
+		return nil, err
+	}
+	return &domain.IssuedAPIKey{APIKey: key, Key: auth.FormatAPIKey(id, secret)}, nil
+}
+
+// ListAPIKeys lists every key, or the keys of their tenant to the admins
+// bound to one.
+func (s *apiKeysService) ListAPIKeys(ctx context.Context) ([]domain.APIKey, errorutils.MessageErr) {
+	admin, err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := domain.APIKeyRepo.ListAPIKeys(ctx)
+	if err != nil || admin.TenantID == "" {
+		return keys, err
+	}
+	tenantKeys := make([]domain.APIKey, 0, len(keys))
+	for _, key := range keys {
+		if key.TenantID == admin.TenantID {
+			tenantKeys = append(tenantKeys, key)
+		}
+	}
+	return tenantKeys, nil
+}
+
+// RotateAPIKey gives the key id a new secret, the former one being refused
+// from then on.
+func (s *apiKeysService) RotateAPIKey(ctx context.Context, id string) (*domain.IssuedAPIKey, errorutils.MessageErr) {
+	admin, adminErr := requireAdmin(ctx)
+	if adminErr != nil {
+		return nil, adminErr
+	}
+	if err := requireTenantKey(ctx, admin, id); err != nil {
+		return nil, err
+	}
+	secret, err := auth.NewAPIKeySecret()
+	if err != nil {
+		return nil, errorutils.Wrap(errorutils.NewInternalServerError("error generating the api key"), err)
+	}
+	if err := domain.APIKeyRepo.RotateAPIKey(ctx, id, auth.HashAPIKeySecret(secret), time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	key, getErr := domain.APIKeyRepo.GetAPIKey(ctx, id)
+	if getErr != nil {
+		return nil, getErr
+	}
+	return &domain.IssuedAPIKey{APIKey: *key, Key: auth.FormatAPIKey(id, secret)}, nil
+}
+
+// RevokeAPIKey refuses the key id for good. Revoked keys stay listed.
+func (s *apiKeysService) RevokeAPIKey(ctx context.Context, id string) errorutils.MessageErr {
+	admin, err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := requireTenantKey(ctx, admin, id); err != nil {
+		return err
+	}
+	return domain.APIKeyRepo.RevokeAPIKey(ctx, id, time.Now().UTC())
+}
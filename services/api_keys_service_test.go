@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func verifyAPIKey(key string) (*auth.Principal, int) {
+	r, _ := http.NewRequest(http.MethodGet, "/messages", nil)
+	r.Header.Set(auth.APIKeyHeader, key)
+	p, err := auth.APIKeyVerifier{}.Verify(r)
+	if err != nil {
+		return nil, err.Status()
+	}
+	return p, http.StatusOK
+}
+
+func TestAPIKeysService_RequiresAdmin(t *testing.T) {
+	domain.APIKeyRepo = domain.NewMemoryAPIKeyRepository()
+	key := domain.APIKey{Name: "ci", PrincipalID: "robot"}
+
+	_, err := APIKeysService.CreateAPIKey(context.Background(), key)
+	assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "bob"})
+	_, err = APIKeysService.CreateAPIKey(ctx, key)
+	assert.EqualValues(t, http.StatusForbidden, err.Status())
+	_, err = APIKeysService.ListAPIKeys(ctx)
+	assert.EqualValues(t, http.StatusForbidden, err.Status())
+	_, err = APIKeysService.RotateAPIKey(ctx, "k1")
+	assert.EqualValues(t, http.StatusForbidden, err.Status())
+	err = APIKeysService.RevokeAPIKey(ctx, "k1")
+	assert.EqualValues(t, http.StatusForbidden, err.Status())
+}
+
+func TestAPIKeysService_Lifecycle(t *testing.T) {
+	domain.APIKeyRepo = domain.NewMemoryAPIKeyRepository()
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "alice", Roles: []string{auth.RoleAdmin}})
+
+	_, err := APIKeysService.CreateAPIKey(ctx, domain.APIKey{Name: " "})
+	assert.EqualValues(t, http.StatusUnprocessableEntity, err.Status())
+
+	issued, err := APIKeysService.CreateAPIKey(ctx, domain.APIKey{ID: "chosen", Name: "ci", PrincipalID: "robot", Roles: []string{"editor"}})
+	assert.Nil(t, err)
+	assert.NotEqual(t, "chosen", issued.ID)
+	assert.NotEmpty(t, issued.SecretHash)
+	p, status := verifyAPIKey(issued.Key)
+	assert.EqualValues(t, http.StatusOK, status)
+	assert.EqualValues(t, "robot", p.ID)
+	assert.EqualValues(t, []string{"editor"}, p.Roles)
+
+	rotated, err := APIKeysService.RotateAPIKey(ctx, issued.ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, rotated.RotatedAt)
+	_, status = verifyAPIKey(issued.Key)
+	assert.EqualValues(t, http.StatusUnauthorized, status)
+	_, status = verifyAPIKey(rotated.Key)
+	assert.EqualValues(t, http.StatusOK, status)
+
+	assert.Nil(t, APIKeysService.RevokeAPIKey(ctx, issued.ID))
+	_, status = verifyAPIKey(rotated.Key)
+	assert.EqualValues(t, http.StatusUnauthorized, status)
+	err = APIKeysService.RevokeAPIKey(ctx, issued.ID)
+	assert.EqualValues(t, domain.CodeAPIKeyNotFound, err.Code())
+
+	keys, err := APIKeysService.ListAPIKeys(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(keys))
+	assert.NotNil(t, keys[0].RevokedAt)
+}
+
+func TestAPIKeysService_TenantAdmin(t *testing.T) {
+	domain.APIKeyRepo = domain.NewMemoryAPIKeyRepository()
+	root := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "root", Roles: []string{auth.RoleAdmin}})
+	acme := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "alice", Roles: []string{auth.RoleAdmin}, TenantID: "acme"})
+
+	globexKey, err := APIKeysService.CreateAPIKey(root, domain.APIKey{Name: "globex", PrincipalID: "robot", TenantID: "globex"})
+	assert.Nil(t, err)
+	p, status := verifyAPIKey(globexKey.Key)
+	assert.EqualValues(t, http.StatusOK, status)
+	assert.EqualValues(t, "globex", p.TenantID)
+
+	// the admins of a tenant only manage its keys
+	_, err = APIKeysService.CreateAPIKey(acme, domain.APIKey{Name: "ci", PrincipalID: "robot", TenantID: "globex"})
+	assert.EqualValues(t, auth.CodeTenantMismatch, err.Code())
+	acmeKey, err := APIKeysService.CreateAPIKey(acme, domain.APIKey{Name: "ci", PrincipalID: "robot"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "acme", acmeKey.TenantID)
+
+	keys, err := APIKeysService.ListAPIKeys(acme)
+	assert.Nil(t, err)
+	if assert.Len(t, keys, 1) {
+		assert.EqualValues(t, acmeKey.ID, keys[0].ID)
+	}
+	_, err = APIKeysService.RotateAPIKey(acme, globexKey.ID)
+	assert.EqualValues(t, domain.CodeAPIKeyNotFound, err.Code())
+	err = APIKeysService.RevokeAPIKey(acme, globexKey.ID)
+	assert.EqualValues(t, domain.CodeAPIKeyNotFound, err.Code())
+	_, status = verifyAPIKey(globexKey.Key)
+	assert.EqualValues(t, http.StatusOK, status)
+
+	_, err = APIKeysService.CreateAPIKey(root, domain.APIKey{Name: "bad", PrincipalID: "robot", TenantID: "a/b"})
+	assert.EqualValues(t, http.StatusUnprocessableEntity, err.Status())
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+)
+
+// authorizedMessagesService checks the permission of every call against a
+// policy before handing it to the wrapped service, so that the policy holds
+// whichever transport the call came from.
+type authorizedMessagesService struct {
+	next   messageServiceInterface
+	policy *auth.Policy
+}
+
+// NewAuthorizedMessagesService wraps next with the permission checks of policy.
+func NewAuthorizedMessagesService(next messageServiceInterface, policy *auth.Policy) messageServiceInterface {
+	return &authorizedMessagesService{next: next, policy: policy}
+}
+
+func (s *authorizedMessagesService) GetMessage(msgId int64) (*domain.Message, errorutils.MessageErr) {
+	return s.GetMessageContext(context.Background(), msgId)
+}
+
+func (s *authorizedMessagesService) GetMessageContext(ctx context.Context, msgId int64) (*domain.Message, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermReadMessages); err != nil {
+		return nil, err
+	}
+	return s.next.GetMessageContext(ctx, msgId)
+}
+
+func (s *authorizedMessagesService) GetAllMessages() ([]domain.Message, errorutils.MessageErr) {
+	return s.GetAllMessagesContext(context.Background())
+}
+
+func (s *authorizedMessagesService) GetAllMessagesContext(ctx context.Context) ([]domain.Message, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermReadMessages); err != nil {
+		return nil, err
+	}
+	return s.next.GetAllMessagesContext(ctx)
+}
+
+func (s *authorizedMessagesService) ListMessages(ctx context.Context, opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermReadMessages); err != nil {
+		return nil, err
+	}
+	return s.next.ListMessages(ctx, opts)
+}
+
+func (s *authorizedMessagesService) SearchMessages(ctx context.Context, opts domain.SearchOptions) (*domain.SearchPage, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermReadMessages); err != nil {
+		return nil, err
+	}
+	return s.next.SearchMessages(ctx, opts)
+}
+
+func (s *authorizedMessagesService) CreateMessage(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	return s.CreateMessageContext(context.Background(), message)
+}
+
+func (s *authorizedMessagesService) CreateMessageContext(ctx context.Context, message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermCreateMessages); err != nil {
+		return nil, err
+	}
+	return s.next.CreateMessageContext(ctx, message)
+}
+
+func (s *authorizedMessagesService) UpdateMessage(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	return s.UpdateMessageContext(context.Background(), message)
+}
+
+func (s *authorizedMessagesService) UpdateMessageContext(ctx context.Context, message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermUpdateMessages); err != nil {
+		return nil, err
+	}
+	return s.next.UpdateMessageContext(ctx, message)
+}
+
+func (s *authorizedMessagesService) DeleteMessage(msgId int64) errorutils.MessageErr {
+	return s.DeleteMessageContext(context.Background(), msgId)
+}
+
+func (s *authorizedMessagesService) DeleteMessageContext(ctx context.Context, msgId int64) errorutils.MessageErr {
+	if err := s.policy.Authorize(ctx, auth.PermDeleteMessages); err != nil {
+		return err
+	}
+	return s.next.DeleteMessageContext(ctx, msgId)
+}
+
+func (s *authorizedMessagesService) RestoreMessage(ctx context.Context, msgId int64) (*domain.Message, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermDeleteMessages); err != nil {
+		return nil, err
+	}
+	return s.next.RestoreMessage(ctx, msgId)
+}
+
+func (s *authorizedMessagesService) PurgeDeletedMessages(ctx context.Context, retention time.Duration) (int64, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermPurgeMessages); err != nil {
+		return 0, err
+	}
+	return s.next.PurgeDeletedMessages(ctx, retention)
+}
+
+func (s *authorizedMessagesService) ListRevisions(ctx context.Context, msgId int64) ([]domain.Revision, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermReadMessages); err != nil {
+		return nil, err
+	}
+	return s.next.ListRevisions(ctx, msgId)
+}
+
+func (s *authorizedMessagesService) GetRevision(ctx context.Context, msgId int64, revisionId int64) (*domain.Revision, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermReadMessages); err != nil {
+		return nil, err
+	}
+	return s.next.GetRevision(ctx, msgId, revisionId)
+}
+
+func (s *authorizedMessagesService) DiffRevisions(ctx context.Context, msgId int64, fromId int64, toId int64) (*domain.RevisionDiff, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermReadMessages); err != nil {
+		return nil, err
+	}
+	return s.next.DiffRevisions(ctx, msgId, fromId, toId)
+}
+
+func (s *authorizedMessagesService) RevertMessage(ctx context.Context, msgId int64, revisionId int64, version int64) (*domain.Message, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermUpdateMessages); err != nil {
+		return nil, err
+	}
+	return s.next.RevertMessage(ctx, msgId, revisionId, version)
+}
+
+func (s *authorizedMessagesService) CreateMessages(ctx context.Context, messages []domain.Message) (*domain.BatchReport, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermCreateMessages); err != nil {
+		return nil, err
+	}
+	return s.next.CreateMessages(ctx, messages)
+}
+
+func (s *authorizedMessagesService) UpdateMessages(ctx context.Context, messages []domain.Message) (*domain.BatchReport, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermUpdateMessages); err != nil {
+		return nil, err
+	}
+	return s.next.UpdateMessages(ctx, messages)
+}
+
+func (s *authorizedMessagesService) DeleteMessages(ctx context.Context, msgIds []int64) (*domain.BatchReport, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermDeleteMessages); err != nil {
+		return nil, err
+	}
+	return s.next.DeleteMessages(ctx, msgIds)
+}
+
+func (s *authorizedMessagesService) ListTags(ctx context.Context) ([]domain.TagCount, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermReadMessages); err != nil {
+		return nil, err
+	}
+	return s.next.ListTags(ctx)
+}
+
+func (s *authorizedMessagesService) RenameTag(ctx context.Context, from string, to string) (*domain.TagRename, errorutils.MessageErr) {
+	if err := s.policy.Authorize(ctx, auth.PermManageTags); err != nil {
+		return nil, err
+	}
+	return s.next.RenameTag(ctx, from, to)
+}
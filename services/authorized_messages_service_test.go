@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/silvergama/efficientAPI/auth"
+	"github.com/silvergama/efficientAPI/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizedMessagesService(t *testing.T) {
+	domain.MessageRepo = domain.NewMemoryMessageRepository()
+	policy, _ := auth.NewPolicy(auth.PolicyDocument{
+		Roles:    map[string][]string{"reader": {auth.PermReadMessages}, "writer": {"messages:*"}},
+		Bindings: map[string][]string{"alice": {"writer"}, auth.SubjectAuthenticated: {"reader"}},
+	})
+	service := NewAuthorizedMessagesService(&messagesService{}, policy)
+	alice := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "alice"})
+	bob := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "bob"})
+
+	msg, err := service.CreateMessageContext(alice, &domain.Message{Title: "title", Body: "body"})
+	assert.Nil(t, err)
+
+	_, err = service.CreateMessageContext(bob, &domain.Message{Title: "title", Body: "body"})
+	assert.EqualValues(t, http.StatusForbidden, err.Status())
+	assert.EqualValues(t, auth.CodePermissionDenied, err.Code())
+	_, err = service.CreateMessages(bob, []domain.Message{{Title: "title", Body: "body"}})
+	assert.EqualValues(t, auth.CodePermissionDenied, err.Code())
+	err = service.DeleteMessageContext(bob, msg.ID)
+	assert.EqualValues(t, auth.CodePermissionDenied, err.Code())
+	_, err = service.RestoreMessage(bob, msg.ID)
+	assert.EqualValues(t, auth.CodePermissionDenied, err.Code())
+	_, err = service.PurgeDeletedMessages(bob, time.Hour)
+	assert.EqualValues(t, auth.CodePermissionDenied, err.Code())
+
+	got, err := service.GetMessageContext(bob, msg.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "alice", got.AuthorID)
+	_, err = service.ListRevisions(bob, msg.ID)
+	assert.Nil(t, err)
+	_, err = service.ListTags(bob)
+	assert.Nil(t, err)
+	// "messages:*" doesn't cover the tags
+	_, err = service.RenameTag(alice, "work", "job")
+	assert.EqualValues(t, auth.CodePermissionDenied, err.Code())
+
+	_, err = service.GetMessage(msg.ID)
+	assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+	_, err = service.GetAllMessages()
+	assert.EqualValues(t, http.StatusUnauthorized, err.Status())
+
+	_, err = service.PurgeDeletedMessages(alice, time.Hour)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"context"
+
+	"github.com/silvergama/efficientAPI/domain"
+)
+
+var (
+	HealthService healthServiceInterface = &healthService{}
+)
+
+type healthService struct{}
+
+type healthServiceInterface interface {
+	CheckHealth(context.Context) *domain.Health
+}
+
+// CheckHealth reports whether the database of the message repository answers,
+// with the state of its connection pool.
+func (s *healthService) CheckHealth(ctx context.Context) *domain.Health {
+	return domain.CheckHealth(ctx, domain.MessageRepo)
+}
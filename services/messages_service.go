@@ -1,8 +1,13 @@
 package services
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/silvergama/efficientAPI/auth"
 	"github.com/silvergama/efficientAPI/domain"
 	"github.com/silvergama/efficientAPI/utils/errorutils"
 )
@@ -11,6 +16,9 @@ var (
 	MessagesService messageServiceInterface = &messagesService{}
 )
 
+// MaxBatchSize is the most items a single batch call accepts.
+const MaxBatchSize = 1000
+
 type messagesService struct{}
 
 type messageServiceInterface interface {
@@ -19,10 +27,32 @@ type messageServiceInterface interface {
 	UpdateMessage(*domain.Message) (*domain.Message, errorutils.MessageErr)
 	DeleteMessage(int64) errorutils.MessageErr
 	GetAllMessages() ([]domain.Message, errorutils.MessageErr)
+	GetMessageContext(context.Context, int64) (*domain.Message, errorutils.MessageErr)
+	CreateMessageContext(context.Context, *domain.Message) (*domain.Message, errorutils.MessageErr)
+	UpdateMessageContext(context.Context, *domain.Message) (*domain.Message, errorutils.MessageErr)
+	DeleteMessageContext(context.Context, int64) errorutils.MessageErr
+	GetAllMessagesContext(context.Context) ([]domain.Message, errorutils.MessageErr)
+	ListMessages(context.Context, domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr)
+	SearchMessages(context.Context, domain.SearchOptions) (*domain.SearchPage, errorutils.MessageErr)
+	RestoreMessage(context.Context, int64) (*domain.Message, errorutils.MessageErr)
+	PurgeDeletedMessages(context.Context, time.Duration) (int64, errorutils.MessageErr)
+	ListRevisions(context.Context, int64) ([]domain.Revision, errorutils.MessageErr)
+	GetRevision(ctx context.Context, msgId int64, revisionId int64) (*domain.Revision, errorutils.MessageErr)
+	DiffRevisions(ctx context.Context, msgId int64, fromId int64, toId int64) (*domain.RevisionDiff, errorutils.MessageErr)
+	RevertMessage(ctx context.Context, msgId int64, revisionId int64, version int64) (*domain.Message, errorutils.MessageErr)
+	CreateMessages(context.Context, []domain.Message) (*domain.BatchReport, errorutils.MessageErr)
+	UpdateMessages(context.Context, []domain.Message) (*domain.BatchReport, errorutils.MessageErr)
+	DeleteMessages(context.Context, []int64) (*domain.BatchReport, errorutils.MessageErr)
+	ListTags(context.Context) ([]domain.TagCount, errorutils.MessageErr)
+	RenameTag(ctx context.Context, from string, to string) (*domain.TagRename, errorutils.MessageErr)
 }
 
 func (m *messagesService) GetMessage(msgId int64) (*domain.Message, errorutils.MessageErr) {
-	message, err := domain.MessageRepo.Get(msgId)
+	return m.GetMessageContext(context.Background(), msgId)
+}
+
+func (m *messagesService) GetMessageContext(ctx context.Context, msgId int64) (*domain.Message, errorutils.MessageErr) {
+	message, err := domain.MessageRepo.GetContext(ctx, msgId)
 	if err != nil {
 		return nil, err
 	}
@@ -30,19 +60,50 @@ func (m *messagesService) GetMessage(msgId int64) (*domain.Message, errorutils.M
 }
 
 func (m *messagesService) GetAllMessages() ([]domain.Message, errorutils.MessageErr) {
-	messages, err := domain.MessageRepo.GetAll()
+	return m.GetAllMessagesContext(context.Background())
+}
+
+func (m *messagesService) GetAllMessagesContext(ctx context.Context) ([]domain.Message, errorutils.MessageErr) {
+	messages, err := domain.MessageRepo.GetAllContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return messages, nil
 }
 
+func (m *messagesService) ListMessages(ctx context.Context, opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	page, err := domain.MessageRepo.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (m *messagesService) SearchMessages(ctx context.Context, opts domain.SearchOptions) (*domain.SearchPage, errorutils.MessageErr) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	page, err := domain.MessageRepo.Search(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
 func (m *messagesService) CreateMessage(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	return m.CreateMessageContext(context.Background(), message)
+}
+
+func (m *messagesService) CreateMessageContext(ctx context.Context, message *domain.Message) (*domain.Message, errorutils.MessageErr) {
 	if err := message.Validate(); err != nil {
 		return nil, err
 	}
 	message.CreatedAt = time.Now()
-	message, err := domain.MessageRepo.Create(message)
+	message.AuthorID = authorID(ctx)
+	message, err := domain.MessageRepo.CreateContext(ctx, message)
 	if err != nil {
 		return nil, err
 	}
@@ -50,31 +111,378 @@ func (m *messagesService) CreateMessage(message *domain.Message) (*domain.Messag
 }
 
 func (m *messagesService) UpdateMessage(message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	return m.UpdateMessageContext(context.Background(), message)
+}
+
+func (m *messagesService) UpdateMessageContext(ctx context.Context, message *domain.Message) (*domain.Message, errorutils.MessageErr) {
 	if err := message.Validate(); err != nil {
 		return nil, err
 	}
-	current, err := domain.MessageRepo.Get(message.ID)
+	var updateMsg *domain.Message
+	err := domain.WithTransaction(ctx, func(repo domain.MessageRepository) errorutils.MessageErr {
+		var err errorutils.MessageErr
+		updateMsg, err = updateMessage(ctx, repo, message)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updateMsg, nil
+}
+
+// updateMessage applies the title, body and tags of message to the stored
+// one, nil tags leaving the stored ones as they are.
+func updateMessage(ctx context.Context, repo domain.MessageRepository, message *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	current, err := repo.GetContext(ctx, message.ID)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkOwner(ctx, current); err != nil {
+		return nil, err
+	}
+	// a zero version means the caller doesn't care which version it overwrites
+	if message.Version != 0 && message.Version != current.Version {
+		return nil, domain.NewVersionConflictError(message.ID)
+	}
 	current.Title = message.Title
 	current.Body = message.Body
+	tags := current.Tags
+	current.Tags = message.Tags
 
-	updateMsg, err := domain.MessageRepo.Update(current)
+	updated, err := repo.UpdateContext(ctx, current)
 	if err != nil {
 		return nil, err
 	}
-	return updateMsg, nil
+	if updated.Tags == nil {
+		updated.Tags = tags
+	}
+	return updated, nil
+}
+
+// authorID is the author of the messages the caller of ctx creates.
+func authorID(ctx context.Context) string {
+	if p, ok := auth.PrincipalFrom(ctx); ok {
+		return p.ID
+	}
+	return ""
+}
+
+// checkOwner lets only the author of msg and the admins change it. The
+// messages without an author stay open to every caller the policy lets
+// change messages: they were created before authorship was recorded, or
+// through the methods without a context, which have no principal and must
+// still be able to change what they create. The messages created over HTTP
+// always have an author, Authenticate turning the anonymous requests away.
+func checkOwner(ctx context.Context, msg *domain.Message) errorutils.MessageErr {
+	if msg.AuthorID == "" {
+		return nil
+	}
+	if p, ok := auth.PrincipalFrom(ctx); ok && (p.ID == msg.AuthorID || p.HasRole(auth.RoleAdmin)) {
+		return nil
+	}
+	return domain.NewNotOwnerError(msg.ID)
+}
+
+// checkStoredOwner runs checkOwner on the message msgId stored in repo and
+// returns its author, for the batches changing messages without reading
+// them. A missing message is left to the batch to report.
+func checkStoredOwner(ctx context.Context, repo domain.MessageRepository, msgId int64) (string, errorutils.MessageErr) {
+	msg, err := repo.GetContext(ctx, msgId)
+	if err != nil {
+		if err.Status() == http.StatusNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	return msg.AuthorID, checkOwner(ctx, msg)
 }
 
 func (m *messagesService) DeleteMessage(msgId int64) errorutils.MessageErr {
-	msg, err := domain.MessageRepo.Get(msgId)
+	return m.DeleteMessageContext(context.Background(), msgId)
+}
+
+func (m *messagesService) DeleteMessageContext(ctx context.Context, msgId int64) errorutils.MessageErr {
+	return domain.WithTransaction(ctx, func(repo domain.MessageRepository) errorutils.MessageErr {
+		msg, err := repo.GetContext(ctx, msgId)
+		if err != nil {
+			return err
+		}
+		if err := checkOwner(ctx, msg); err != nil {
+			return err
+		}
+		return repo.DeleteContext(ctx, msg.ID)
+	})
+}
+
+func (m *messagesService) RestoreMessage(ctx context.Context, msgId int64) (*domain.Message, errorutils.MessageErr) {
+	var message *domain.Message
+	err := domain.WithTransaction(ctx, func(repo domain.MessageRepository) errorutils.MessageErr {
+		msg, err := repo.GetWithDeleted(ctx, msgId)
+		if err != nil {
+			return err
+		}
+		if err := checkOwner(ctx, msg); err != nil {
+			return err
+		}
+		if err := repo.Restore(ctx, msgId); err != nil {
+			return err
+		}
+		message, err = repo.GetContext(ctx, msgId)
+		return err
+	})
 	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// PurgeDeletedMessages removes for good the messages deleted more than retention ago.
+func (m *messagesService) PurgeDeletedMessages(ctx context.Context, retention time.Duration) (int64, errorutils.MessageErr) {
+	if retention < 0 {
+		return 0, errorutils.NewBadRequestError("retention can't be negative")
+	}
+	return domain.MessageRepo.Purge(ctx, time.Now().Add(-retention))
+}
+
+func (m *messagesService) ListRevisions(ctx context.Context, msgId int64) ([]domain.Revision, errorutils.MessageErr) {
+	revisions, err := domain.MessageRepo.Revisions(ctx, msgId)
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (m *messagesService) GetRevision(ctx context.Context, msgId int64, revisionId int64) (*domain.Revision, errorutils.MessageErr) {
+	revision, err := domain.MessageRepo.GetRevision(ctx, msgId, revisionId)
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+func (m *messagesService) DiffRevisions(ctx context.Context, msgId int64, fromId int64, toId int64) (*domain.RevisionDiff, errorutils.MessageErr) {
+	from, err := domain.MessageRepo.GetRevision(ctx, msgId, fromId)
+	if err != nil {
+		return nil, err
+	}
+	to, err := domain.MessageRepo.GetRevision(ctx, msgId, toId)
+	if err != nil {
+		return nil, err
+	}
+	return domain.DiffRevisions(from, to), nil
+}
+
+// RevertMessage puts back the title and body of an older revision as a new
+// update, so the history itself is never rewritten. version works as in
+// UpdateMessage.
+func (m *messagesService) RevertMessage(ctx context.Context, msgId int64, revisionId int64, version int64) (*domain.Message, errorutils.MessageErr) {
+	var message *domain.Message
+	err := domain.WithTransaction(ctx, func(repo domain.MessageRepository) errorutils.MessageErr {
+		revision, err := repo.GetRevision(ctx, msgId, revisionId)
+		if err != nil {
+			return err
+		}
+		message, err = updateMessage(ctx, repo, &domain.Message{
+			ID:      msgId,
+			Title:   revision.Title,
+			Body:    revision.Body,
+			Version: version,
+		})
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	deleteErr := domain.MessageRepo.Delete(msg.ID)
-	if deleteErr != nil {
-		return deleteErr
+	return message, nil
+}
+
+func checkBatchSize(size int) errorutils.MessageErr {
+	if size > MaxBatchSize {
+		return errorutils.NewBadRequestError(fmt.Sprintf("a batch can't have more than %d items", MaxBatchSize))
 	}
 	return nil
 }
+
+// CreateMessages creates every valid message of the batch at once, the
+// report telling what became of each of them.
+func (m *messagesService) CreateMessages(ctx context.Context, messages []domain.Message) (*domain.BatchReport, errorutils.MessageErr) {
+	if err := checkBatchSize(len(messages)); err != nil {
+		return nil, err
+	}
+	report := domain.NewBatchReport(len(messages))
+	valid, indexes := make([]*domain.Message, 0, len(messages)), make([]int, 0, len(messages))
+	now, author := time.Now(), authorID(ctx)
+	for i := range messages {
+		message := &messages[i]
+		if err := message.Validate(); err != nil {
+			report.Fail(i, 0, err)
+			continue
+		}
+		message.CreatedAt = now
+		message.AuthorID = author
+		valid = append(valid, message)
+		indexes = append(indexes, i)
+	}
+	if len(valid) == 0 {
+		return report, nil
+	}
+
+	errs, err := domain.MessageRepo.CreateMessages(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for j, message := range valid {
+		if errs[j] != nil {
+			report.Fail(indexes[j], 0, errs[j])
+			continue
+		}
+		report.Succeed(indexes[j], message.ID, message)
+	}
+	return report, nil
+}
+
+// UpdateMessages applies every valid update of the batch at once, the
+// report telling what became of each of them. Versions work as in UpdateMessage.
+func (m *messagesService) UpdateMessages(ctx context.Context, messages []domain.Message) (*domain.BatchReport, errorutils.MessageErr) {
+	if err := checkBatchSize(len(messages)); err != nil {
+		return nil, err
+	}
+	report := domain.NewBatchReport(len(messages))
+	valid, indexes := make([]*domain.Message, 0, len(messages)), make([]int, 0, len(messages))
+	for i := range messages {
+		message := &messages[i]
+		if message.ID <= 0 {
+			report.Fail(i, message.ID, errorutils.NewBadRequestError("message id should be a positive number"))
+			continue
+		}
+		if err := message.Validate(); err != nil {
+			report.Fail(i, message.ID, err)
+			continue
+		}
+		valid = append(valid, message)
+		indexes = append(indexes, i)
+	}
+	if len(valid) == 0 {
+		return report, nil
+	}
+
+	var (
+		batch []*domain.Message
+		errs  []errorutils.MessageErr
+	)
+	err := domain.WithTransaction(ctx, func(repo domain.MessageRepository) errorutils.MessageErr {
+		// every attempt starts over from copies of the messages
+		batch, errs = make([]*domain.Message, len(valid)), make([]errorutils.MessageErr, len(valid))
+		allowed, positions := make([]*domain.Message, 0, len(valid)), make([]int, 0, len(valid))
+		for j, message := range valid {
+			msg := *message
+			batch[j] = &msg
+			author, err := checkStoredOwner(ctx, repo, msg.ID)
+			if err != nil {
+				if err.Status() >= http.StatusInternalServerError {
+					return err
+				}
+				errs[j] = err
+				continue
+			}
+			msg.AuthorID = author
+			allowed = append(allowed, &msg)
+			positions = append(positions, j)
+		}
+		if len(allowed) == 0 {
+			return nil
+		}
+		updateErrs, err := repo.UpdateMessages(ctx, allowed)
+		if err != nil {
+			return err
+		}
+		for k, j := range positions {
+			errs[j] = updateErrs[k]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for j, message := range batch {
+		if errs[j] != nil {
+			report.Fail(indexes[j], message.ID, errs[j])
+			continue
+		}
+		report.Succeed(indexes[j], message.ID, message)
+	}
+	return report, nil
+}
+
+// DeleteMessages deletes the messages of the batch at once, the report
+// telling which of them were found.
+func (m *messagesService) DeleteMessages(ctx context.Context, msgIds []int64) (*domain.BatchReport, errorutils.MessageErr) {
+	if err := checkBatchSize(len(msgIds)); err != nil {
+		return nil, err
+	}
+	report := domain.NewBatchReport(len(msgIds))
+	if len(msgIds) == 0 {
+		return report, nil
+	}
+
+	var errs []errorutils.MessageErr
+	err := domain.WithTransaction(ctx, func(repo domain.MessageRepository) errorutils.MessageErr {
+		errs = make([]errorutils.MessageErr, len(msgIds))
+		allowed, positions := make([]int64, 0, len(msgIds)), make([]int, 0, len(msgIds))
+		for i, msgId := range msgIds {
+			if _, err := checkStoredOwner(ctx, repo, msgId); err != nil {
+				if err.Status() >= http.StatusInternalServerError {
+					return err
+				}
+				errs[i] = err
+				continue
+			}
+			allowed = append(allowed, msgId)
+			positions = append(positions, i)
+		}
+		if len(allowed) == 0 {
+			return nil
+		}
+		deleteErrs, err := repo.DeleteMessages(ctx, allowed)
+		if err != nil {
+			return err
+		}
+		for k, i := range positions {
+			errs[i] = deleteErrs[k]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, msgId := range msgIds {
+		if errs[i] != nil {
+			report.Fail(i, msgId, errs[i])
+			continue
+		}
+		report.Succeed(i, msgId, nil)
+	}
+	return report, nil
+}
+
+func (m *messagesService) ListTags(ctx context.Context) ([]domain.TagCount, errorutils.MessageErr) {
+	tags, err := domain.MessageRepo.Tags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// RenameTag renames the tag from to to on every message carrying it, merging
+// it into to when that is a tag already.
+func (m *messagesService) RenameTag(ctx context.Context, from string, to string) (*domain.TagRename, errorutils.MessageErr) {
+	from = strings.ToLower(strings.TrimSpace(from))
+	to, err := domain.ValidateTag(to)
+	if err != nil {
+		return nil, err
+	}
+	if from == to {
+		return nil, errorutils.NewBadRequestError("a tag can't be renamed to itself")
+	}
+	return domain.MessageRepo.RenameTag(ctx, from, to)
+}
@@ -1,12 +1,14 @@
 package services
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/silvergama/efficientAPI/auth"
 	"github.com/silvergama/efficientAPI/domain"
 	"github.com/silvergama/efficientAPI/utils/errorutils"
 	"github.com/stretchr/testify/assert"
@@ -19,6 +21,17 @@ var (
 	updateMessageDomain  func(msg *domain.Message) (*domain.Message, errorutils.MessageErr)
 	deleteMessageDomain  func(messageId int64) errorutils.MessageErr
 	getAllMessagesDomain func() ([]domain.Message, errorutils.MessageErr)
+	listMessagesDomain   func(opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr)
+	restoreMessageDomain func(messageId int64) errorutils.MessageErr
+	purgeMessagesDomain  func(before time.Time) (int64, errorutils.MessageErr)
+	listRevisionsDomain  func(messageId int64) ([]domain.Revision, errorutils.MessageErr)
+	getRevisionDomain    func(messageId, revisionId int64) (*domain.Revision, errorutils.MessageErr)
+	createMessagesDomain func(msgs []*domain.Message) ([]errorutils.MessageErr, errorutils.MessageErr)
+	updateMessagesDomain func(msgs []*domain.Message) ([]errorutils.MessageErr, errorutils.MessageErr)
+	deleteMessagesDomain func(msgIds []int64) ([]errorutils.MessageErr, errorutils.MessageErr)
+	searchMessagesDomain func(opts domain.SearchOptions) (*domain.SearchPage, errorutils.MessageErr)
+	listTagsDomain       func() ([]domain.TagCount, errorutils.MessageErr)
+	renameTagDomain      func(from, to string) (*domain.TagRename, errorutils.MessageErr)
 )
 
 type getDBMock struct{}
@@ -43,8 +56,72 @@ func (m *getDBMock) GetAll() ([]domain.Message, errorutils.MessageErr) {
 	return getAllMessagesDomain()
 }
 
-func (m *getDBMock) Initialize(string, string, string, string, string, string) *sql.DB {
-	return nil
+func (m *getDBMock) GetContext(_ context.Context, messageID int64) (*domain.Message, errorutils.MessageErr) {
+	return getMessageDomain(messageID)
+}
+
+func (m *getDBMock) GetWithDeleted(_ context.Context, messageID int64) (*domain.Message, errorutils.MessageErr) {
+	return getMessageDomain(messageID)
+}
+
+func (m *getDBMock) CreateContext(_ context.Context, msg *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	return createMessageDomain(msg)
+}
+
+func (m *getDBMock) UpdateContext(_ context.Context, msg *domain.Message) (*domain.Message, errorutils.MessageErr) {
+	return updateMessageDomain(msg)
+}
+
+func (m *getDBMock) DeleteContext(_ context.Context, messageID int64) errorutils.MessageErr {
+	return deleteMessageDomain(messageID)
+}
+
+func (m *getDBMock) GetAllContext(_ context.Context) ([]domain.Message, errorutils.MessageErr) {
+	return getAllMessagesDomain()
+}
+
+func (m *getDBMock) List(_ context.Context, opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr) {
+	return listMessagesDomain(opts)
+}
+
+func (m *getDBMock) Restore(_ context.Context, messageID int64) errorutils.MessageErr {
+	return restoreMessageDomain(messageID)
+}
+
+func (m *getDBMock) Purge(_ context.Context, before time.Time) (int64, errorutils.MessageErr) {
+	return purgeMessagesDomain(before)
+}
+
+func (m *getDBMock) Revisions(_ context.Context, messageID int64) ([]domain.Revision, errorutils.MessageErr) {
+	return listRevisionsDomain(messageID)
+}
+
+func (m *getDBMock) GetRevision(_ context.Context, messageID int64, revisionID int64) (*domain.Revision, errorutils.MessageErr) {
+	return getRevisionDomain(messageID, revisionID)
+}
+
+func (m *getDBMock) CreateMessages(_ context.Context, msgs []*domain.Message) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	return createMessagesDomain(msgs)
+}
+
+func (m *getDBMock) UpdateMessages(_ context.Context, msgs []*domain.Message) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	return updateMessagesDomain(msgs)
+}
+
+func (m *getDBMock) DeleteMessages(_ context.Context, msgIds []int64) ([]errorutils.MessageErr, errorutils.MessageErr) {
+	return deleteMessagesDomain(msgIds)
+}
+
+func (m *getDBMock) Search(_ context.Context, opts domain.SearchOptions) (*domain.SearchPage, errorutils.MessageErr) {
+	return searchMessagesDomain(opts)
+}
+
+func (m *getDBMock) Tags(_ context.Context) ([]domain.TagCount, errorutils.MessageErr) {
+	return listTagsDomain()
+}
+
+func (m *getDBMock) RenameTag(_ context.Context, from string, to string) (*domain.TagRename, errorutils.MessageErr) {
+	return renameTagDomain(from, to)
 }
 
 ///////////////////////////////////////////////////////////
@@ -163,6 +240,21 @@ func TestMessagesService_CreateMessage_Invalid_Request(t *testing.T) {
 	}
 }
 
+func TestMessagesService_CreateMessage_Every_Invalid_Field(t *testing.T) {
+	msg, err := MessagesService.CreateMessage(&domain.Message{Title: "", Body: "nul\x00", CreatedAt: tm})
+	assert.Nil(t, msg)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusUnprocessableEntity, err.Status())
+	assert.EqualValues(t, []errorutils.FieldError{
+		{Field: "title", Code: domain.CodeRequired, Message: "Please enter a valid title"},
+		{Field: "body", Code: domain.CodeForbiddenChar, Message: "body must not contain the character U+0000"},
+	}, err.Details())
+
+	msg, err = MessagesService.UpdateMessage(&domain.Message{ID: 1, Title: strings.Repeat("a", domain.MaxTitleLength+1), Body: "body"})
+	assert.Nil(t, msg)
+	assert.EqualValues(t, domain.CodeTooLong, err.Details()[0].Code)
+}
+
 // We mock the "Get" method	in the domain here. What could go wrong?,
 // Since the title of the message must be unique, an error be thrown,
 // Of course you can also mock when the sql query is wrong, etc(these where covered in the domain integration__tests),
@@ -170,7 +262,7 @@ func TestMessagesService_CreateMessage_Invalid_Request(t *testing.T) {
 func TestMessagesService_CreateMessage_Failure(t *testing.T) {
 	domain.MessageRepo = &getDBMock{}
 	createMessageDomain = func(msg *domain.Message) (*domain.Message, errorutils.MessageErr) {
-		return nil, errorutils.NewInternalServerError("title already taken")
+		return nil, errorutils.NewConflictError("title already taken")
 	}
 
 	request := &domain.Message{
@@ -183,8 +275,8 @@ func TestMessagesService_CreateMessage_Failure(t *testing.T) {
 	assert.Nil(t, msg)
 	assert.NotNil(t, err)
 	assert.EqualValues(t, "title already taken", err.Message())
-	assert.EqualValues(t, http.StatusInternalServerError, err.Status())
-	assert.EqualValues(t, "server_error", err.Error())
+	assert.EqualValues(t, http.StatusConflict, err.Status())
+	assert.EqualValues(t, "conflict", err.Error())
 }
 
 ///////////////////////////////////////////////////////////////////
@@ -223,3 +315,508 @@ func TestMessagesService_UpdateMessage_Success(t *testing.T) {
 	assert.EqualValues(t, "the title update", msg.Title)
 	assert.EqualValues(t, "the body update", msg.Body)
 }
+
+// The caller edited an older version than the stored one
+func TestMessagesService_UpdateMessage_VersionConflict(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	getMessageDomain = func(messageId int64) (*domain.Message, errorutils.MessageErr) {
+		return &domain.Message{
+			ID:      1,
+			Title:   "former title",
+			Body:    "former body",
+			Version: 3,
+		}, nil
+	}
+
+	request := &domain.Message{
+		ID:      1,
+		Title:   "the title update",
+		Body:    "the body update",
+		Version: 2,
+	}
+	msg, err := MessagesService.UpdateMessage(request)
+	assert.Nil(t, msg)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusConflict, err.Status())
+	assert.EqualValues(t, "conflict", err.Error())
+}
+
+///////////////////////////////////////////////////////////////
+// Start of "ListMessages" test cases
+///////////////////////////////////////////////////////////////
+func TestMessagesService_ListMessages_Success(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	listMessagesDomain = func(opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr) {
+		assert.EqualValues(t, domain.DefaultPageSize, opts.PageSize)
+		assert.EqualValues(t, domain.SortAsc, opts.Sort)
+		return &domain.MessagePage{
+			Items: []domain.Message{
+				{ID: 1, Title: "first title", Body: "first body"},
+			},
+			NextCursor: "next",
+		}, nil
+	}
+	page, err := MessagesService.ListMessages(context.Background(), domain.ListOptions{})
+	assert.Nil(t, err)
+	assert.NotNil(t, page)
+	assert.EqualValues(t, 1, len(page.Items))
+	assert.EqualValues(t, "next", page.NextCursor)
+}
+
+// An empty page is a normal result, not a "not found"
+func TestMessagesService_ListMessages_Empty(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	listMessagesDomain = func(opts domain.ListOptions) (*domain.MessagePage, errorutils.MessageErr) {
+		return &domain.MessagePage{Items: []domain.Message{}}, nil
+	}
+	page, err := MessagesService.ListMessages(context.Background(), domain.ListOptions{})
+	assert.Nil(t, err)
+	assert.NotNil(t, page)
+	assert.EqualValues(t, 0, len(page.Items))
+	assert.EqualValues(t, "", page.NextCursor)
+}
+
+func TestMessagesService_ListMessages_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		opts   domain.ListOptions
+		errMsg string
+	}{
+		{opts: domain.ListOptions{PageSize: 101}, errMsg: "page size must be between 1 and 100"},
+		{opts: domain.ListOptions{Sort: "sideways"}, errMsg: "sort order must be asc or desc"},
+		{opts: domain.ListOptions{Cursor: "not a cursor"}, errMsg: "invalid cursor"},
+		{opts: domain.ListOptions{CreatedFrom: tm, CreatedTo: tm}, errMsg: "created_from must be before created_to"},
+	}
+	for _, tt := range tests {
+		page, err := MessagesService.ListMessages(context.Background(), tt.opts)
+		assert.Nil(t, page)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, http.StatusBadRequest, err.Status())
+		assert.EqualValues(t, tt.errMsg, err.Message())
+	}
+}
+
+///////////////////////////////////////////////////////////////
+// Start of "RestoreMessage" and "PurgeDeletedMessages" test cases
+///////////////////////////////////////////////////////////////
+func TestMessagesService_RestoreMessage_Success(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	restoreMessageDomain = func(messageId int64) errorutils.MessageErr {
+		return nil
+	}
+	getMessageDomain = func(messageId int64) (*domain.Message, errorutils.MessageErr) {
+		return &domain.Message{ID: messageId, Title: "the title", Body: "the body"}, nil
+	}
+	msg, err := MessagesService.RestoreMessage(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, msg)
+	assert.EqualValues(t, 1, msg.ID)
+}
+
+func TestMessagesService_RestoreMessage_NotDeleted(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	restoreMessageDomain = func(messageId int64) errorutils.MessageErr {
+		return errorutils.NewNotFoundError("no record matching gived id")
+	}
+	msg, err := MessagesService.RestoreMessage(context.Background(), 1)
+	assert.Nil(t, msg)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+}
+
+func TestMessagesService_PurgeDeletedMessages(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	purgeMessagesDomain = func(before time.Time) (int64, errorutils.MessageErr) {
+		assert.WithinDuration(t, time.Now().Add(-time.Hour), before, time.Second)
+		return 2, nil
+	}
+	purged, err := MessagesService.PurgeDeletedMessages(context.Background(), time.Hour)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, purged)
+
+	_, err = MessagesService.PurgeDeletedMessages(context.Background(), -time.Hour)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, err.Status())
+}
+
+func TestRunPurger(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	calls := make(chan time.Time, 10)
+	purgeMessagesDomain = func(before time.Time) (int64, errorutils.MessageErr) {
+		calls <- before
+		return 1, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunPurger(ctx, time.Hour, 5*time.Millisecond)
+		close(done)
+	}()
+
+	// once on start, then on every tick
+	<-calls
+	<-calls
+	cancel()
+	<-done
+}
+
+///////////////////////////////////////////////////////////////
+// Start of revisions test cases
+///////////////////////////////////////////////////////////////
+func TestMessagesService_DiffRevisions(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	getRevisionDomain = func(messageId, revisionId int64) (*domain.Revision, errorutils.MessageErr) {
+		if revisionId == 1 {
+			return &domain.Revision{ID: 1, MessageID: messageId, Title: "title", Body: "first\nsecond"}, nil
+		}
+		return &domain.Revision{ID: revisionId, MessageID: messageId, Title: "title", Body: "first\nthird"}, nil
+	}
+	diff, err := MessagesService.DiffRevisions(context.Background(), 1, 1, 2)
+	assert.Nil(t, err)
+	assert.Len(t, diff.Changes, 1)
+	assert.EqualValues(t, []domain.DiffLine{
+		{Op: domain.DiffEqual, Text: "first"},
+		{Op: domain.DiffDelete, Text: "second"},
+		{Op: domain.DiffInsert, Text: "third"},
+	}, diff.Changes[0].Lines)
+}
+
+func TestMessagesService_DiffRevisions_NotFound(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	getRevisionDomain = func(messageId, revisionId int64) (*domain.Revision, errorutils.MessageErr) {
+		return nil, errorutils.NewNotFoundError("no record matching gived id")
+	}
+	diff, err := MessagesService.DiffRevisions(context.Background(), 1, 1, 2)
+	assert.Nil(t, diff)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+}
+
+func TestMessagesService_RevertMessage(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	getRevisionDomain = func(messageId, revisionId int64) (*domain.Revision, errorutils.MessageErr) {
+		return &domain.Revision{ID: revisionId, MessageID: messageId, Title: "old title", Body: "old body"}, nil
+	}
+	getMessageDomain = func(messageId int64) (*domain.Message, errorutils.MessageErr) {
+		return &domain.Message{ID: messageId, Title: "title", Body: "body", Version: 3}, nil
+	}
+	updateMessageDomain = func(msg *domain.Message) (*domain.Message, errorutils.MessageErr) {
+		msg.Version++
+		return msg, nil
+	}
+	msg, err := MessagesService.RevertMessage(context.Background(), 1, 1, 3)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "old title", msg.Title)
+	assert.EqualValues(t, "old body", msg.Body)
+	assert.EqualValues(t, 4, msg.Version)
+
+	_, err = MessagesService.RevertMessage(context.Background(), 1, 1, 2)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusConflict, err.Status())
+}
+
+///////////////////////////////////////////////////////////////
+// Start of "SearchMessages" test cases
+///////////////////////////////////////////////////////////////
+func TestMessagesService_SearchMessages(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	searchMessagesDomain = func(opts domain.SearchOptions) (*domain.SearchPage, errorutils.MessageErr) {
+		assert.EqualValues(t, "go", opts.Query)
+		assert.EqualValues(t, domain.DefaultPageSize, opts.PageSize)
+		return &domain.SearchPage{Items: []domain.SearchHit{{Message: domain.Message{ID: 1}, Score: 1}}}, nil
+	}
+	page, err := MessagesService.SearchMessages(context.Background(), domain.SearchOptions{Query: "go"})
+	assert.Nil(t, err)
+	assert.Len(t, page.Items, 1)
+}
+
+func TestMessagesService_SearchMessages_EmptyQuery(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	page, err := MessagesService.SearchMessages(context.Background(), domain.SearchOptions{Query: " "})
+	assert.Nil(t, page)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, err.Status())
+}
+
+///////////////////////////////////////////////////////////////
+// Start of batch test cases
+///////////////////////////////////////////////////////////////
+func TestMessagesService_CreateMessages(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	createMessagesDomain = func(msgs []*domain.Message) ([]errorutils.MessageErr, errorutils.MessageErr) {
+		assert.Len(t, msgs, 2)
+		msgs[0].ID = 1
+		return []errorutils.MessageErr{nil, errorutils.NewConflictError("title already taken")}, nil
+	}
+	report, err := MessagesService.CreateMessages(context.Background(), []domain.Message{
+		{Title: "first", Body: "body"},
+		{Title: "", Body: "body"},
+		{Title: "taken", Body: "body"},
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, report.Succeeded)
+	assert.EqualValues(t, 2, report.Failed)
+	assert.EqualValues(t, 1, report.Results[0].ID)
+	assert.False(t, report.Results[0].Message.CreatedAt.IsZero())
+	assert.EqualValues(t, http.StatusUnprocessableEntity, report.Results[1].Error.Status())
+	assert.EqualValues(t, "title", report.Results[1].Error.Details()[0].Field)
+	assert.EqualValues(t, "title already taken", report.Results[2].Error.Message())
+}
+
+func TestMessagesService_CreateMessages_TooMany(t *testing.T) {
+	report, err := MessagesService.CreateMessages(context.Background(), make([]domain.Message, MaxBatchSize+1))
+	assert.Nil(t, report)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusBadRequest, err.Status())
+}
+
+func TestMessagesService_UpdateMessages(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	getMessageDomain = func(msgId int64) (*domain.Message, errorutils.MessageErr) {
+		return &domain.Message{ID: msgId, Title: "title", Body: "body", Version: 1}, nil
+	}
+	updateMessagesDomain = func(msgs []*domain.Message) ([]errorutils.MessageErr, errorutils.MessageErr) {
+		assert.Len(t, msgs, 2)
+		msgs[0].Version = 3
+		return []errorutils.MessageErr{nil, domain.NewVersionConflictError(msgs[1].ID)}, nil
+	}
+	report, err := MessagesService.UpdateMessages(context.Background(), []domain.Message{
+		{ID: 1, Title: "title", Body: "body"},
+		{ID: 0, Title: "title", Body: "body"},
+		{ID: 2, Title: "title", Body: "body", Version: 1},
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, report.Succeeded)
+	assert.EqualValues(t, 3, report.Results[0].Message.Version)
+	assert.EqualValues(t, http.StatusBadRequest, report.Results[1].Error.Status())
+	assert.EqualValues(t, 2, report.Results[2].ID)
+	assert.EqualValues(t, http.StatusConflict, report.Results[2].Error.Status())
+}
+
+func TestMessagesService_DeleteMessages(t *testing.T) {
+	domain.MessageRepo = &getDBMock{}
+	getMessageDomain = func(msgId int64) (*domain.Message, errorutils.MessageErr) {
+		return &domain.Message{ID: msgId, Title: "title", Body: "body", Version: 1}, nil
+	}
+	deleteMessagesDomain = func(msgIds []int64) ([]errorutils.MessageErr, errorutils.MessageErr) {
+		return []errorutils.MessageErr{nil, errorutils.NewNotFoundError("no record matching gived id")}, nil
+	}
+	report, err := MessagesService.DeleteMessages(context.Background(), []int64{1, 2})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, report.Succeeded)
+	assert.EqualValues(t, 1, report.Failed)
+	assert.EqualValues(t, 2, report.Results[1].ID)
+
+	deleteMessagesDomain = func(msgIds []int64) ([]errorutils.MessageErr, errorutils.MessageErr) {
+		return nil, errorutils.NewServiceUnavailableError("the database is unavailable, please retry later")
+	}
+	report, err = MessagesService.DeleteMessages(context.Background(), []int64{1})
+	assert.Nil(t, report)
+	assert.EqualValues(t, http.StatusServiceUnavailable, err.Status())
+
+	// the ownership can't be skipped when the message can't be read
+	deleteMessagesDomain = func(msgIds []int64) ([]errorutils.MessageErr, errorutils.MessageErr) {
+		t.Fatal("no message should be deleted")
+		return nil, nil
+	}
+	getMessageDomain = func(msgId int64) (*domain.Message, errorutils.MessageErr) {
+		return nil, errorutils.NewServiceUnavailableError("the database is unavailable, please retry later")
+	}
+	report, err = MessagesService.DeleteMessages(context.Background(), []int64{1})
+	assert.Nil(t, report)
+	assert.EqualValues(t, http.StatusServiceUnavailable, err.Status())
+	_, err = MessagesService.UpdateMessages(context.Background(), []domain.Message{{ID: 1, Title: "title", Body: "body"}})
+	assert.EqualValues(t, http.StatusServiceUnavailable, err.Status())
+}
+
+func TestMessagesService_Ownership(t *testing.T) {
+	domain.MessageRepo = domain.NewMemoryMessageRepository()
+	alice := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "alice"})
+	bob := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "bob"})
+	admin := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "carol", Roles: []string{auth.RoleAdmin}})
+
+	// the author can't be chosen by the caller
+	msg, err := MessagesService.CreateMessageContext(alice, &domain.Message{Title: "the title", Body: "the body", AuthorID: "bob"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "alice", msg.AuthorID)
+
+	for _, ctx := range []context.Context{bob, context.Background()} {
+		_, err = MessagesService.UpdateMessageContext(ctx, &domain.Message{ID: msg.ID, Title: "new title", Body: "the body"})
+		assert.EqualValues(t, http.StatusForbidden, err.Status())
+		assert.EqualValues(t, domain.CodeNotOwner, err.Code())
+		err = MessagesService.DeleteMessageContext(ctx, msg.ID)
+		assert.EqualValues(t, http.StatusForbidden, err.Status())
+	}
+	_, err = MessagesService.RevertMessage(bob, msg.ID, 1, 0)
+	assert.EqualValues(t, http.StatusForbidden, err.Status())
+	assert.Nil(t, MessagesService.DeleteMessageContext(alice, msg.ID))
+	_, err = MessagesService.RestoreMessage(bob, msg.ID)
+	assert.EqualValues(t, http.StatusForbidden, err.Status())
+	_, err = MessagesService.RestoreMessage(alice, msg.ID)
+	assert.Nil(t, err)
+
+	updated, err := MessagesService.UpdateMessageContext(alice, &domain.Message{ID: msg.ID, Title: "new title", Body: "the body"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "alice", updated.AuthorID)
+	_, err = MessagesService.UpdateMessageContext(admin, &domain.Message{ID: msg.ID, Title: "admin title", Body: "the body"})
+	assert.Nil(t, err)
+
+	// the batches check every item
+	legacy, _ := MessagesService.CreateMessage(&domain.Message{Title: "legacy", Body: "the body"})
+	assert.EqualValues(t, "", legacy.AuthorID)
+	report, err := MessagesService.UpdateMessages(bob, []domain.Message{
+		{ID: msg.ID, Title: "bob title", Body: "the body"},
+		{ID: legacy.ID, Title: "bob legacy", Body: "the body"},
+	})
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusForbidden, report.Results[0].Error.Status())
+	assert.Nil(t, report.Results[1].Error)
+	report, err = MessagesService.DeleteMessages(bob, []int64{msg.ID, legacy.ID, 42})
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusForbidden, report.Results[0].Error.Status())
+	assert.Nil(t, report.Results[1].Error)
+	assert.EqualValues(t, http.StatusNotFound, report.Results[2].Error.Status())
+
+	assert.Nil(t, MessagesService.DeleteMessageContext(alice, msg.ID))
+}
+
+func TestMessagesService_OwnerlessMessages(t *testing.T) {
+	domain.MessageRepo = domain.NewMemoryMessageRepository()
+	bob := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "bob"})
+
+	// the messages without an author are open to every caller, anonymous
+	// or not, and changing them doesn't make them the caller's
+	legacy, err := MessagesService.CreateMessage(&domain.Message{Title: "legacy", Body: "the body"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "", legacy.AuthorID)
+	for _, ctx := range []context.Context{bob, context.Background()} {
+		updated, err := MessagesService.UpdateMessageContext(ctx, &domain.Message{ID: legacy.ID, Title: "legacy", Body: "another body"})
+		assert.Nil(t, err)
+		assert.EqualValues(t, "", updated.AuthorID)
+		assert.Nil(t, MessagesService.DeleteMessageContext(ctx, legacy.ID))
+		_, err = MessagesService.RestoreMessage(ctx, legacy.ID)
+		assert.Nil(t, err)
+		_, err = MessagesService.RevertMessage(ctx, legacy.ID, 1, 0)
+		assert.Nil(t, err)
+	}
+	got, err := MessagesService.GetMessage(legacy.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "", got.AuthorID)
+	assert.EqualValues(t, "the body", got.Body)
+}
+
+func TestMessagesService_TenantIsolation(t *testing.T) {
+	domain.MessageRepo = domain.NewMemoryMessageRepository()
+	admin := &auth.Principal{ID: "carol", Roles: []string{auth.RoleAdmin}}
+	acme := domain.WithTenant(auth.WithPrincipal(context.Background(), admin), "acme")
+	globex := domain.WithTenant(auth.WithPrincipal(context.Background(), admin), "globex")
+
+	// the tenant can't be chosen by the caller either
+	msg, err := MessagesService.CreateMessageContext(acme, &domain.Message{Title: "the title", Body: "the body", TenantID: "globex"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "acme", msg.TenantID)
+
+	// not even an admin of another tenant sees it
+	_, err = MessagesService.GetMessageContext(globex, msg.ID)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+	_, err = MessagesService.GetAllMessagesContext(globex)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+	page, err := MessagesService.ListMessages(globex, domain.ListOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, page.Items)
+	_, err = MessagesService.ListRevisions(globex, msg.ID)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+
+	_, err = MessagesService.UpdateMessageContext(globex, &domain.Message{ID: msg.ID, Title: "new title", Body: "the body"})
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+	_, err = MessagesService.RevertMessage(globex, msg.ID, 1, 0)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+	assert.EqualValues(t, http.StatusNotFound, MessagesService.DeleteMessageContext(globex, msg.ID).Status())
+	report, err := MessagesService.UpdateMessages(globex, []domain.Message{{ID: msg.ID, Title: "new title", Body: "the body"}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, report.Results[0].Error.Status())
+	report, err = MessagesService.DeleteMessages(globex, []int64{msg.ID})
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, report.Results[0].Error.Status())
+
+	// the same title is free in another tenant
+	_, err = MessagesService.CreateMessageContext(globex, &domain.Message{Title: "the title", Body: "the body"})
+	assert.Nil(t, err)
+
+	got, err := MessagesService.GetMessageContext(acme, msg.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, got.Version)
+	assert.Nil(t, MessagesService.DeleteMessageContext(acme, msg.ID))
+	_, err = MessagesService.RestoreMessage(globex, msg.ID)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+}
+
+///////////////////////////////////////////////////////////////
+// Service running on top of the in-memory repository
+///////////////////////////////////////////////////////////////
+func TestMessagesService_MemoryRepository(t *testing.T) {
+	domain.MessageRepo = domain.NewMemoryMessageRepository()
+
+	created, err := MessagesService.CreateMessage(&domain.Message{Title: "the title", Body: "the body"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, created.ID)
+
+	_, err = MessagesService.CreateMessage(&domain.Message{Title: "the title", Body: "another body"})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "title already taken", err.Message())
+
+	updated, err := MessagesService.UpdateMessage(&domain.Message{ID: 1, Title: "new title", Body: "new body"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, "new title", updated.Title)
+	assert.EqualValues(t, 2, updated.Version)
+
+	_, err = MessagesService.UpdateMessage(&domain.Message{ID: 1, Title: "stale title", Body: "stale body", Version: 1})
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusConflict, err.Status())
+
+	assert.Nil(t, MessagesService.DeleteMessage(1))
+	_, err = MessagesService.GetMessage(1)
+	assert.NotNil(t, err)
+	assert.EqualValues(t, http.StatusNotFound, err.Status())
+
+	restored, err := MessagesService.RestoreMessage(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "new title", restored.Title)
+}
+
+func TestMessagesService_Tags(t *testing.T) {
+	domain.MessageRepo = domain.NewMemoryMessageRepository()
+
+	created, err := MessagesService.CreateMessage(&domain.Message{Title: "title", Body: "body", Tags: []string{" Work", "go", "work"}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"go", "work"}, created.Tags)
+
+	_, err = MessagesService.CreateMessage(&domain.Message{Title: "other", Body: "body", Tags: []string{"two\nlines"}})
+	assert.EqualValues(t, http.StatusUnprocessableEntity, err.Status())
+	assert.EqualValues(t, "tags", err.Details()[0].Field)
+
+	// without tags an update keeps them
+	updated, err := MessagesService.UpdateMessage(&domain.Message{ID: created.ID, Title: "new title", Body: "body"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"go", "work"}, updated.Tags)
+	updated, err = MessagesService.UpdateMessage(&domain.Message{ID: created.ID, Title: "new title", Body: "body", Tags: []string{"go"}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"go"}, updated.Tags)
+
+	tags, err := MessagesService.ListTags(context.Background())
+	assert.Nil(t, err)
+	assert.EqualValues(t, []domain.TagCount{{Name: "go", Count: 1}}, tags)
+
+	_, err = MessagesService.RenameTag(context.Background(), "go", " GO ")
+	assert.EqualValues(t, http.StatusBadRequest, err.Status())
+	_, err = MessagesService.RenameTag(context.Background(), "go", "")
+	assert.EqualValues(t, http.StatusUnprocessableEntity, err.Status())
+	_, err = MessagesService.RenameTag(context.Background(), "missing", "found")
+	assert.EqualValues(t, domain.CodeTagNotFound, err.Code())
+
+	rename, err := MessagesService.RenameTag(context.Background(), "Go", "Golang")
+	assert.Nil(t, err)
+	assert.EqualValues(t, &domain.TagRename{From: "go", To: "golang", MessageIDs: []int64{created.ID}}, rename)
+	got, err := MessagesService.GetMessage(created.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"golang"}, got.Tags)
+}
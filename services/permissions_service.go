@@ -0,0 +1,30 @@
+package services
+
+import (
+	"context"
+
+	"github.com/silvergama/efficientAPI/auth"
+)
+
+var (
+	PermissionsService permissionsServiceInterface = NewPermissionsService(auth.DefaultPolicy())
+)
+
+type permissionsService struct {
+	policy *auth.Policy
+}
+
+type permissionsServiceInterface interface {
+	GetGrants(context.Context) *auth.Grants
+}
+
+// NewPermissionsService reports the grants of the callers under policy, which
+// should be the one guarding MessagesService.
+func NewPermissionsService(policy *auth.Policy) permissionsServiceInterface {
+	return &permissionsService{policy: policy}
+}
+
+// GetGrants returns the roles and permissions the caller of ctx has.
+func (s *permissionsService) GetGrants(ctx context.Context) *auth.Grants {
+	return s.policy.Grants(ctx)
+}
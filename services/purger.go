@@ -0,0 +1,32 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/silvergama/efficientAPI/auth"
+)
+
+// RunPurger purges the messages deleted more than retention ago right away
+// and then every interval, until ctx is done. It runs as an admin, whoever
+// wrote the messages.
+func RunPurger(ctx context.Context, retention, interval time.Duration) {
+	ctx = auth.WithPrincipal(ctx, &auth.Principal{ID: "purger", Roles: []string{auth.RoleAdmin}})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := MessagesService.PurgeDeletedMessages(ctx, retention)
+		if err != nil {
+			log.Printf("error purging the deleted messages: %s", err.Message())
+		} else if purged > 0 {
+			log.Printf("purged %d deleted messages", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,24 +1,171 @@
 package error_formats
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net"
 	"strings"
+	"sync"
 
-	"github.com/go-sql-driver/mysql"
 	"github.com/silvergama/efficientAPI/utils/errorutils"
 )
 
+// Kind is the driver independent category of a database error.
+type Kind int
+
+const (
+	KindUnknown Kind = iota
+	KindNotFound
+	KindUniqueViolation
+	KindForeignKeyViolation
+	KindDeadlock
+	KindConnection
+	// KindStaleStatement is a prepared statement the server no longer knows
+	// or can't run anymore, which works again once prepared anew.
+	KindStaleStatement
+)
+
+// Classifier recognizes the errors of one database driver.
+type Classifier interface {
+	// Classify returns the Kind of err, ok being false when err wasn't
+	// produced by the driver of the classifier.
+	Classify(err error) (kind Kind, ok bool)
+}
+
+// ClassifierFunc adapts a plain function to a Classifier.
+type ClassifierFunc func(err error) (Kind, bool)
+
+func (f ClassifierFunc) Classify(err error) (Kind, bool) {
+	return f(err)
+}
+
+type namedClassifier struct {
+	driver string
+	Classifier
+}
+
+var (
+	classifiersMu sync.RWMutex
+	classifiers   []namedClassifier
+)
+
+// RegisterClassifier makes the errors of driver known to ParseError. Registering
+// the same driver twice replaces the previous classifier.
+func RegisterClassifier(driver string, c Classifier) {
+	classifiersMu.Lock()
+	defer classifiersMu.Unlock()
+	for i := range classifiers {
+		if classifiers[i].driver == driver {
+			classifiers[i].Classifier = c
+			return
+		}
+	}
+	classifiers = append(classifiers, namedClassifier{driver: driver, Classifier: c})
+}
+
+// Classify returns the Kind of a database error, whichever driver produced it.
+func Classify(err error) Kind {
+	if err == sql.ErrNoRows {
+		return KindNotFound
+	}
+
+	classifiersMu.RLock()
+	defer classifiersMu.RUnlock()
+	for _, c := range classifiers {
+		if kind, ok := c.Classify(err); ok {
+			return kind
+		}
+	}
+
+	if err == driver.ErrBadConn {
+		return KindConnection
+	}
+	if _, ok := err.(net.Error); ok {
+		return KindConnection
+	}
+	if strings.Contains(err.Error(), "no rows in result set") {
+		return KindNotFound
+	}
+	return KindUnknown
+}
+
+// The codes of the database errors, refining the category of their MessageErr.
+const (
+	CodeMessageNotFound     = "message_not_found"
+	CodeDuplicateTitle      = "duplicate_title"
+	CodeUniqueViolation     = "unique_violation"
+	CodeReferenceViolation  = "reference_violation"
+	CodeDeadlock            = "deadlock"
+	CodeDatabaseUnavailable = "database_unavailable"
+	CodeDatabaseError       = "database_error"
+)
+
+// NewNotFoundError is the error every repository returns for a missing message.
+func NewNotFoundError() errorutils.MessageErr {
+	return errorutils.WithCode(errorutils.NewNotFoundError("no record matching gived id"), CodeMessageNotFound)
+}
+
+// NewDuplicateTitleError is the error every repository returns when a title is already in use.
+func NewDuplicateTitleError() errorutils.MessageErr {
+	return errorutils.WithCode(errorutils.NewConflictError("title already taken"), CodeDuplicateTitle)
+}
+
+// ParseError translates a database error into the MessageErr of its Kind,
+// err staying reachable through errors.Is and errors.As.
 func ParseError(err error) errorutils.MessageErr {
-	sqlErr, ok := err.(*mysql.MySQLError)
-	if !ok {
-		if strings.Contains(err.Error(), "no rows in result set") {
-			return errorutils.NewNotFoundError("no record matching gived id")
+	switch Classify(err) {
+	case KindNotFound:
+		return errorutils.Wrap(NewNotFoundError(), err)
+	case KindUniqueViolation:
+		if violatesTitle(err) {
+			return errorutils.Wrap(NewDuplicateTitleError(), err)
 		}
-		return errorutils.NewInternalServerError(fmt.Sprintf("error when trying to save message %s", err.Error()))
+		return newDatabaseError(errorutils.NewConflictError("the request conflicts with a record that already exists"), CodeUniqueViolation, err)
+	case KindForeignKeyViolation:
+		return newDatabaseError(errorutils.NewBadRequestError("the request references a record that does not exist or is still in use"), CodeReferenceViolation, err)
+	case KindDeadlock:
+		return newDatabaseError(errorutils.NewServiceUnavailableError("the request conflicted with a concurrent one, please retry"), CodeDeadlock, err)
+	case KindConnection, KindStaleStatement:
+		return newDatabaseError(errorutils.NewServiceUnavailableError("the database is unavailable, please retry later"), CodeDatabaseUnavailable, err)
 	}
-	switch sqlErr.Number {
-	case 1062:
-		return errorutils.NewInternalServerError("title already token")
+	return newDatabaseError(errorutils.NewInternalServerError(fmt.Sprintf("error when processing request: %s", err.Error())), CodeDatabaseError, err)
+}
+
+// titleConstraints is how the errors of the drivers name the unique index of
+// the message titles, before and after tenants: MySQL and PostgreSQL give the
+// name of the constraint, SQLite its columns.
+var titleConstraints = []string{"uq_messages_tenant_title", "uq_messages_title", "messages.title"}
+
+// violatesTitle tells whether the unique violation err is the one of a title.
+func violatesTitle(err error) bool {
+	for _, constraint := range titleConstraints {
+		if strings.Contains(err.Error(), constraint) {
+			return true
+		}
+	}
+	return false
+}
+
+func newDatabaseError(base errorutils.MessageErr, code string, cause error) errorutils.MessageErr {
+	return errorutils.Wrap(errorutils.WithCode(base, code), cause)
+}
+
+// IsDeadlock tells whether err comes from a database deadlock, in which case
+// the whole transaction can be retried. It looks at the codes and the database
+// errors err wraps, so a deadlock stays one through WithCode and Wrap.
+func IsDeadlock(err errorutils.MessageErr) bool {
+	for cause := error(err); cause != nil; cause = errors.Unwrap(cause) {
+		if msgErr, ok := cause.(errorutils.MessageErr); ok {
+			if msgErr.Code() == CodeDeadlock {
+				return true
+			}
+			continue
+		}
+		if Classify(cause) == KindDeadlock {
+			return true
+		}
 	}
-	return errorutils.NewInternalServerError(fmt.Sprintf("error when processing request: %s", err.Error()))
+	return false
 }
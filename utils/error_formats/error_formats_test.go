@@ -0,0 +1,145 @@
+package error_formats
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/silvergama/efficientAPI/utils/errorutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{name: "no rows", err: sql.ErrNoRows, want: KindNotFound},
+		{name: "bad connection", err: driver.ErrBadConn, want: KindConnection},
+		{name: "unknown", err: errors.New("boom"), want: KindUnknown},
+		{name: "mysql duplicate", err: &mysql.MySQLError{Number: 1062}, want: KindUniqueViolation},
+		{name: "mysql foreign key", err: &mysql.MySQLError{Number: 1452}, want: KindForeignKeyViolation},
+		{name: "mysql deadlock", err: &mysql.MySQLError{Number: 1213}, want: KindDeadlock},
+		{name: "mysql lock wait timeout", err: &mysql.MySQLError{Number: 1205}, want: KindUnknown},
+		{name: "mysql invalid connection", err: mysql.ErrInvalidConn, want: KindConnection},
+		{name: "mysql unknown statement", err: &mysql.MySQLError{Number: 1243}, want: KindStaleStatement},
+		{name: "mysql other", err: &mysql.MySQLError{Number: 1064}, want: KindUnknown},
+		{name: "postgres duplicate", err: &pq.Error{Code: "23505"}, want: KindUniqueViolation},
+		{name: "postgres foreign key", err: &pq.Error{Code: "23503"}, want: KindForeignKeyViolation},
+		{name: "postgres deadlock", err: &pq.Error{Code: "40P01"}, want: KindDeadlock},
+		{name: "postgres connection", err: &pq.Error{Code: "08006"}, want: KindConnection},
+		{name: "postgres unknown statement", err: &pq.Error{Code: "26000"}, want: KindStaleStatement},
+		{name: "postgres stale plan", err: &pq.Error{Code: "0A000", Message: "cached plan must not change result type"}, want: KindStaleStatement},
+		{name: "postgres unsupported", err: &pq.Error{Code: "0A000"}, want: KindUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualValues(t, tt.want, Classify(tt.err))
+		})
+	}
+}
+
+// The same kind of failure must give the same MessageErr whatever the driver
+func TestParseError_DriverAgnostic(t *testing.T) {
+	tests := []struct {
+		errs       []error
+		statusCode int
+		errErr     string
+	}{
+		{errs: []error{&mysql.MySQLError{Number: 1062}, &pq.Error{Code: "23505"}}, statusCode: http.StatusConflict, errErr: "conflict"},
+		{errs: []error{&mysql.MySQLError{Number: 1451}, &pq.Error{Code: "23503"}}, statusCode: http.StatusBadRequest, errErr: "bad_request"},
+		{errs: []error{&mysql.MySQLError{Number: 1213}, &pq.Error{Code: "40P01"}}, statusCode: http.StatusServiceUnavailable, errErr: "service_unavailable"},
+		{errs: []error{mysql.ErrInvalidConn, &pq.Error{Code: "08006"}, driver.ErrBadConn}, statusCode: http.StatusServiceUnavailable, errErr: "service_unavailable"},
+		{errs: []error{sql.ErrNoRows}, statusCode: http.StatusNotFound, errErr: "not_found"},
+	}
+	for _, tt := range tests {
+		first := ParseError(tt.errs[0])
+		for _, err := range tt.errs {
+			got := ParseError(err)
+			assert.EqualValues(t, tt.statusCode, got.Status())
+			assert.EqualValues(t, tt.errErr, got.Error())
+			assert.EqualValues(t, first.Message(), got.Message())
+		}
+	}
+}
+
+func TestRegisterClassifier(t *testing.T) {
+	custom := errors.New("custom driver: duplicate key")
+	RegisterClassifier("custom", ClassifierFunc(func(err error) (Kind, bool) {
+		if err == custom {
+			return KindUniqueViolation, true
+		}
+		return KindUnknown, false
+	}))
+	assert.EqualValues(t, KindUniqueViolation, Classify(custom))
+	assert.EqualValues(t, CodeUniqueViolation, ParseError(custom).Code())
+}
+
+// Only the unique index of the titles is a duplicate title, whatever the driver
+func TestParseError_UniqueViolations(t *testing.T) {
+	titles := []error{
+		&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'acme-title' for key 'uq_messages_tenant_title'"},
+		&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'acme-title' for key 'messages.uq_messages_tenant_title'"},
+		&pq.Error{Code: "23505", Message: `duplicate key value violates unique constraint "uq_messages_tenant_title"`},
+	}
+	for _, err := range titles {
+		got := ParseError(err)
+		assert.EqualValues(t, http.StatusConflict, got.Status())
+		assert.EqualValues(t, CodeDuplicateTitle, got.Code())
+		assert.EqualValues(t, "title already taken", got.Message())
+	}
+
+	others := []error{
+		&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'acme-go' for key 'uq_tags_tenant_name'"},
+		&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1-2' for key 'PRIMARY'"},
+		&pq.Error{Code: "23505", Message: `duplicate key value violates unique constraint "api_keys_pkey"`},
+	}
+	for _, err := range others {
+		got := ParseError(err)
+		assert.EqualValues(t, http.StatusConflict, got.Status())
+		assert.EqualValues(t, CodeUniqueViolation, got.Code())
+	}
+}
+
+func TestIsDeadlock(t *testing.T) {
+	deadlock := ParseError(&mysql.MySQLError{Number: 1213})
+	assert.True(t, IsDeadlock(deadlock))
+	assert.True(t, IsDeadlock(ParseError(&pq.Error{Code: "40P01"})))
+	assert.False(t, IsDeadlock(ParseError(&mysql.MySQLError{Number: 1062})))
+	assert.False(t, IsDeadlock(ParseError(mysql.ErrInvalidConn)))
+	assert.False(t, IsDeadlock(ParseError(&mysql.MySQLError{Number: 1205})))
+	assert.False(t, IsDeadlock(nil))
+
+	// a deadlock stays one once recoded or wrapped by another error
+	assert.True(t, IsDeadlock(errorutils.WithCode(deadlock, "save_failed")))
+	assert.True(t, IsDeadlock(errorutils.Wrap(errorutils.NewInternalServerError("error saving the message"), deadlock)))
+	assert.True(t, IsDeadlock(errorutils.Wrap(errorutils.NewInternalServerError("error saving the message"), fmt.Errorf("batch: %w", deadlock))))
+
+	body, err := json.Marshal(deadlock)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"message":"the request conflicted with a concurrent one, please retry","status":503,"error":"service_unavailable","code":"deadlock"}`, string(body))
+}
+
+func TestParseError_KeepsCause(t *testing.T) {
+	cause := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	err := ParseError(cause)
+	assert.EqualValues(t, CodeDeadlock, err.Code())
+
+	var mysqlErr *mysql.MySQLError
+	assert.True(t, errors.As(err, &mysqlErr))
+	assert.EqualValues(t, 1213, mysqlErr.Number)
+	assert.True(t, errors.Is(err, cause))
+
+	notFound := ParseError(sql.ErrNoRows)
+	assert.EqualValues(t, CodeMessageNotFound, notFound.Code())
+	assert.True(t, errors.Is(notFound, sql.ErrNoRows))
+	assert.True(t, errors.Is(notFound, NewNotFoundError()))
+	assert.False(t, errors.Is(notFound, err))
+}
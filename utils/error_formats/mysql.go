@@ -0,0 +1,32 @@
+package error_formats
+
+import (
+	"github.com/go-sql-driver/mysql"
+)
+
+func init() {
+	RegisterClassifier("mysql", ClassifierFunc(classifyMySQL))
+}
+
+func classifyMySQL(err error) (Kind, bool) {
+	if err == mysql.ErrInvalidConn {
+		return KindConnection, true
+	}
+	sqlErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return KindUnknown, false
+	}
+	switch sqlErr.Number {
+	case 1062:
+		return KindUniqueViolation, true
+	case 1216, 1217, 1451, 1452:
+		return KindForeignKeyViolation, true
+	case 1213:
+		return KindDeadlock, true
+	case 1040, 1053, 2002, 2003, 2006, 2013:
+		return KindConnection, true
+	case 1243, 1615:
+		return KindStaleStatement, true
+	}
+	return KindUnknown, true
+}
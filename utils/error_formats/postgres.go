@@ -0,0 +1,38 @@
+package error_formats
+
+import (
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+func init() {
+	RegisterClassifier("postgres", ClassifierFunc(classifyPostgres))
+}
+
+func classifyPostgres(err error) (Kind, bool) {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return KindUnknown, false
+	}
+	switch pqErr.Code {
+	case "23505":
+		return KindUniqueViolation, true
+	case "23503":
+		return KindForeignKeyViolation, true
+	case "40001", "40P01":
+		return KindDeadlock, true
+	case "26000":
+		return KindStaleStatement, true
+	case "0A000":
+		// the plan of a statement prepared before a schema change
+		if strings.Contains(pqErr.Message, "cached plan must not change result type") {
+			return KindStaleStatement, true
+		}
+	}
+	// class 08 is "connection exception", 57P0x are server shutdowns
+	if strings.HasPrefix(string(pqErr.Code), "08") || strings.HasPrefix(string(pqErr.Code), "57P0") {
+		return KindConnection, true
+	}
+	return KindUnknown, true
+}
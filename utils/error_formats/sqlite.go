@@ -0,0 +1,33 @@
+//go:build cgo
+// +build cgo
+
+package error_formats
+
+import (
+	"github.com/mattn/go-sqlite3"
+)
+
+// go-sqlite3 only works with cgo, without it there is no SQLite error to classify.
+func init() {
+	RegisterClassifier("sqlite3", ClassifierFunc(classifySQLite))
+}
+
+func classifySQLite(err error) (Kind, bool) {
+	sqliteErr, ok := err.(sqlite3.Error)
+	if !ok {
+		return KindUnknown, false
+	}
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return KindUniqueViolation, true
+	case sqlite3.ErrConstraintForeignKey:
+		return KindForeignKeyViolation, true
+	}
+	switch sqliteErr.Code {
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return KindDeadlock, true
+	case sqlite3.ErrCantOpen:
+		return KindConnection, true
+	}
+	return KindUnknown, true
+}
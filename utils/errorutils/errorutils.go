@@ -1,20 +1,51 @@
 package errorutils
 
 import (
-	"encoding/json"
 	"net/http"
 )
 
+// The codes of the errors built by the constructors of this package. Code
+// refines them where a caller needs to tell two errors of a status apart.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeInvalidRequest     = "invalid_request"
+	CodeTooManyRequests    = "too_many_requests"
+	CodeServerError        = "server_error"
+	CodeServiceUnavailable = "service_unavailable"
+)
+
 type MessageErr interface {
 	Message() string
 	Status() int
+	// Error is the category of the error, shared by every error of its status.
 	Error() string
+	// Code identifies the error for clients and never changes once published.
+	Code() string
+	// Details lists the fields of the request at fault, if any.
+	Details() []FieldError
+	// Unwrap returns the error that caused this one, nil when there is none.
+	Unwrap() error
+}
+
+// FieldError tells what is wrong with one field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 type messageErr struct {
-	ErrMessage string `json:"message"`
-	ErrStatus  int    `json:"status"`
-	ErrError   string `json:"error"`
+	ErrMessage string       `json:"message"`
+	ErrStatus  int          `json:"status"`
+	ErrError   string       `json:"error"`
+	ErrCode    string       `json:"code"`
+	ErrDetails []FieldError `json:"details,omitempty"`
+	// cause stays out of the responses, it may tell more than clients should know
+	cause error
 }
 
 func (e *messageErr) Message() string {
@@ -29,42 +60,112 @@ func (e *messageErr) Error() string {
 	return e.ErrError
 }
 
-func NewNotFoundError(message string) MessageErr {
-	return &messageErr{
-		ErrMessage: message,
-		ErrStatus:  http.StatusNotFound,
-		ErrError:   "not_found",
+func (e *messageErr) Code() string {
+	if e.ErrCode == "" {
+		return e.ErrError
 	}
+	return e.ErrCode
 }
 
-func NewBadRequestError(message string) MessageErr {
+func (e *messageErr) Details() []FieldError {
+	return e.ErrDetails
+}
+
+func (e *messageErr) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether target is a MessageErr with the same code, so that
+// errors.Is(err, NewNotFoundError("")) holds for every not found error.
+func (e *messageErr) Is(target error) bool {
+	t, ok := target.(MessageErr)
+	return ok && t.Code() == e.Code()
+}
+
+func newMessageErr(message string, status int, err string) MessageErr {
 	return &messageErr{
 		ErrMessage: message,
-		ErrStatus:  http.StatusBadRequest,
-		ErrError:   "bad_request",
+		ErrStatus:  status,
+		ErrError:   err,
+		ErrCode:    err,
 	}
 }
 
-func NewUnprocessibleEntityError(message string) MessageErr {
+// clone copies err into a *messageErr, for the helpers below to change it.
+func clone(err MessageErr) *messageErr {
+	if e, ok := err.(*messageErr); ok {
+		c := *e
+		return &c
+	}
 	return &messageErr{
-		ErrMessage: message,
-		ErrStatus:  http.StatusUnprocessableEntity,
-		ErrError:   "invalid_request",
+		ErrMessage: err.Message(),
+		ErrStatus:  err.Status(),
+		ErrError:   err.Error(),
+		ErrCode:    err.Code(),
+		ErrDetails: err.Details(),
+		cause:      err.Unwrap(),
 	}
 }
 
-func NewApiErrFromBites(body []byte) (MessageErr, error) {
-	var result messageErr
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-	return &result, nil
+// WithCode returns a copy of err identified by code.
+func WithCode(err MessageErr, code string) MessageErr {
+	c := clone(err)
+	c.ErrCode = code
+	return c
+}
+
+// WithDetails returns a copy of err with details added to its own.
+func WithDetails(err MessageErr, details ...FieldError) MessageErr {
+	c := clone(err)
+	c.ErrDetails = append(append([]FieldError(nil), c.ErrDetails...), details...)
+	return c
+}
+
+// Wrap returns a copy of err caused by cause, which errors.Is and errors.As
+// then look into.
+func Wrap(err MessageErr, cause error) MessageErr {
+	c := clone(err)
+	c.cause = cause
+	return c
+}
+
+func NewNotFoundError(message string) MessageErr {
+	return newMessageErr(message, http.StatusNotFound, CodeNotFound)
+}
+
+func NewBadRequestError(message string) MessageErr {
+	return newMessageErr(message, http.StatusBadRequest, CodeBadRequest)
+}
+
+func NewUnprocessibleEntityError(message string) MessageErr {
+	return newMessageErr(message, http.StatusUnprocessableEntity, CodeInvalidRequest)
+}
+
+// NewValidationError is the 422 of a request with invalid fields, one detail each.
+func NewValidationError(message string, details ...FieldError) MessageErr {
+	return WithDetails(NewUnprocessibleEntityError(message), details...)
+}
+
+func NewConflictError(message string) MessageErr {
+	return newMessageErr(message, http.StatusConflict, CodeConflict)
+}
+
+func NewUnauthorizedError(message string) MessageErr {
+	return newMessageErr(message, http.StatusUnauthorized, CodeUnauthorized)
+}
+
+func NewForbiddenError(message string) MessageErr {
+	return newMessageErr(message, http.StatusForbidden, CodeForbidden)
+}
+
+func NewTooManyRequestsError(message string) MessageErr {
+	return newMessageErr(message, http.StatusTooManyRequests, CodeTooManyRequests)
 }
 
 func NewInternalServerError(message string) MessageErr {
-	return &messageErr{
-		ErrMessage: message,
-		ErrStatus:  http.StatusInternalServerError,
-		ErrError:   "server_error",
-	}
+	return newMessageErr(message, http.StatusInternalServerError, CodeServerError)
+}
+
+func NewServiceUnavailableError(message string) MessageErr {
+	return newMessageErr(message, http.StatusServiceUnavailable, CodeServiceUnavailable)
 }
@@ -0,0 +1,71 @@
+package errorutils
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHelpers(t *testing.T) {
+	tests := []struct {
+		err    MessageErr
+		status int
+		code   string
+	}{
+		{err: NewBadRequestError("bad"), status: http.StatusBadRequest, code: CodeBadRequest},
+		{err: NewUnauthorizedError("who are you"), status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{err: NewForbiddenError("not yours"), status: http.StatusForbidden, code: CodeForbidden},
+		{err: NewNotFoundError("missing"), status: http.StatusNotFound, code: CodeNotFound},
+		{err: NewConflictError("changed"), status: http.StatusConflict, code: CodeConflict},
+		{err: NewUnprocessibleEntityError("invalid"), status: http.StatusUnprocessableEntity, code: CodeInvalidRequest},
+		{err: NewTooManyRequestsError("slow down"), status: http.StatusTooManyRequests, code: CodeTooManyRequests},
+		{err: NewInternalServerError("boom"), status: http.StatusInternalServerError, code: CodeServerError},
+		{err: NewServiceUnavailableError("later"), status: http.StatusServiceUnavailable, code: CodeServiceUnavailable},
+	}
+	for _, tt := range tests {
+		assert.EqualValues(t, tt.status, tt.err.Status())
+		assert.EqualValues(t, tt.code, tt.err.Code())
+		assert.EqualValues(t, tt.code, tt.err.Error())
+		assert.Nil(t, tt.err.Unwrap())
+	}
+}
+
+func TestWithCodeDetailsAndWrap(t *testing.T) {
+	base := NewValidationError("invalid message", FieldError{Field: "title", Code: "required", Message: "title is required"})
+	err := Wrap(WithCode(WithDetails(base, FieldError{Field: "body", Code: "required", Message: "body is required"}), "invalid_message"), io.ErrUnexpectedEOF)
+
+	assert.EqualValues(t, "invalid_message", err.Code())
+	assert.EqualValues(t, CodeInvalidRequest, err.Error())
+	assert.Len(t, err.Details(), 2)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	// the helpers copy, base is left as it was
+	assert.EqualValues(t, CodeInvalidRequest, base.Code())
+	assert.Len(t, base.Details(), 1)
+	assert.Nil(t, base.Unwrap())
+
+	body, jsonErr := json.Marshal(err)
+	assert.Nil(t, jsonErr)
+	assert.JSONEq(t, `{"message":"invalid message","status":422,"error":"invalid_request","code":"invalid_message","details":[
+		{"field":"title","code":"required","message":"title is required"},
+		{"field":"body","code":"required","message":"body is required"}]}`, string(body))
+
+	parsed, jsonErr := NewApiErrFromBites(body)
+	assert.Nil(t, jsonErr)
+	assert.EqualValues(t, "invalid_message", parsed.Code())
+	assert.EqualValues(t, err.Details(), parsed.Details())
+}
+
+func TestIs(t *testing.T) {
+	err := WithCode(NewConflictError("message 1 was modified"), "version_conflict")
+	assert.True(t, errors.Is(err, WithCode(NewConflictError(""), "version_conflict")))
+	assert.False(t, errors.Is(err, NewConflictError("")))
+	assert.True(t, errors.Is(NewNotFoundError("missing"), NewNotFoundError("")))
+
+	// a body without a code, from before codes, falls back on the category
+	parsed, _ := NewApiErrFromBites([]byte(`{"message":"missing","status":404,"error":"not_found"}`))
+	assert.EqualValues(t, CodeNotFound, parsed.Code())
+}
@@ -0,0 +1,156 @@
+package errorutils
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ProblemContentType is the media type of the RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypeBase prefixes the code of an error to give the type of its
+// problem, set it to the address of the documentation of the codes if any.
+var ProblemTypeBase = "urn:efficientapi:problem:"
+
+// Problem is a MessageErr written as RFC 7807 problem details. Code and
+// Errors are extension members, Errors listing the invalid fields.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// NewProblem returns the problem details of err, instance being the URI of
+// the request that failed.
+func NewProblem(err MessageErr, instance string) *Problem {
+	return &Problem{
+		Type:     ProblemTypeBase + err.Code(),
+		Title:    http.StatusText(err.Status()),
+		Status:   err.Status(),
+		Detail:   err.Message(),
+		Instance: instance,
+		Code:     err.Code(),
+		Errors:   err.Details(),
+	}
+}
+
+// errBody holds the members of both formats, to parse either.
+type errBody struct {
+	Message string       `json:"message"`
+	Status  int          `json:"status"`
+	Error   string       `json:"error"`
+	Code    string       `json:"code"`
+	Details []FieldError `json:"details"`
+
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Detail string       `json:"detail"`
+	Errors []FieldError `json:"errors"`
+}
+
+func (b *errBody) isProblem() bool {
+	return b.Type != "" || b.Title != "" || b.Detail != ""
+}
+
+// NewApiErrFromBites parses an error response, in the legacy format as well
+// as in the problem one.
+func NewApiErrFromBites(body []byte) (MessageErr, error) {
+	var b errBody
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, err
+	}
+	if !b.isProblem() {
+		return &messageErr{
+			ErrMessage: b.Message,
+			ErrStatus:  b.Status,
+			ErrError:   b.Error,
+			ErrCode:    b.Code,
+			ErrDetails: b.Details,
+		}, nil
+	}
+
+	code := b.Code
+	if code == "" && strings.HasPrefix(b.Type, ProblemTypeBase) {
+		code = strings.TrimPrefix(b.Type, ProblemTypeBase)
+	}
+	return &messageErr{
+		ErrMessage: b.Detail,
+		ErrStatus:  b.Status,
+		ErrError:   statusCategory(b.Status),
+		ErrCode:    code,
+		ErrDetails: b.Errors,
+	}, nil
+}
+
+// statusCategory returns the Error of the MessageErr of status, which the
+// problem format leaves out.
+func statusCategory(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnprocessableEntity:
+		return CodeInvalidRequest
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusServiceUnavailable:
+		return CodeServiceUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeServerError
+	}
+	return CodeBadRequest
+}
+
+// PrefersProblem tells whether an Accept header ranks the problem format
+// above plain JSON. Ties go to plain JSON, which older clients expect.
+func PrefersProblem(accept string) bool {
+	return quality(accept, ProblemContentType) > quality(accept, "application/json")
+}
+
+// quality returns the q value the most specific range of accept matching
+// mediaType gives it, 0 when none matches.
+func quality(accept, mediaType string) float64 {
+	mainType := strings.SplitN(mediaType, "/", 2)[0]
+	best, bestSpecificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+		specificity := -1
+		switch mediaRange {
+		case mediaType:
+			specificity = 2
+		case mainType + "/*":
+			specificity = 1
+		case "*/*":
+			specificity = 0
+		}
+		if specificity <= bestSpecificity {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		best, bestSpecificity = q, specificity
+	}
+	return best
+}
@@ -0,0 +1,68 @@
+package errorutils
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProblem(t *testing.T) {
+	err := NewValidationError("invalid message", FieldError{Field: "title", Code: "required", Message: "title is required"})
+	body, jsonErr := json.Marshal(NewProblem(err, "/messages"))
+	assert.Nil(t, jsonErr)
+	assert.JSONEq(t, `{
+		"type": "urn:efficientapi:problem:invalid_request",
+		"title": "Unprocessable Entity",
+		"status": 422,
+		"detail": "invalid message",
+		"instance": "/messages",
+		"code": "invalid_request",
+		"errors": [{"field": "title", "code": "required", "message": "title is required"}]
+	}`, string(body))
+
+	parsed, jsonErr := NewApiErrFromBites(body)
+	assert.Nil(t, jsonErr)
+	assert.EqualValues(t, "invalid message", parsed.Message())
+	assert.EqualValues(t, http.StatusUnprocessableEntity, parsed.Status())
+	assert.EqualValues(t, CodeInvalidRequest, parsed.Error())
+	assert.EqualValues(t, CodeInvalidRequest, parsed.Code())
+	assert.EqualValues(t, err.Details(), parsed.Details())
+}
+
+func TestNewApiErrFromBites_Problem(t *testing.T) {
+	// problems of other services, without our extension members
+	parsed, err := NewApiErrFromBites([]byte(`{"type":"urn:efficientapi:problem:version_conflict","title":"Conflict","status":409,"detail":"message 1 was modified"}`))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "version_conflict", parsed.Code())
+	assert.EqualValues(t, CodeConflict, parsed.Error())
+
+	parsed, err = NewApiErrFromBites([]byte(`{"type":"about:blank","title":"Bad Gateway","status":502}`))
+	assert.Nil(t, err)
+	assert.EqualValues(t, http.StatusBadGateway, parsed.Status())
+	assert.EqualValues(t, CodeServerError, parsed.Code())
+
+	_, err = NewApiErrFromBites([]byte(`<html>`))
+	assert.NotNil(t, err)
+}
+
+func TestPrefersProblem(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "*/*", want: false},
+		{accept: "application/json", want: false},
+		{accept: "application/problem+json", want: true},
+		{accept: "application/json, application/problem+json", want: false},
+		{accept: "application/json;q=0.9, application/problem+json", want: true},
+		{accept: "application/problem+json;q=0.5, application/*", want: false},
+		{accept: "Application/Problem+JSON", want: true},
+		{accept: "text/html, application/problem+json;q=0.1", want: true},
+	}
+	for _, tt := range tests {
+		assert.EqualValues(t, tt.want, PrefersProblem(tt.accept), tt.accept)
+	}
+}